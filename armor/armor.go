@@ -42,6 +42,11 @@ func ArmorWithTypeAndCustomHeaders(input []byte, armorType, version, comment str
 	return armorWithTypeAndHeaders(input, armorType, headers)
 }
 
+// ArmorWithTypeAndHeaders armors input with the given armorType and headers.
+func ArmorWithTypeAndHeaders(input []byte, armorType string, headers map[string]string) (string, error) {
+	return armorWithTypeAndHeaders(input, armorType, headers)
+}
+
 // Unarmor unarmors an armored input into a byte array.
 func Unarmor(input string) ([]byte, error) {
 	b, err := internal.Unarmor(input)
@@ -9,4 +9,5 @@ const (
 	PGPSignatureHeader = "PGP SIGNATURE"
 	PublicKeyHeader    = "PGP PUBLIC KEY BLOCK"
 	PrivateKeyHeader   = "PGP PRIVATE KEY BLOCK"
+	SecretShareHeader  = "PGP SECRET SHARE"
 )
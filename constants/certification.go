@@ -0,0 +1,16 @@
+package constants
+
+// Certification levels, as defined by the user ID certification signature
+// types 0x10 (generic) to 0x13 (positive) in RFC 4880, section 5.2.1.
+const (
+	CertificationGeneric  int = 0
+	CertificationPersona  int = 1
+	CertificationCasual   int = 2
+	CertificationPositive int = 3
+)
+
+// Trust amounts of trust signatures, as defined in RFC 4880, section 5.2.3.13.
+const (
+	TrustAmountPartial int = 60
+	TrustAmountFull    int = 120
+)
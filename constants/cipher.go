@@ -11,11 +11,12 @@ const (
 )
 
 const (
-	SIGNATURE_OK          int = 0
-	SIGNATURE_NOT_SIGNED  int = 1
-	SIGNATURE_NO_VERIFIER int = 2
-	SIGNATURE_FAILED      int = 3
-	SIGNATURE_BAD_CONTEXT int = 4
+	SIGNATURE_OK            int = 0
+	SIGNATURE_NOT_SIGNED    int = 1
+	SIGNATURE_NO_VERIFIER   int = 2
+	SIGNATURE_FAILED        int = 3
+	SIGNATURE_BAD_CONTEXT   int = 4
+	SIGNATURE_BAD_RECIPIENT int = 5
 )
 
 const DefaultCompression = 2      // ZLIB
@@ -0,0 +1,10 @@
+package constants
+
+// Limits of the decryption of untrusted messages.
+const (
+	DECRYPTION_LIMIT_DECOMPRESSED_SIZE int = 1
+	DECRYPTION_LIMIT_COMPRESSION_RATIO int = 2
+	DECRYPTION_LIMIT_NESTING_DEPTH     int = 3
+	DECRYPTION_LIMIT_KEY_PACKETS       int = 4
+	DECRYPTION_LIMIT_SIGNATURES        int = 5
+)
@@ -0,0 +1,7 @@
+package constants
+
+// Text encodings of paper key backups.
+const (
+	PaperKeyBase16 = "base16"
+	PaperKeyBase32 = "base32"
+)
@@ -0,0 +1,14 @@
+package constants
+
+// String-to-key modes, to derive keys from passphrases.
+const (
+	S2KIterated = "iterated"
+	S2KArgon2   = "argon2"
+)
+
+// AEAD mode names.
+const (
+	AEADEAX = "eax"
+	AEADOCB = "ocb"
+	AEADGCM = "gcm"
+)
@@ -0,0 +1,7 @@
+package constants
+
+// Kinds of secrets split in secret shares.
+const (
+	SecretShareKey        = "key"
+	SecretShareSessionKey = "session-key"
+)
@@ -71,6 +71,7 @@ func (ap *AttachmentProcessor) Finish() (*PGPSplitMessage, error) {
 // a file. It takes an estimatedSize and fileName as hints about the file.
 func (keyRing *KeyRing) newAttachmentProcessor(
 	estimatedSize int, filename string, isBinary bool, modTime uint32, garbageCollector int, //nolint:unparam
+	padding *PaddingPolicy,
 ) (*AttachmentProcessor, error) {
 	attachmentProc := &AttachmentProcessor{}
 	// You could also add these one at a time if needed.
@@ -105,7 +106,11 @@ func (keyRing *KeyRing) newAttachmentProcessor(
 
 	var ew io.WriteCloser
 	var encryptErr error
-	ew, encryptErr = openpgp.Encrypt(writer, keyRing.entities, nil, hints, config)
+	if padding != nil {
+		ew, encryptErr = asymmetricEncryptStream(hints, writer, writer, keyRing, nil, false, nil, padding, false)
+	} else {
+		ew, encryptErr = openpgp.Encrypt(writer, keyRing.entities, nil, hints, config)
+	}
 	if encryptErr != nil {
 		return nil, errors.Wrap(encryptErr, "gopengpp: unable to encrypt attachment")
 	}
@@ -130,6 +135,7 @@ func (keyRing *KeyRing) EncryptAttachment(message *PlainMessage, filename string
 		message.IsBinary(),
 		message.Time,
 		-1,
+		nil,
 	)
 	if err != nil {
 		return nil, err
@@ -149,23 +155,32 @@ func (keyRing *KeyRing) EncryptAttachment(message *PlainMessage, filename string
 func (keyRing *KeyRing) NewLowMemoryAttachmentProcessor(
 	estimatedSize int, filename string,
 ) (*AttachmentProcessor, error) {
-	return keyRing.newAttachmentProcessor(estimatedSize, filename, true, uint32(GetUnixTime()), 1<<20)
+	return keyRing.newAttachmentProcessor(estimatedSize, filename, true, uint32(GetUnixTime()), 1<<20, nil)
+}
+
+// NewLowMemoryAttachmentProcessorWithPadding creates an AttachmentProcessor
+// which can be used to encrypt a file, like NewLowMemoryAttachmentProcessor,
+// padding the data packet as described by the padding policy to hide the
+// size of the file.
+func (keyRing *KeyRing) NewLowMemoryAttachmentProcessorWithPadding(
+	estimatedSize int, filename string, padding *PaddingPolicy,
+) (*AttachmentProcessor, error) {
+	if padding == nil {
+		return nil, errors.New("gopenpgp: no padding policy provided")
+	}
+	return keyRing.newAttachmentProcessor(estimatedSize, filename, true, uint32(GetUnixTime()), 1<<20, padding)
 }
 
 // DecryptAttachment takes a PGPSplitMessage, containing a session key packet and symmetrically encrypted data
 // and returns a decrypted PlainMessage
 // Specifically designed for attachments rather than text messages.
 func (keyRing *KeyRing) DecryptAttachment(message *PGPSplitMessage) (*PlainMessage, error) {
-	privKeyEntries := keyRing.entities
-
 	keyReader := bytes.NewReader(message.GetBinaryKeyPacket())
 	dataReader := bytes.NewReader(message.GetBinaryDataPacket())
 
 	encryptedReader := io.MultiReader(keyReader, dataReader)
 
-	config := &packet.Config{Time: getTimeGenerator()}
-
-	md, err := openpgp.ReadMessage(encryptedReader, privKeyEntries, nil, config)
+	md, _, err := asymmetricDecryptStream(encryptedReader, keyRing, nil, 0, nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "gopengpp: unable to read attachment")
 	}
@@ -73,6 +73,26 @@ func (ap *ManualAttachmentProcessor) Finish() error {
 // otherwise Finish() will return an error.
 func (keyRing *KeyRing) NewManualAttachmentProcessor(
 	estimatedSize int, filename string, dataBuffer []byte,
+) (*ManualAttachmentProcessor, error) {
+	return keyRing.newManualAttachmentProcessor(estimatedSize, filename, dataBuffer, nil)
+}
+
+// NewManualAttachmentProcessorWithPadding creates an AttachmentProcessor
+// which can be used to encrypt a file, like NewManualAttachmentProcessor,
+// padding the data packet as described by the padding policy to hide the
+// size of the file. The dataBuffer must be large enough to hold the padded
+// data packet.
+func (keyRing *KeyRing) NewManualAttachmentProcessorWithPadding(
+	estimatedSize int, filename string, dataBuffer []byte, padding *PaddingPolicy,
+) (*ManualAttachmentProcessor, error) {
+	if padding == nil {
+		return nil, errors.New("gopenpgp: no padding policy provided")
+	}
+	return keyRing.newManualAttachmentProcessor(estimatedSize, filename, dataBuffer, padding)
+}
+
+func (keyRing *KeyRing) newManualAttachmentProcessor(
+	estimatedSize int, filename string, dataBuffer []byte, padding *PaddingPolicy, //nolint:unparam
 ) (*ManualAttachmentProcessor, error) {
 	if len(dataBuffer) == 0 {
 		return nil, errors.New("gopenpgp: can't give a nil or empty buffer to process the attachment")
@@ -128,7 +148,11 @@ func (keyRing *KeyRing) NewManualAttachmentProcessor(
 	// We generate the encrypting writer
 	var ew io.WriteCloser
 	var encryptErr error
-	ew, encryptErr = openpgp.EncryptSplit(keyWriter, dataWriter, keyRing.entities, nil, hints, config)
+	if padding != nil {
+		ew, encryptErr = asymmetricEncryptStream(hints, keyWriter, dataWriter, keyRing, nil, false, nil, padding, false)
+	} else {
+		ew, encryptErr = openpgp.EncryptSplit(keyWriter, dataWriter, keyRing.entities, nil, hints, config)
+	}
 	if encryptErr != nil {
 		return nil, errors.Wrap(encryptErr, "gopengpp: unable to encrypt attachment")
 	}
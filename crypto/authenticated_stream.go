@@ -0,0 +1,188 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// PlaintextBuffer stores the decrypted data of a message until the message is
+// authenticated, see KeyRing.DecryptStreamAuthenticated.
+type PlaintextBuffer interface {
+	// Write appends decrypted data to the buffer.
+	Write(b []byte) (n int, err error)
+	// GetReader returns a reader of all the data written to the buffer.
+	GetReader() (Reader, error)
+	// Close deletes the buffered data and releases the storage of the buffer.
+	Close() error
+}
+
+// plaintextBuffer keeps the data in memory up to a threshold, and in a file
+// past it.
+type plaintextBuffer struct {
+	spillThreshold int64
+	tempDir        string
+	memory         bytes.Buffer
+	file           *os.File
+	isTempFile     bool
+}
+
+// NewMemoryPlaintextBuffer returns a PlaintextBuffer keeping the data in
+// memory until it exceeds spillThreshold bytes, then in a temporary file
+// created in tempDir, or in the default directory for temporary files if
+// tempDir is empty. The temporary file is removed when the buffer is closed.
+// A spillThreshold of 0 keeps all the data in memory.
+func NewMemoryPlaintextBuffer(spillThreshold int64, tempDir string) PlaintextBuffer {
+	return &plaintextBuffer{spillThreshold: spillThreshold, tempDir: tempDir}
+}
+
+// NewFilePlaintextBuffer returns a PlaintextBuffer keeping the data in the
+// given empty file. The file is truncated and closed when the buffer is
+// closed.
+func NewFilePlaintextBuffer(file *os.File) PlaintextBuffer {
+	return &plaintextBuffer{file: file}
+}
+
+func (buffer *plaintextBuffer) Write(b []byte) (n int, err error) {
+	if buffer.file == nil && buffer.spillThreshold > 0 &&
+		int64(buffer.memory.Len()+len(b)) > buffer.spillThreshold {
+		if err = buffer.spill(); err != nil {
+			return 0, err
+		}
+	}
+	if buffer.file != nil {
+		return buffer.file.Write(b)
+	}
+	return buffer.memory.Write(b)
+}
+
+// spill moves the data kept in memory to a temporary file.
+func (buffer *plaintextBuffer) spill() error {
+	file, err := ioutil.TempFile(buffer.tempDir, "gopenpgp-plaintext-")
+	if err != nil {
+		return errors.Wrap(err, "gopenpgp: error in creating plaintext buffer file")
+	}
+	buffer.file, buffer.isTempFile = file, true
+
+	if _, err = buffer.file.Write(buffer.memory.Bytes()); err != nil {
+		return errors.Wrap(err, "gopenpgp: error in writing plaintext buffer file")
+	}
+	clearBuffer(&buffer.memory)
+	return nil
+}
+
+func (buffer *plaintextBuffer) GetReader() (Reader, error) {
+	if buffer.file == nil {
+		return bytes.NewReader(buffer.memory.Bytes()), nil
+	}
+	if _, err := buffer.file.Seek(0, io.SeekStart); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in reading plaintext buffer file")
+	}
+	return buffer.file, nil
+}
+
+func (buffer *plaintextBuffer) Close() error {
+	clearBuffer(&buffer.memory)
+	if buffer.file == nil {
+		return nil
+	}
+
+	file := buffer.file
+	buffer.file = nil
+	if buffer.isTempFile {
+		_ = file.Close()
+		if err := os.Remove(file.Name()); err != nil {
+			return errors.Wrap(err, "gopenpgp: error in removing plaintext buffer file")
+		}
+		return nil
+	}
+	if err := file.Truncate(0); err != nil {
+		_ = file.Close()
+		return errors.Wrap(err, "gopenpgp: error in truncating plaintext buffer file")
+	}
+	return file.Close()
+}
+
+func clearBuffer(buffer *bytes.Buffer) {
+	data := buffer.Bytes()
+	for i := range data {
+		data[i] = 0
+	}
+	buffer.Reset()
+}
+
+// DecryptStreamAuthenticated is used to decrypt a pgp message as a Reader,
+// like DecryptStream, releasing the plaintext data only once it is
+// authenticated: the decrypted data is written to the buffer, and is only
+// returned once the integrity of the message and, if verifyKeyRing is not
+// nil, its embedded signature have been verified.
+// On failure, no plaintext data is returned and the buffer is closed;
+// otherwise, the buffer should be closed once the data has been read.
+// Messages encrypted with AEAD and without a signature to verify are not
+// buffered, as each chunk is authenticated before its data is read.
+func (keyRing *KeyRing) DecryptStreamAuthenticated(
+	message Reader,
+	verifyKeyRing *KeyRing,
+	verifyTime int64,
+	buffer PlaintextBuffer,
+) (plainMessage *PlainMessageReader, err error) {
+	plainMessage, err = keyRing.DecryptStream(message, verifyKeyRing, verifyTime)
+	if err != nil {
+		_ = buffer.Close()
+		return nil, err
+	}
+	return releaseAuthenticated(plainMessage, buffer)
+}
+
+// DecryptStreamAuthenticated is used to decrypt a data packet as a Reader,
+// like DecryptStream, releasing the plaintext data only once it is
+// authenticated, see KeyRing.DecryptStreamAuthenticated.
+func (sk *SessionKey) DecryptStreamAuthenticated(
+	dataPacketReader Reader,
+	verifyKeyRing *KeyRing,
+	verifyTime int64,
+	buffer PlaintextBuffer,
+) (plainMessage *PlainMessageReader, err error) {
+	plainMessage, err = sk.DecryptStream(dataPacketReader, verifyKeyRing, verifyTime)
+	if err != nil {
+		_ = buffer.Close()
+		return nil, err
+	}
+	return releaseAuthenticated(plainMessage, buffer)
+}
+
+// releaseAuthenticated reads the decrypted message into the buffer, checking
+// its integrity and signature, and returns the message reading from the
+// buffer.
+func releaseAuthenticated(plainMessage *PlainMessageReader, buffer PlaintextBuffer) (*PlainMessageReader, error) {
+	if !plainMessage.details.IsEncrypted {
+		_ = buffer.Close()
+		return nil, errors.New("gopenpgp: message is not encrypted and can't be authenticated")
+	}
+	if _, isAEAD := plainMessage.details.UnverifiedBody.(aeadReader); isAEAD && plainMessage.verifyKeyRing == nil {
+		return plainMessage, nil
+	}
+
+	if _, err := io.Copy(buffer, plainMessage); err != nil {
+		_ = buffer.Close()
+		return nil, errors.Wrap(err, "gopenpgp: error in reading message")
+	}
+	if plainMessage.verifyKeyRing != nil {
+		if err := plainMessage.VerifySignature(); err != nil {
+			_ = buffer.Close()
+			return nil, err
+		}
+	}
+
+	body, err := buffer.GetReader()
+	if err != nil {
+		_ = buffer.Close()
+		return nil, err
+	}
+	plainMessage.details.UnverifiedBody = body
+	plainMessage.readAll = false
+	return plainMessage, nil
+}
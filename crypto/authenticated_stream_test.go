@@ -0,0 +1,206 @@
+package crypto
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingPlaintextBuffer records the use of a PlaintextBuffer.
+type recordingPlaintextBuffer struct {
+	PlaintextBuffer
+	written int
+	closed  bool
+}
+
+func (buffer *recordingPlaintextBuffer) Write(b []byte) (n int, err error) {
+	buffer.written += len(b)
+	return buffer.PlaintextBuffer.Write(b)
+}
+
+func (buffer *recordingPlaintextBuffer) Close() error {
+	buffer.closed = true
+	return buffer.PlaintextBuffer.Close()
+}
+
+func encryptSignedStream(t *testing.T, data []byte) []byte {
+	var ciphertext bytes.Buffer
+	messageWriter, err := keyRingTestPublic.EncryptStream(&ciphertext, nil, keyRingTestPrivate)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting stream, got:", err)
+	}
+	if _, err = messageWriter.Write(data); err != nil {
+		t.Fatal("Expected no error when writing plaintext, got:", err)
+	}
+	if err = messageWriter.Close(); err != nil {
+		t.Fatal("Expected no error when closing plaintext writer, got:", err)
+	}
+	return ciphertext.Bytes()
+}
+
+func encryptAEADDataPacket(t *testing.T, sk *SessionKey, data []byte) []byte {
+	cipherFunc, err := sk.GetCipherFunc()
+	if err != nil {
+		t.Fatal("Expected no error when getting cipher function, got:", err)
+	}
+	config := &packet.Config{AEADConfig: &packet.AEADConfig{ChunkSize: 64}}
+
+	var dataPacket bytes.Buffer
+	writer, err := packet.SerializeSymmetricallyEncrypted(
+		&dataPacket,
+		cipherFunc,
+		true,
+		packet.CipherSuite{Cipher: cipherFunc, Mode: packet.AEADModeOCB},
+		sk.Key,
+		config,
+	)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting data packet, got:", err)
+	}
+	literalWriter, err := packet.SerializeLiteral(writer, true, "", 0)
+	if err != nil {
+		t.Fatal("Expected no error when writing literal packet, got:", err)
+	}
+	if _, err = literalWriter.Write(data); err != nil {
+		t.Fatal("Expected no error when writing data, got:", err)
+	}
+	if err = literalWriter.Close(); err != nil {
+		t.Fatal("Expected no error when closing data packet, got:", err)
+	}
+	return dataPacket.Bytes()
+}
+
+func TestDecryptStreamAuthenticated(t *testing.T) {
+	data := bytes.Repeat([]byte("authenticated "), 100)
+	ciphertext := encryptSignedStream(t, data)
+
+	buffer := &recordingPlaintextBuffer{PlaintextBuffer: NewMemoryPlaintextBuffer(0, "")}
+	reader, err := keyRingTestPrivate.DecryptStreamAuthenticated(bytes.NewReader(ciphertext), keyRingTestPublic, GetUnixTime(), buffer)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting stream, got:", err)
+	}
+	assert.Exactly(t, len(data), buffer.written)
+	decrypted, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal("Expected no error when reading plaintext, got:", err)
+	}
+	assert.Exactly(t, data, decrypted)
+	assert.NoError(t, reader.VerifySignature())
+	assert.NoError(t, buffer.Close())
+}
+
+func TestDecryptStreamAuthenticatedFailures(t *testing.T) {
+	data := bytes.Repeat([]byte("authenticated "), 100)
+	ciphertext := encryptSignedStream(t, data)
+
+	// Integrity failure
+	tampered := append([]byte{}, ciphertext...)
+	tampered[len(tampered)-1] ^= 1
+	buffer := &recordingPlaintextBuffer{PlaintextBuffer: NewMemoryPlaintextBuffer(0, "")}
+	reader, err := keyRingTestPrivate.DecryptStreamAuthenticated(bytes.NewReader(tampered), nil, 0, buffer)
+	assert.Error(t, err)
+	assert.Nil(t, reader)
+	assert.True(t, buffer.closed)
+
+	// Signature failure
+	otherKeyRing, err := NewKeyRing(keyTestEC)
+	if err != nil {
+		t.Fatal("Expected no error when building keyring, got:", err)
+	}
+	buffer = &recordingPlaintextBuffer{PlaintextBuffer: NewMemoryPlaintextBuffer(0, "")}
+	reader, err = keyRingTestPrivate.DecryptStreamAuthenticated(bytes.NewReader(ciphertext), otherKeyRing, GetUnixTime(), buffer)
+	assert.Error(t, err)
+	assert.Nil(t, reader)
+	assert.True(t, buffer.closed)
+}
+
+func TestDecryptStreamAuthenticatedSpill(t *testing.T) {
+	data := bytes.Repeat([]byte("spilled "), 1000)
+	ciphertext := encryptSignedStream(t, data)
+	tempDir := t.TempDir()
+
+	buffer := NewMemoryPlaintextBuffer(1024, tempDir)
+	reader, err := keyRingTestPrivate.DecryptStreamAuthenticated(bytes.NewReader(ciphertext), keyRingTestPublic, GetUnixTime(), buffer)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting stream, got:", err)
+	}
+	files, err := ioutil.ReadDir(tempDir)
+	if err != nil {
+		t.Fatal("Expected no error when listing temporary files, got:", err)
+	}
+	assert.Len(t, files, 1)
+
+	decrypted, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal("Expected no error when reading plaintext, got:", err)
+	}
+	assert.Exactly(t, data, decrypted)
+	assert.NoError(t, buffer.Close())
+
+	files, err = ioutil.ReadDir(tempDir)
+	if err != nil {
+		t.Fatal("Expected no error when listing temporary files, got:", err)
+	}
+	assert.Len(t, files, 0)
+}
+
+func TestDecryptStreamAuthenticatedFile(t *testing.T) {
+	data := bytes.Repeat([]byte("in a file "), 100)
+	ciphertext := encryptSignedStream(t, data)
+
+	file, err := ioutil.TempFile(t.TempDir(), "plaintext")
+	if err != nil {
+		t.Fatal("Expected no error when creating file, got:", err)
+	}
+	buffer := NewFilePlaintextBuffer(file)
+	reader, err := keyRingTestPrivate.DecryptStreamAuthenticated(bytes.NewReader(ciphertext), keyRingTestPublic, GetUnixTime(), buffer)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting stream, got:", err)
+	}
+	decrypted, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal("Expected no error when reading plaintext, got:", err)
+	}
+	assert.Exactly(t, data, decrypted)
+	assert.NoError(t, buffer.Close())
+
+	contents, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal("Expected no error when reading file, got:", err)
+	}
+	assert.Len(t, contents, 0)
+}
+
+func TestSessionKeyDecryptStreamAuthenticatedAEAD(t *testing.T) {
+	data := bytes.Repeat([]byte("chunked "), 100)
+	dataPacket := encryptAEADDataPacket(t, testSessionKey, data)
+
+	// AEAD chunks are released without buffering
+	buffer := &recordingPlaintextBuffer{PlaintextBuffer: NewMemoryPlaintextBuffer(0, "")}
+	reader, err := testSessionKey.DecryptStreamAuthenticated(bytes.NewReader(dataPacket), nil, 0, buffer)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting stream, got:", err)
+	}
+	decrypted, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal("Expected no error when reading plaintext, got:", err)
+	}
+	assert.Exactly(t, data, decrypted)
+	assert.Exactly(t, 0, buffer.written)
+
+	// A tampered chunk fails once it is reached, after the verified chunks
+	tampered := append([]byte{}, dataPacket...)
+	tampered[len(tampered)-40] ^= 1
+	reader, err = testSessionKey.DecryptStreamAuthenticated(bytes.NewReader(tampered), nil, 0, buffer)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting stream, got:", err)
+	}
+	decrypted, err = ioutil.ReadAll(reader)
+	assert.Error(t, err)
+	assert.NotEmpty(t, decrypted)
+	assert.Exactly(t, data[:len(decrypted)], decrypted)
+	assert.Exactly(t, 0, buffer.written)
+}
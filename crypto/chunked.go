@@ -0,0 +1,483 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	chunkedFileIDSize   = 32
+	chunkedTagSize      = 16
+	chunkedNonceSize    = 12
+	chunkedMaxBlockSize = 1 << 30
+
+	// chunkedManifestContext is the signing context of the signatures of
+	// chunked file manifests.
+	chunkedManifestContext = "gopenpgp-chunked-file-manifest"
+)
+
+var chunkedKeyInfo = []byte("gopenpgp chunked file")
+
+// ChunkedManifest describes a file encrypted in independent blocks by
+// SessionKey.EncryptChunked, optionally signed. It is a file Manifest, which
+// also records the block size and the file ID the block key is derived from,
+// so that it can be an entry of a directory manifest.
+// The encrypted blocks are stored one after the other, each one
+// GetBlockSize() + 16 bytes long except the last one.
+type ChunkedManifest struct {
+	manifest  *Manifest
+	size      int64
+	signature *PGPSignature
+}
+
+// manifestChunked holds the parameters of a file encrypted in independent
+// blocks, in its manifest.
+type manifestChunked struct {
+	FileID    []byte `json:"fileId"`
+	BlockSize int    `json:"blockSize"`
+}
+
+// NewChunkedManifest reads a chunked file manifest from its encoding, as
+// returned by GetBinary, and its signature, which can be nil.
+func NewChunkedManifest(data []byte, signature *PGPSignature) (*ChunkedManifest, error) {
+	manifest, err := NewManifest(data)
+	if err != nil {
+		return nil, err
+	}
+	return newChunkedManifest(manifest, signature)
+}
+
+func newChunkedManifest(manifest *Manifest, signature *PGPSignature) (*ChunkedManifest, error) {
+	if manifest.data.Chunked == nil {
+		return nil, errors.New("gopenpgp: not a chunked file manifest")
+	}
+	if err := manifest.data.validate(); err != nil {
+		return nil, err
+	}
+	return &ChunkedManifest{manifest: manifest, size: manifest.GetSize(), signature: signature}, nil
+}
+
+// GetBinary returns the encoding of the manifest, without its signature.
+func (manifest *ChunkedManifest) GetBinary() ([]byte, error) {
+	return manifest.manifest.GetBinary()
+}
+
+// GetFileManifest returns the file manifest, to add it to a directory
+// manifest or verify its blocks.
+func (manifest *ChunkedManifest) GetFileManifest() *Manifest {
+	return manifest.manifest
+}
+
+// GetSignature returns the signature of the manifest, or nil if it isn't
+// signed.
+func (manifest *ChunkedManifest) GetSignature() *PGPSignature {
+	return manifest.signature
+}
+
+// GetBlockSize returns the size of the plaintext blocks.
+func (manifest *ChunkedManifest) GetBlockSize() int {
+	return manifest.manifest.data.Chunked.BlockSize
+}
+
+// GetSize returns the size of the plaintext file.
+func (manifest *ChunkedManifest) GetSize() int64 {
+	return manifest.size
+}
+
+// GetBlockCount returns the number of blocks of the file.
+func (manifest *ChunkedManifest) GetBlockCount() int64 {
+	return int64(manifest.manifest.GetBlockCount())
+}
+
+// GetEncryptedSize returns the size of the encrypted blocks of the file.
+func (manifest *ChunkedManifest) GetEncryptedSize() int64 {
+	return manifest.size + manifest.GetBlockCount()*chunkedTagSize
+}
+
+// validate checks that all the blocks are full, but the last one which isn't
+// empty, so that the offset of each block follows from its index.
+func (chunked *manifestChunked) validate(blocks []*manifestBlock) error {
+	if len(chunked.FileID) != chunkedFileIDSize || chunked.BlockSize <= 0 || chunked.BlockSize > chunkedMaxBlockSize {
+		return errors.New("gopenpgp: invalid chunked file manifest")
+	}
+	for i, block := range blocks {
+		if block.Size > int64(chunked.BlockSize) ||
+			block.Size < int64(chunked.BlockSize) && i != len(blocks)-1 ||
+			block.Size == 0 {
+			return errors.New("gopenpgp: invalid chunked file manifest block size")
+		}
+	}
+	return nil
+}
+
+// ChunkedEncryptWriter encrypts the data written to it in independent
+// blocks, see SessionKey.EncryptChunked.
+type ChunkedEncryptWriter struct {
+	writer      io.Writer
+	aead        cipher.AEAD
+	manifest    *ChunkedManifest
+	signKeyRing *KeyRing
+	blocks      [][]byte
+	current     []byte
+	closed      bool
+}
+
+// EncryptChunked encrypts a file in independent blocks of blockSize bytes,
+// which can then be decrypted separately, in any order, by
+// SessionKey.NewChunkedDecryptReader.
+// Each block is encrypted with AES-256-GCM, with a key derived from the
+// session key and a random file ID, and with its index bound to it.
+// The encrypted blocks are written to dataWriter, and the manifest of the
+// file named name, returned by ChunkedEncryptWriter.GetManifest once the
+// writer is closed, is signed with signKeyRing if it is not nil.
+// Blocks are encrypted in parallel, in batches of as many blocks as CPUs.
+func (sk *SessionKey) EncryptChunked(
+	dataWriter Writer,
+	name string,
+	blockSize int,
+	signKeyRing *KeyRing,
+) (*ChunkedEncryptWriter, error) {
+	if blockSize <= 0 || blockSize > chunkedMaxBlockSize {
+		return nil, errors.New("gopenpgp: invalid chunked file block size")
+	}
+
+	fileID := make([]byte, chunkedFileIDSize)
+	if _, err := rand.Read(fileID); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in generating chunked file ID")
+	}
+	aead, err := newChunkedAEAD(sk, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := NewFileManifest(name)
+	manifest.data.Chunked = &manifestChunked{FileID: fileID, BlockSize: blockSize}
+	return &ChunkedEncryptWriter{
+		writer:      dataWriter,
+		aead:        aead,
+		manifest:    &ChunkedManifest{manifest: manifest},
+		signKeyRing: signKeyRing,
+		current:     make([]byte, 0, blockSize),
+	}, nil
+}
+
+// Write encrypts the data, writing the encrypted blocks once they are full.
+func (w *ChunkedEncryptWriter) Write(b []byte) (n int, err error) {
+	if w.closed {
+		return 0, errors.New("gopenpgp: chunked encryption writer is closed")
+	}
+
+	blockSize := w.manifest.GetBlockSize()
+	for len(b) > 0 {
+		// A full block is only encrypted once more data follows, as the
+		// last block is encrypted differently
+		if len(w.current) == blockSize {
+			w.blocks = append(w.blocks, w.current)
+			w.current = make([]byte, 0, blockSize)
+			if len(w.blocks) == runtime.NumCPU() {
+				if err = w.encryptBlocks(false); err != nil {
+					return n, err
+				}
+			}
+		}
+		written := copy(w.current[len(w.current):blockSize], b)
+		w.current = w.current[:len(w.current)+written]
+		b = b[written:]
+		n += written
+	}
+	return n, nil
+}
+
+// Close encrypts the last blocks, and signs the manifest if a signing keyring
+// was given.
+func (w *ChunkedEncryptWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	if len(w.current) > 0 {
+		w.blocks = append(w.blocks, w.current)
+		w.current = nil
+	}
+	if err := w.encryptBlocks(true); err != nil {
+		return err
+	}
+	w.closed = true
+
+	if w.signKeyRing != nil {
+		signature, err := w.manifest.manifest.Sign(w.signKeyRing, NewSigningContext(chunkedManifestContext, true))
+		if err != nil {
+			return errors.Wrap(err, "gopenpgp: error in signing chunked file manifest")
+		}
+		w.manifest.signature = signature
+	}
+	return nil
+}
+
+// GetManifest returns the manifest of the encrypted file, once the writer is
+// closed.
+func (w *ChunkedEncryptWriter) GetManifest() (*ChunkedManifest, error) {
+	if !w.closed {
+		return nil, errors.New("gopenpgp: chunked encryption writer must be closed to get the manifest")
+	}
+	return w.manifest, nil
+}
+
+// encryptBlocks encrypts the pending blocks in parallel and writes them in
+// order, the last one being the last block of the file if final is true.
+func (w *ChunkedEncryptWriter) encryptBlocks(final bool) error {
+	firstIndex := w.manifest.GetBlockCount()
+	encrypted := make([][]byte, len(w.blocks))
+	manifestBlocks := make([]*manifestBlock, len(w.blocks))
+
+	var wg sync.WaitGroup
+	for i, block := range w.blocks {
+		wg.Add(1)
+		go func(i int, block []byte) {
+			defer wg.Done()
+			index := firstIndex + int64(i)
+			isLast := final && i == len(w.blocks)-1
+			encrypted[i] = w.aead.Seal(nil, chunkedNonce(index), block, chunkedAdditionalData(index, isLast))
+			manifestBlocks[i] = newManifestBlock(block, encrypted[i])
+		}(i, block)
+	}
+	wg.Wait()
+
+	for i, block := range encrypted {
+		if _, err := w.writer.Write(block); err != nil {
+			return errors.Wrap(err, "gopenpgp: error in writing chunked file block")
+		}
+		w.manifest.manifest.data.Blocks = append(w.manifest.manifest.data.Blocks, manifestBlocks[i])
+		w.manifest.size += manifestBlocks[i].Size
+	}
+	w.blocks = nil
+	return nil
+}
+
+// ChunkedDecryptReader decrypts a file encrypted in independent blocks, only
+// fetching and decrypting the blocks of the data read. It implements
+// io.Reader, io.ReaderAt and io.Seeker.
+// The last decrypted block is kept, so that reads smaller than a block don't
+// decrypt it again.
+type ChunkedDecryptReader struct {
+	reader   io.ReaderAt
+	aead     cipher.AEAD
+	manifest *ChunkedManifest
+	offset   int64
+
+	cacheLock   sync.Mutex
+	cachedIndex int64
+	cachedBlock []byte
+}
+
+// NewChunkedDecryptReader returns a reader decrypting the file encrypted by
+// SessionKey.EncryptChunked, whose encrypted blocks are read from encrypted
+// and described by the manifest.
+// If verifyKeyRing is not nil, the manifest must be signed by it at
+// verifyTime. Each block is checked against the hash of the manifest and
+// authenticated when it is decrypted.
+func (sk *SessionKey) NewChunkedDecryptReader(
+	encrypted io.ReaderAt,
+	manifest *ChunkedManifest,
+	verifyKeyRing *KeyRing,
+	verifyTime int64,
+) (*ChunkedDecryptReader, error) {
+	if verifyKeyRing != nil {
+		if manifest.signature == nil {
+			return nil, errors.New("gopenpgp: chunked file manifest is not signed")
+		}
+		err := manifest.manifest.Verify(
+			verifyKeyRing,
+			manifest.signature,
+			verifyTime,
+			NewVerificationContext(chunkedManifestContext, true, 0),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	aead, err := newChunkedAEAD(sk, manifest.manifest.data.Chunked.FileID)
+	if err != nil {
+		return nil, err
+	}
+	return &ChunkedDecryptReader{reader: encrypted, aead: aead, manifest: manifest, cachedIndex: -1}, nil
+}
+
+// Size returns the size of the decrypted file.
+func (r *ChunkedDecryptReader) Size() int64 {
+	return r.manifest.size
+}
+
+// ReadAt decrypts len(b) bytes of the file from offset off, decrypting the
+// blocks in parallel.
+func (r *ChunkedDecryptReader) ReadAt(b []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("gopenpgp: negative offset")
+	}
+	if off >= r.manifest.size {
+		return 0, io.EOF
+	}
+	end := r.manifest.size
+	if int64(len(b)) < end-off {
+		end = off + int64(len(b))
+	}
+	if end == off {
+		return 0, nil
+	}
+
+	blockSize := int64(r.manifest.GetBlockSize())
+	firstIndex := off / blockSize
+	blocks := make([][]byte, (end-1)/blockSize-firstIndex+1)
+	errs := make([]error, len(blocks))
+
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, runtime.NumCPU())
+	for i := range blocks {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			blocks[i], errs[i] = r.getBlock(firstIndex + int64(i))
+			<-workers
+		}(i)
+	}
+	wg.Wait()
+	if lastIndex := len(blocks) - 1; errs[lastIndex] == nil {
+		r.setCachedBlock(firstIndex+int64(lastIndex), blocks[lastIndex])
+	}
+
+	start := off - firstIndex*blockSize
+	for i, block := range blocks {
+		if errs[i] != nil {
+			return n, errs[i]
+		}
+		n += copy(b[n:end-off], block[start:])
+		start = 0
+	}
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Read decrypts the data at the current offset.
+func (r *ChunkedDecryptReader) Read(b []byte) (n int, err error) {
+	n, err = r.ReadAt(b, r.offset)
+	r.offset += int64(n)
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the offset of the next Read.
+func (r *ChunkedDecryptReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.manifest.size
+	default:
+		return 0, errors.New("gopenpgp: invalid seek whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("gopenpgp: negative offset")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// getBlock returns the decrypted block of the given index, from the cache if
+// it is the last decrypted block.
+func (r *ChunkedDecryptReader) getBlock(index int64) ([]byte, error) {
+	r.cacheLock.Lock()
+	if index == r.cachedIndex {
+		block := r.cachedBlock
+		r.cacheLock.Unlock()
+		return block, nil
+	}
+	r.cacheLock.Unlock()
+	return r.decryptBlock(index)
+}
+
+func (r *ChunkedDecryptReader) setCachedBlock(index int64, block []byte) {
+	r.cacheLock.Lock()
+	defer r.cacheLock.Unlock()
+	r.cachedIndex = index
+	r.cachedBlock = block
+}
+
+// decryptBlock fetches, checks and decrypts the block of the given index.
+func (r *ChunkedDecryptReader) decryptBlock(index int64) ([]byte, error) {
+	blocks := r.manifest.manifest.data.Blocks
+	if index < 0 || index >= int64(len(blocks)) {
+		return nil, errors.New("gopenpgp: chunked file block index out of range")
+	}
+	blockSize := int64(r.manifest.GetBlockSize())
+
+	block := make([]byte, blocks[index].Size+chunkedTagSize)
+	n, err := r.reader.ReadAt(block, index*(blockSize+chunkedTagSize))
+	if n < len(block) {
+		if err == nil || errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, errors.Wrap(err, "gopenpgp: error in reading chunked file block")
+	}
+
+	hash := sha256.Sum256(block)
+	if !bytes.Equal(hash[:], blocks[index].EncryptedHash) {
+		return nil, errors.New("gopenpgp: chunked file block doesn't match the manifest")
+	}
+	isLast := index == int64(len(blocks))-1
+	plaintext, err := r.aead.Open(block[:0], chunkedNonce(index), block, chunkedAdditionalData(index, isLast))
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in decrypting chunked file block")
+	}
+	return plaintext, nil
+}
+
+// newChunkedAEAD returns the AES-256-GCM cipher of the blocks of a file, with
+// a key derived from the session key and the file ID.
+func newChunkedAEAD(sk *SessionKey, fileID []byte) (cipher.AEAD, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sk.Key, fileID, chunkedKeyInfo), key); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in deriving chunked file key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in creating chunked file cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in creating chunked file cipher")
+	}
+	return aead, nil
+}
+
+func chunkedNonce(index int64) []byte {
+	nonce := make([]byte, chunkedNonceSize)
+	binary.BigEndian.PutUint64(nonce[chunkedNonceSize-8:], uint64(index))
+	return nonce
+}
+
+// chunkedAdditionalData binds the index of the block, and whether it is the
+// last one, so that blocks can't be reordered and files can't be truncated.
+func chunkedAdditionalData(index int64, isLast bool) []byte {
+	data := make([]byte, 9)
+	binary.BigEndian.PutUint64(data, uint64(index))
+	if isLast {
+		data[8] = 1
+	}
+	return data
+}
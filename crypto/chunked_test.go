@@ -0,0 +1,264 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encryptChunked(t *testing.T, data []byte, blockSize int, signKeyRing *KeyRing) ([]byte, *ChunkedManifest) {
+	var encrypted bytes.Buffer
+	writer, err := testSessionKey.EncryptChunked(&encrypted, "file.bin", blockSize, signKeyRing)
+	if err != nil {
+		t.Fatal("Expected no error when creating chunked writer, got:", err)
+	}
+	// Odd writes, across block boundaries
+	for remaining := data; len(remaining) > 0; {
+		n := 37
+		if n > len(remaining) {
+			n = len(remaining)
+		}
+		if _, err = writer.Write(remaining[:n]); err != nil {
+			t.Fatal("Expected no error when writing plaintext, got:", err)
+		}
+		remaining = remaining[n:]
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal("Expected no error when closing chunked writer, got:", err)
+	}
+	manifest, err := writer.GetManifest()
+	if err != nil {
+		t.Fatal("Expected no error when getting manifest, got:", err)
+	}
+	return encrypted.Bytes(), manifest
+}
+
+// withChunkedBlocks returns an unsigned copy of the manifest listing the
+// given blocks instead.
+func withChunkedBlocks(t *testing.T, manifest *ChunkedManifest, blocks []*manifestBlock) *ChunkedManifest {
+	data := manifest.GetFileManifest().data
+	data.Blocks = blocks
+	modified, err := newChunkedManifest(&Manifest{data: data}, nil)
+	if err != nil {
+		t.Fatal("Expected no error when modifying manifest, got:", err)
+	}
+	return modified
+}
+
+func TestChunkedEncryption(t *testing.T) {
+	data := make([]byte, 1050)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal("Expected no error when generating data, got:", err)
+	}
+	encrypted, manifest := encryptChunked(t, data, 100, keyRingTestPrivate)
+	assert.Exactly(t, int64(11), manifest.GetBlockCount())
+	assert.Exactly(t, int64(len(encrypted)), manifest.GetEncryptedSize())
+
+	// The manifest is transported separately
+	binary, err := manifest.GetBinary()
+	if err != nil {
+		t.Fatal("Expected no error when encoding manifest, got:", err)
+	}
+	manifest, err = NewChunkedManifest(binary, manifest.GetSignature())
+	if err != nil {
+		t.Fatal("Expected no error when reading manifest, got:", err)
+	}
+	assert.Exactly(t, 100, manifest.GetBlockSize())
+	assert.Exactly(t, int64(len(data)), manifest.GetSize())
+
+	reader, err := testSessionKey.NewChunkedDecryptReader(bytes.NewReader(encrypted), manifest, keyRingTestPublic, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when creating chunked reader, got:", err)
+	}
+	assert.Exactly(t, int64(len(data)), reader.Size())
+
+	decrypted, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal("Expected no error when reading file, got:", err)
+	}
+	assert.Exactly(t, data, decrypted)
+
+	buf := make([]byte, 250)
+	n, err := reader.ReadAt(buf, 175)
+	if err != nil {
+		t.Fatal("Expected no error when reading range, got:", err)
+	}
+	assert.Exactly(t, data[175:425], buf[:n])
+
+	n, err = reader.ReadAt(buf, 1000)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Exactly(t, data[1000:], buf[:n])
+
+	if _, err = reader.Seek(-30, io.SeekEnd); err != nil {
+		t.Fatal("Expected no error when seeking, got:", err)
+	}
+	decrypted, err = ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal("Expected no error when reading file end, got:", err)
+	}
+	assert.Exactly(t, data[1020:], decrypted)
+}
+
+func TestChunkedEncryptionBlockMultiple(t *testing.T) {
+	for _, size := range []int{0, 100, 1000} {
+		data := bytes.Repeat([]byte{42}, size)
+		encrypted, manifest := encryptChunked(t, data, 100, nil)
+		assert.Exactly(t, int64(size/100), manifest.GetBlockCount())
+		assert.Nil(t, manifest.GetSignature())
+
+		reader, err := testSessionKey.NewChunkedDecryptReader(bytes.NewReader(encrypted), manifest, nil, 0)
+		if err != nil {
+			t.Fatal("Expected no error when creating chunked reader, got:", err)
+		}
+		decrypted, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal("Expected no error when reading file, got:", err)
+		}
+		assert.Exactly(t, data, decrypted)
+	}
+}
+
+func TestChunkedEncryptionTampering(t *testing.T) {
+	data := bytes.Repeat([]byte("chunk"), 200)
+	encrypted, manifest := encryptChunked(t, data, 100, keyRingTestPrivate)
+	encryptedBlockSize := 100 + chunkedTagSize
+	buf := make([]byte, 100)
+
+	// A modified block fails, the other blocks are still readable
+	tampered := append([]byte{}, encrypted...)
+	tampered[3*encryptedBlockSize] ^= 1
+	reader, err := testSessionKey.NewChunkedDecryptReader(bytes.NewReader(tampered), manifest, keyRingTestPublic, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when creating chunked reader, got:", err)
+	}
+	_, err = reader.ReadAt(buf, 300)
+	assert.Error(t, err)
+	_, err = reader.ReadAt(buf, 400)
+	assert.NoError(t, err)
+
+	// Reordered blocks, with a matching unsigned manifest
+	reordered := append([]byte{}, encrypted...)
+	copy(reordered, encrypted[encryptedBlockSize:2*encryptedBlockSize])
+	copy(reordered[encryptedBlockSize:], encrypted[:encryptedBlockSize])
+	blocks := manifest.GetFileManifest().data.Blocks
+	reorderedManifest := withChunkedBlocks(t, manifest, append([]*manifestBlock{blocks[1], blocks[0]}, blocks[2:]...))
+	reader, err = testSessionKey.NewChunkedDecryptReader(bytes.NewReader(reordered), reorderedManifest, nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error when creating chunked reader, got:", err)
+	}
+	_, err = reader.ReadAt(buf, 0)
+	assert.Error(t, err)
+
+	// Truncated file, with a matching unsigned manifest
+	truncatedManifest := withChunkedBlocks(t, manifest, blocks[:5])
+	reader, err = testSessionKey.NewChunkedDecryptReader(bytes.NewReader(encrypted), truncatedManifest, nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error when creating chunked reader, got:", err)
+	}
+	_, err = reader.ReadAt(buf, 400)
+	assert.Error(t, err)
+
+	// The modified manifests are not signed
+	_, err = testSessionKey.NewChunkedDecryptReader(bytes.NewReader(encrypted), truncatedManifest, keyRingTestPublic, GetUnixTime())
+	assert.Error(t, err)
+	truncatedManifest.signature = manifest.GetSignature()
+	_, err = testSessionKey.NewChunkedDecryptReader(bytes.NewReader(encrypted), truncatedManifest, keyRingTestPublic, GetUnixTime())
+	assert.Error(t, err)
+}
+
+func TestChunkedEncryptionErrors(t *testing.T) {
+	_, err := testSessionKey.EncryptChunked(ioutil.Discard, "file.bin", 0, nil)
+	assert.Error(t, err)
+
+	_, err = NewChunkedManifest([]byte{1, 2, 3}, nil)
+	assert.Error(t, err)
+
+	// A file manifest of blocks which aren't encrypted by EncryptChunked
+	fileManifest, _ := newTestFileManifest(t, "file.bin", "block")
+	unchunked, err := fileManifest.GetBinary()
+	if err != nil {
+		t.Fatal("Expected no error when encoding manifest, got:", err)
+	}
+	_, err = NewChunkedManifest(unchunked, nil)
+	assert.Error(t, err)
+
+	// A block which isn't the last one must be full, so that the offsets of
+	// the blocks follow from their index
+	_, manifest := encryptChunked(t, make([]byte, 300), 100, nil)
+	data := manifest.GetFileManifest().data
+	shortBlock := *data.Blocks[1]
+	shortBlock.Size = 50
+	data.Blocks = []*manifestBlock{data.Blocks[0], &shortBlock, data.Blocks[2]}
+	crafted, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal("Expected no error when encoding manifest, got:", err)
+	}
+	_, err = NewChunkedManifest(crafted, nil)
+	assert.Error(t, err)
+}
+
+func TestChunkedManifestDirectoryEntry(t *testing.T) {
+	_, manifest := encryptChunked(t, make([]byte, 300), 100, keyRingTestPrivate)
+	directory := NewDirectoryManifest("dir")
+	if err := directory.AddEntry(manifest.GetFileManifest()); err != nil {
+		t.Fatal("Expected no error when adding entry, got:", err)
+	}
+
+	binary, err := manifest.GetBinary()
+	if err != nil {
+		t.Fatal("Expected no error when encoding manifest, got:", err)
+	}
+	read, err := NewChunkedManifest(binary, manifest.GetSignature())
+	if err != nil {
+		t.Fatal("Expected no error when reading manifest, got:", err)
+	}
+	assert.NoError(t, directory.VerifyEntry(read.GetFileManifest()))
+	assert.Error(t, read.GetFileManifest().AddBlock([]byte("block"), []byte("encrypted")))
+}
+
+// countingReaderAt counts the reads of the encrypted blocks.
+type countingReaderAt struct {
+	reader io.ReaderAt
+	reads  int
+}
+
+func (r *countingReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	r.reads++
+	return r.reader.ReadAt(b, off)
+}
+
+func TestChunkedDecryptReaderCache(t *testing.T) {
+	data := make([]byte, 1050)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal("Expected no error when generating data, got:", err)
+	}
+	encrypted, manifest := encryptChunked(t, data, 100, nil)
+
+	counter := &countingReaderAt{reader: bytes.NewReader(encrypted)}
+	reader, err := testSessionKey.NewChunkedDecryptReader(counter, manifest, nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error when creating chunked reader, got:", err)
+	}
+
+	// Small reads decrypt each block once
+	var decrypted bytes.Buffer
+	buf := make([]byte, 10)
+	for {
+		n, err := reader.Read(buf)
+		decrypted.Write(buf[:n])
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal("Expected no error when reading, got:", err)
+		}
+	}
+	assert.Exactly(t, data, decrypted.Bytes())
+	assert.Exactly(t, 11, counter.reads)
+}
@@ -0,0 +1,181 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	goerrors "errors"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+)
+
+const (
+	forwardingFingerprintLength = 20
+	proxyParameterLength        = 32
+)
+
+// ForwardingInstance is what a proxy needs to forward the messages encrypted
+// to an X25519 subkey of the forwarder to a subkey of the forwardee, without
+// being able to decrypt them: the proxy parameter transforms the key packets
+// for the forwardee subkey.
+type ForwardingInstance struct {
+	instance packet.ForwardingInstance
+}
+
+// NewForwardingInstance returns the forwarding instance from the fingerprints
+// of the forwarder and forwardee subkeys and the proxy parameter, as returned
+// by its getters.
+func NewForwardingInstance(forwarderFingerprint, forwardeeFingerprint, proxyParameter []byte) (*ForwardingInstance, error) {
+	if len(forwarderFingerprint) != forwardingFingerprintLength || len(forwardeeFingerprint) != forwardingFingerprintLength {
+		return nil, errors.New("gopenpgp: invalid forwarding fingerprint length")
+	}
+	if len(proxyParameter) != proxyParameterLength {
+		return nil, errors.New("gopenpgp: invalid proxy parameter length")
+	}
+	return &ForwardingInstance{packet.ForwardingInstance{
+		KeyVersion:           4,
+		ForwarderFingerprint: clone(forwarderFingerprint),
+		ForwardeeFingerprint: clone(forwardeeFingerprint),
+		ProxyParameter:       clone(proxyParameter),
+	}}, nil
+}
+
+// GetForwarderKeyID returns the key ID of the forwarder subkey.
+func (instance *ForwardingInstance) GetForwarderKeyID() uint64 {
+	return instance.instance.GetForwarderKeyId()
+}
+
+// GetForwardeeKeyID returns the key ID of the forwardee subkey.
+func (instance *ForwardingInstance) GetForwardeeKeyID() uint64 {
+	return instance.instance.GetForwardeeKeyId()
+}
+
+// GetForwarderFingerprint returns the fingerprint of the forwarder subkey.
+func (instance *ForwardingInstance) GetForwarderFingerprint() []byte {
+	return clone(instance.instance.ForwarderFingerprint)
+}
+
+// GetForwardeeFingerprint returns the fingerprint of the forwardee subkey.
+func (instance *ForwardingInstance) GetForwardeeFingerprint() []byte {
+	return clone(instance.instance.ForwardeeFingerprint)
+}
+
+// GetProxyParameter returns the proxy parameter, which must be kept as secret
+// as the keys: together with the forwardee key it decrypts the messages of the
+// forwarder.
+func (instance *ForwardingInstance) GetProxyParameter() []byte {
+	return clone(instance.instance.ProxyParameter)
+}
+
+// TransformKeyPacket transforms the public-key encrypted session key packets
+// to the forwarder subkey into packets to the forwardee subkey, which the
+// forwardee decrypts with KeyRing.DecryptSessionKey. Key packets with a
+// wildcard key ID are transformed as well, the others are dropped.
+func (instance *ForwardingInstance) TransformKeyPacket(keyPacket []byte) ([]byte, error) {
+	var transformed bytes.Buffer
+	packets := packet.NewReader(bytes.NewReader(keyPacket))
+	for {
+		p, err := packets.Next()
+		if goerrors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in reading key packet")
+		}
+
+		ek, ok := p.(*packet.EncryptedKey)
+		if !ok || ek.KeyId != instance.GetForwarderKeyID() && ek.KeyId != 0 {
+			continue
+		}
+		transformedKey, err := ek.ProxyTransform(instance.instance)
+		if err != nil {
+			if ek.KeyId == 0 {
+				continue
+			}
+			return nil, errors.Wrap(err, "gopenpgp: error in transforming key packet")
+		}
+		if err = transformedKey.Serialize(&transformed); err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in writing key packet")
+		}
+	}
+
+	if transformed.Len() == 0 {
+		return nil, errors.New("gopenpgp: no key packet encrypted to the forwarder key")
+	}
+	return transformed.Bytes(), nil
+}
+
+// Forward returns the split message with the key packets transformed for the
+// forwardee, see ForwardingInstance.TransformKeyPacket. The data packet is
+// left unchanged.
+func (msg *PGPSplitMessage) Forward(instance *ForwardingInstance) (*PGPSplitMessage, error) {
+	keyPacket, err := instance.TransformKeyPacket(msg.KeyPacket)
+	if err != nil {
+		return nil, err
+	}
+	return NewPGPSplitMessage(keyPacket, msg.DataPacket), nil
+}
+
+// ForwardingMaterial is the result of the generation of a forwardee key: the
+// key itself, for the forwardee, and a forwarding instance for each X25519
+// encryption subkey of the forwarder, for the proxy.
+type ForwardingMaterial struct {
+	forwardeeKey *Key
+	instances    []*ForwardingInstance
+}
+
+// GetForwardeeKey returns the unlocked private key of the forwardee.
+func (material *ForwardingMaterial) GetForwardeeKey() *Key {
+	return material.forwardeeKey
+}
+
+// GetInstanceCount returns the number of forwarding instances, one per
+// forwarded subkey.
+func (material *ForwardingMaterial) GetInstanceCount() int {
+	return len(material.instances)
+}
+
+// GetInstance returns the n-th forwarding instance.
+func (material *ForwardingMaterial) GetInstance(n int) (*ForwardingInstance, error) {
+	if n < 0 || n >= len(material.instances) {
+		return nil, errors.New("gopenpgp: out of bound when fetching forwarding instance")
+	}
+	return material.instances[n], nil
+}
+
+// GenerateForwardingMaterial generates a new key for the forwardee, with name
+// and email, and the forwarding instances to forward the messages encrypted to
+// the X25519 encryption subkeys of the key to it.
+// The key must be an unlocked private v4 key.
+// Each forwarded subkey gets a forwardee subkey, flagged for forwarded
+// communications and holding the fingerprint of the forwarder subkey in its
+// key derivation parameters. The forwardee key has no encryption subkey: it
+// only decrypts the key packets transformed by the proxy.
+func (key *Key) GenerateForwardingMaterial(name, email string) (*ForwardingMaterial, error) {
+	if !key.IsPrivate() {
+		return nil, errors.New("gopenpgp: forwarding requires a private key")
+	}
+	if unlocked, err := key.IsUnlocked(); err != nil || !unlocked {
+		return nil, errors.New("gopenpgp: forwarding requires an unlocked key")
+	}
+
+	config := &packet.Config{
+		Time:                                  getKeyGenerationTimeGenerator(),
+		DefaultHash:                           crypto.SHA256,
+		NonDeterministicSignaturesViaNotation: &saltNotation,
+	}
+	forwardee, forwardingInstances, err := key.entity.NewForwardingEntity(name, "", email, config, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in generating forwarding material")
+	}
+
+	instances := make([]*ForwardingInstance, 0, len(forwardingInstances))
+	for _, instance := range forwardingInstances {
+		instances = append(instances, &ForwardingInstance{instance})
+	}
+	return &ForwardingMaterial{
+		forwardeeKey: &Key{forwardee},
+		instances:    instances,
+	}, nil
+}
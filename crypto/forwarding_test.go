@@ -0,0 +1,117 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwarding(t *testing.T) {
+	forwarderKey, err := GenerateKey("forwarder", "forwarder@proton.me", "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error when generating forwarder key, got:", err)
+	}
+	material, err := forwarderKey.GenerateForwardingMaterial("forwardee", "forwardee@proton.me")
+	if err != nil {
+		t.Fatal("Expected no error when generating forwarding material, got:", err)
+	}
+	assert.Exactly(t, 1, material.GetInstanceCount())
+	instance, err := material.GetInstance(0)
+	if err != nil {
+		t.Fatal("Expected no error when getting forwarding instance, got:", err)
+	}
+
+	// The proxy may store and restore the instance
+	instance, err = NewForwardingInstance(
+		instance.GetForwarderFingerprint(),
+		instance.GetForwardeeFingerprint(),
+		instance.GetProxyParameter(),
+	)
+	if err != nil {
+		t.Fatal("Expected no error when restoring forwarding instance, got:", err)
+	}
+
+	assert.Exactly(t, forwarderKey.entity.Subkeys[0].PublicKey.Fingerprint, instance.GetForwarderFingerprint())
+
+	// The forwardee key keeps its forwardee subkey through serialization
+	armoredForwardeeKey, err := material.GetForwardeeKey().Armor()
+	if err != nil {
+		t.Fatal("Expected no error when armoring forwardee key, got:", err)
+	}
+	forwardeeKey, err := NewKeyFromArmored(armoredForwardeeKey)
+	if err != nil {
+		t.Fatal("Expected no error when reading forwardee key, got:", err)
+	}
+	forwardeeKeyRing, err := NewKeyRing(forwardeeKey)
+	if err != nil {
+		t.Fatal("Expected no error when building forwardee keyring, got:", err)
+	}
+
+	forwarderKeyRing, err := NewKeyRing(forwarderKey)
+	if err != nil {
+		t.Fatal("Expected no error when building forwarder keyring, got:", err)
+	}
+	ciphertext, err := forwarderKeyRing.Encrypt(NewPlainMessageFromString("forwarded message"), nil)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	split, err := ciphertext.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error when splitting message, got:", err)
+	}
+
+	_, err = forwardeeKeyRing.DecryptSessionKey(split.GetBinaryKeyPacket())
+	assert.Error(t, err)
+
+	forwarded, err := split.Forward(instance)
+	if err != nil {
+		t.Fatal("Expected no error when forwarding message, got:", err)
+	}
+	sk, err := forwardeeKeyRing.DecryptSessionKey(forwarded.GetBinaryKeyPacket())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting forwarded session key, got:", err)
+	}
+	decrypted, err := sk.Decrypt(forwarded.GetBinaryDataPacket())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting forwarded message, got:", err)
+	}
+	assert.Exactly(t, "forwarded message", decrypted.GetString())
+
+	// The forwardee subkey is only used for forwarded messages
+	assert.True(t, forwardeeKey.entity.Subkeys[0].Sig.FlagForward)
+	_, err = forwardeeKeyRing.Encrypt(NewPlainMessageFromString("direct message"), nil)
+	assert.Error(t, err)
+}
+
+func TestForwardingErrors(t *testing.T) {
+	_, err := keyTestRSA.GenerateForwardingMaterial("forwardee", "forwardee@proton.me")
+	assert.Error(t, err)
+
+	_, err = NewForwardingInstance(make([]byte, 20), make([]byte, 20), []byte{1, 2, 3})
+	assert.Error(t, err)
+
+	forwarderKey, err := GenerateKey("forwarder", "forwarder@proton.me", "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error when generating forwarder key, got:", err)
+	}
+	material, err := forwarderKey.GenerateForwardingMaterial("forwardee", "forwardee@proton.me")
+	if err != nil {
+		t.Fatal("Expected no error when generating forwarding material, got:", err)
+	}
+	instance, err := material.GetInstance(0)
+	if err != nil {
+		t.Fatal("Expected no error when getting forwarding instance, got:", err)
+	}
+
+	// Messages to other keys can't be forwarded
+	ciphertext, err := keyRingTestPublic.Encrypt(NewPlainMessageFromString("not forwarded"), nil)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	split, err := ciphertext.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error when splitting message, got:", err)
+	}
+	_, err = split.Forward(instance)
+	assert.Error(t, err)
+}
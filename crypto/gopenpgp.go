@@ -8,6 +8,7 @@ import "sync"
 type GopenPGP struct {
 	latestServerTime int64
 	generationOffset int64
+	decryptionLimits DecryptionLimits
 	lock             *sync.RWMutex
 }
 
@@ -5,6 +5,7 @@ import (
 	"crypto"
 	"crypto/sha256"
 	"encoding/hex"
+	goerrors "errors"
 	"fmt"
 	"io"
 	"math/big"
@@ -19,6 +20,10 @@ import (
 	packet "github.com/ProtonMail/go-crypto/openpgp/packet"
 )
 
+// gnuDummyS2K is the secret part of a key packet without secret key material,
+// using the GNU-dummy S2K extension (S2K mode 101, protection mode 1).
+var gnuDummyS2K = []byte{0xff, 0x00, 0x65, 0x00, 'G', 'N', 'U', 0x01}
+
 // Key contains a single private or public key.
 type Key struct {
 	// PGP entities in this keyring.
@@ -96,48 +101,7 @@ func (key *Key) Copy() (*Key, error) {
 
 // Lock locks a copy of the key.
 func (key *Key) Lock(passphrase []byte) (*Key, error) {
-	unlocked, err := key.IsUnlocked()
-	if err != nil {
-		return nil, err
-	}
-
-	if !unlocked {
-		return nil, errors.New("gopenpgp: key is not unlocked")
-	}
-
-	lockedKey, err := key.Copy()
-	if err != nil {
-		return nil, err
-	}
-
-	if passphrase == nil {
-		return lockedKey, nil
-	}
-
-	if lockedKey.entity.PrivateKey != nil && !lockedKey.entity.PrivateKey.Dummy() {
-		err = lockedKey.entity.PrivateKey.Encrypt(passphrase)
-		if err != nil {
-			return nil, errors.Wrap(err, "gopenpgp: error in locking key")
-		}
-	}
-
-	for _, sub := range lockedKey.entity.Subkeys {
-		if sub.PrivateKey != nil && !sub.PrivateKey.Dummy() {
-			if err := sub.PrivateKey.Encrypt(passphrase); err != nil {
-				return nil, errors.Wrap(err, "gopenpgp: error in locking sub key")
-			}
-		}
-	}
-
-	locked, err := lockedKey.IsLocked()
-	if err != nil {
-		return nil, err
-	}
-	if !locked {
-		return nil, errors.New("gopenpgp: unable to lock key")
-	}
-
-	return lockedKey, nil
+	return key.LockWithOptions(passphrase, nil)
 }
 
 // Unlock unlocks a copy of the key.
@@ -148,7 +112,7 @@ func (key *Key) Unlock(passphrase []byte) (*Key, error) {
 	}
 
 	if !isLocked {
-		if passphrase == nil {
+		if passphrase == nil || !key.hasSecretMaterial() {
 			return key.Copy()
 		}
 		return nil, errors.New("gopenpgp: key is not locked")
@@ -159,19 +123,10 @@ func (key *Key) Unlock(passphrase []byte) (*Key, error) {
 		return nil, err
 	}
 
-	if unlockedKey.entity.PrivateKey != nil && !unlockedKey.entity.PrivateKey.Dummy() {
-		err = unlockedKey.entity.PrivateKey.Decrypt(passphrase)
-		if err != nil {
-			return nil, errors.Wrap(err, "gopenpgp: error in unlocking key")
-		}
-	}
-
-	for _, sub := range unlockedKey.entity.Subkeys {
-		if sub.PrivateKey != nil && !sub.PrivateKey.Dummy() {
-			if err := sub.PrivateKey.Decrypt(passphrase); err != nil {
-				return nil, errors.Wrap(err, "gopenpgp: error in unlocking sub key")
-			}
-		}
+	// The key derived from the passphrase is computed once for the primary key
+	// and all subkeys locked with the same S2K parameters.
+	if err = unlockedKey.entity.DecryptPrivateKeys(passphrase); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in unlocking key")
 	}
 
 	isUnlocked, err := unlockedKey.IsUnlocked()
@@ -305,7 +260,7 @@ func (key *Key) IsLocked() (bool, error) {
 		}
 	}
 
-	if key.entity.PrivateKey.Encrypted {
+	if !key.entity.PrivateKey.Dummy() && key.entity.PrivateKey.Encrypted {
 		encryptedKeys++
 	}
 
@@ -326,7 +281,7 @@ func (key *Key) IsUnlocked() (bool, error) {
 		}
 	}
 
-	if key.entity.PrivateKey.Encrypted {
+	if !key.entity.PrivateKey.Dummy() && key.entity.PrivateKey.Encrypted {
 		encryptedKeys++
 	}
 
@@ -394,8 +349,84 @@ func (key *Key) ToPublic() (publicKey *Key, err error) {
 	return
 }
 
+// ToSecretSubkeysOnly returns a copy of the private key in which the secret
+// key material of the primary key is replaced by a GNU-dummy stub, so that
+// only the subkeys can be used, e.g. to keep the certifying primary key
+// offline. Only version 4 keys are supported.
+func (key *Key) ToSecretSubkeysOnly() (*Key, error) {
+	if !key.IsPrivate() {
+		return nil, errors.New("gopenpgp: key is not private")
+	}
+	// The stub follows the version 4 secret key packet layout
+	if key.entity.PrimaryKey.Version != 4 {
+		return nil, errors.New("gopenpgp: GNU-dummy primary key stubs only support version 4 keys")
+	}
+
+	serialized, err := key.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	var publicKeyPacket bytes.Buffer
+	if err = key.entity.PrimaryKey.Serialize(&publicKeyPacket); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in serializing public key")
+	}
+	publicKeyBody, err := packet.NewOpaqueReader(&publicKeyPacket).Next()
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in reading public key")
+	}
+
+	var stubbed bytes.Buffer
+	packets := packet.NewOpaqueReader(bytes.NewReader(serialized))
+	for first := true; ; first = false {
+		p, err := packets.Next()
+		if goerrors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in reading key packets")
+		}
+
+		if first {
+			p.Contents = append(publicKeyBody.Contents, gnuDummyS2K...)
+		}
+
+		if err = p.Serialize(&stubbed); err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in serializing key packets")
+		}
+	}
+
+	return NewKey(stubbed.Bytes())
+}
+
+// HasPrimaryKeyStub returns true if the key is private, and the secret key
+// material of its primary key is replaced by a GNU-dummy stub.
+func (key *Key) HasPrimaryKeyStub() bool {
+	return key.IsPrivate() && key.entity.PrivateKey.Dummy()
+}
+
 // --- Internal methods
 
+// hasSecretMaterial checks whether the key holds secret key material that is
+// not a GNU-dummy stub, for the primary key or any subkey.
+func (key *Key) hasSecretMaterial() bool {
+	if key.entity.PrivateKey == nil {
+		return false
+	}
+
+	if !key.entity.PrivateKey.Dummy() {
+		return true
+	}
+
+	for _, sub := range key.entity.Subkeys {
+		if sub.PrivateKey != nil && !sub.PrivateKey.Dummy() {
+			return true
+		}
+	}
+
+	return false
+}
+
 // getSHA256FingerprintBytes computes the SHA256 fingerprint of a public key
 // object.
 func getSHA256FingerprintBytes(pk *packet.PublicKey) []byte {
@@ -438,24 +469,7 @@ func generateKey(
 	bits int,
 	prime1, prime2, prime3, prime4 []byte,
 ) (*Key, error) {
-	if len(email) == 0 && len(name) == 0 {
-		return nil, errors.New("gopenpgp: neither name nor email set.")
-	}
-
-	comments := ""
-
-	cfg := &packet.Config{
-		Algorithm:              packet.PubKeyAlgoRSA,
-		RSABits:                bits,
-		Time:                   getKeyGenerationTimeGenerator(),
-		DefaultHash:            crypto.SHA256,
-		DefaultCipher:          packet.CipherAES256,
-		DefaultCompressionAlgo: packet.CompressionZLIB,
-	}
-
-	if keyType == "x25519" {
-		cfg.Algorithm = packet.PubKeyAlgoEdDSA
-	}
+	cfg := getKeyGenerationConfig(keyType, bits)
 
 	if prime1 != nil && prime2 != nil && prime3 != nil && prime4 != nil {
 		var bigPrimes [4]*big.Int
@@ -471,6 +485,36 @@ func generateKey(
 		cfg.RSAPrimes = bigPrimes[:]
 	}
 
+	return generateKeyWithConfig(name, email, cfg)
+}
+
+// getKeyGenerationConfig returns the configuration to generate a key of the
+// given keyType and bits.
+func getKeyGenerationConfig(keyType string, bits int) *packet.Config {
+	cfg := &packet.Config{
+		Algorithm:                             packet.PubKeyAlgoRSA,
+		RSABits:                               bits,
+		Time:                                  getKeyGenerationTimeGenerator(),
+		DefaultHash:                           crypto.SHA256,
+		DefaultCipher:                         packet.CipherAES256,
+		DefaultCompressionAlgo:                packet.CompressionZLIB,
+		NonDeterministicSignaturesViaNotation: &saltNotation,
+	}
+
+	if keyType == "x25519" {
+		cfg.Algorithm = packet.PubKeyAlgoEdDSA
+	}
+
+	return cfg
+}
+
+func generateKeyWithConfig(name, email string, cfg *packet.Config) (*Key, error) {
+	if len(email) == 0 && len(name) == 0 {
+		return nil, errors.New("gopenpgp: neither name nor email set.")
+	}
+
+	comments := ""
+
 	newEntity, err := openpgp.NewEntity(name, comments, email, cfg)
 	if err != nil {
 		return nil, errors.Wrap(err, "gopengpp: error in encoding new entity")
@@ -0,0 +1,388 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"math"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+// Certification is a third-party certification signature over one of the
+// user IDs of a key.
+type Certification struct {
+	// UserID is the certified user ID, e.g. "Name <email@example.com>".
+	UserID string
+	// Level is the certification level, see constants.CertificationGeneric
+	// to constants.CertificationPositive.
+	Level int
+	// SignerKeyID is the ID of the key that issued the certification.
+	SignerKeyID uint64
+	// SignerFingerprint is the hex encoded fingerprint of the key that issued
+	// the certification, or an empty string if the signature does not
+	// include it.
+	SignerFingerprint string
+	// CreationTime is the unix time at which the certification was made.
+	CreationTime int64
+	// ExpirationTime is the unix time at which the certification expires,
+	// or 0 if it does not expire.
+	ExpirationTime int64
+	// TrustDepth is the trust depth of a trust signature, or 0 for a plain
+	// certification. A depth of 1 makes the certified key a trusted
+	// introducer, and greater depths make it a meta-introducer.
+	TrustDepth int
+	// TrustAmount is the amount of trust of a trust signature, where 120
+	// means complete trust and 60 partial trust.
+	TrustAmount int
+	// TrustRegex is the regular expression restricting the user IDs that the
+	// certified key is trusted to introduce, or an empty string.
+	TrustRegex string
+
+	signature *packet.Signature
+}
+
+// GetHexSignerKeyID returns the ID of the certifying key, hex encoded as a
+// string.
+func (certification *Certification) GetHexSignerKeyID() string {
+	return keyIDToHex(certification.SignerKeyID)
+}
+
+// CertifyKey certifies the given user ID of the target key with the first
+// unlocked private key of the keyring, and returns a copy of the target key
+// that includes the new certification.
+// The level must be one of constants.CertificationGeneric to
+// constants.CertificationPositive. The certification expires at the unix
+// time expiry, or never if expiry is 0.
+func (keyRing *KeyRing) CertifyKey(target *Key, userID string, level int, expiry int64) (*Key, error) {
+	return keyRing.CertifyKeyWithTrust(target, userID, level, expiry, 0, 0, "")
+}
+
+// CertifyKeyWithTrust certifies the given user ID of the target key like
+// CertifyKey, and additionally makes it a trust signature with the given
+// trust depth and amount.
+// A depth of 0 creates a plain certification, a depth of 1 designates the
+// target as a trusted introducer, and greater depths as a meta-introducer.
+// The amount is usually 120 for complete trust and 60 for partial trust.
+// If regex is not empty, the target is only trusted to introduce user IDs
+// matching it.
+func (keyRing *KeyRing) CertifyKeyWithTrust(
+	target *Key,
+	userID string,
+	level int,
+	expiry int64,
+	depth, amount int,
+	regex string,
+) (*Key, error) {
+	if depth < 0 || depth > 255 || amount < 0 || amount > 255 {
+		return nil, errors.New("gopenpgp: invalid trust depth or amount")
+	}
+	if depth == 0 && regex != "" {
+		return nil, errors.New("gopenpgp: a trust regular expression requires a trust depth")
+	}
+	if regex != "" {
+		if _, err := regexp.Compile(regex); err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: invalid trust regular expression")
+		}
+	}
+
+	if level < constants.CertificationGeneric || level > constants.CertificationPositive {
+		return nil, errors.New("gopenpgp: invalid certification level")
+	}
+
+	signEntity, err := keyRing.getSigningEntity()
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(signEntity.PrimaryKey.Fingerprint, target.entity.PrimaryKey.Fingerprint) {
+		return nil, errors.New("gopenpgp: a key cannot certify itself")
+	}
+
+	config := &packet.Config{
+		DefaultHash:                           crypto.SHA512,
+		Time:                                  getTimeGenerator(),
+		NonDeterministicSignaturesViaNotation: &saltNotation,
+	}
+	now := config.Now()
+	certificationKey, ok := signEntity.CertificationKey(now)
+	if !ok {
+		return nil, errors.New("gopenpgp: no valid certification key found")
+	}
+	if certificationKey.PrivateKey == nil || certificationKey.PrivateKey.Dummy() {
+		return nil, errors.New("gopenpgp: certification key has no secret key material")
+	}
+	if certificationKey.PrivateKey.Encrypted {
+		return nil, errors.New("gopenpgp: certification key is not unlocked")
+	}
+
+	// Without expiry, the lifetime is left unset, and no lifetime subpacket
+	// is written
+	var lifetime *uint32
+	if expiry != 0 {
+		if expiry <= now.Unix() {
+			return nil, errors.New("gopenpgp: certification expiry must be in the future")
+		}
+		if expiry-now.Unix() > math.MaxUint32 {
+			return nil, errors.New("gopenpgp: certification expiry is too far in the future")
+		}
+		secs := uint32(expiry - now.Unix())
+		lifetime = &secs
+	}
+
+	certifiedKey, err := target.Copy()
+	if err != nil {
+		return nil, err
+	}
+
+	identity, ok := certifiedKey.entity.Identities[userID]
+	if !ok {
+		return nil, errors.New("gopenpgp: user ID not found in target key")
+	}
+
+	sig := &packet.Signature{
+		Version:           certificationKey.PublicKey.Version,
+		SigType:           packet.SigTypeGenericCert + packet.SignatureType(level),
+		PubKeyAlgo:        certificationKey.PublicKey.PubKeyAlgo,
+		Hash:              getPreferredHash(signEntity, config),
+		CreationTime:      now,
+		IssuerKeyId:       &certificationKey.PublicKey.KeyId,
+		IssuerFingerprint: certificationKey.PublicKey.Fingerprint,
+		SigLifetimeSecs:   lifetime,
+	}
+
+	if depth > 0 {
+		sig.TrustLevel = packet.TrustLevel(depth)
+		sig.TrustAmount = packet.TrustAmount(amount)
+		if regex != "" {
+			sig.TrustRegularExpression = &regex
+		}
+	}
+
+	err = sig.SignUserId(userID, certifiedKey.entity.PrimaryKey, certificationKey.PrivateKey, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in signing user ID")
+	}
+
+	identity.Signatures = append(identity.Signatures, sig)
+	return certifiedKey, nil
+}
+
+// GetCertifications returns the third-party certifications over the user IDs
+// of the key, without verifying them.
+func (key *Key) GetCertifications() []*Certification {
+	var certifications []*Certification
+	for _, userID := range getSortedUserIDs(key.entity) {
+		for _, sig := range key.entity.Identities[userID].Signatures {
+			if isThirdPartyCertification(key.entity, sig) {
+				certifications = append(certifications, newCertification(userID, sig))
+			}
+		}
+	}
+	return certifications
+}
+
+// VerifyCertifications returns the third-party certifications over the user
+// IDs of the key which were issued by a key in one of the certifiers keyrings,
+// and are valid at the unix time verifyTime.
+// A certification is valid if its signature verifies, and it has not been
+// revoked by its issuer. If verifyTime is not 0, the certification and the
+// certifying key must also not be expired at that time.
+func (key *Key) VerifyCertifications(certifiers []*KeyRing, verifyTime int64) ([]*Certification, error) {
+	if len(certifiers) == 0 {
+		return nil, errors.New("gopenpgp: no certifier keys provided")
+	}
+
+	var certifierEntities openpgp.EntityList
+	for _, certifier := range certifiers {
+		certifierEntities = append(certifierEntities, certifier.entities...)
+	}
+
+	var certifications []*Certification
+	for _, userID := range getSortedUserIDs(key.entity) {
+		identity := key.entity.Identities[userID]
+		for _, sig := range identity.Signatures {
+			if !isThirdPartyCertification(key.entity, sig) {
+				continue
+			}
+
+			signer := verifyCertificationSignature(certifierEntities, key.entity.PrimaryKey, userID, sig, verifyTime)
+			if signer == nil {
+				continue
+			}
+
+			if isCertificationRevoked(signer, key.entity.PrimaryKey, identity, sig, verifyTime) {
+				continue
+			}
+
+			certifications = append(certifications, newCertification(userID, sig))
+		}
+	}
+
+	return certifications, nil
+}
+
+// --- Internal methods
+
+// getPreferredHash returns the first hash preferred by the signer that is
+// allowed for signatures, or the default hash of the config.
+func getPreferredHash(signEntity *openpgp.Entity, config *packet.Config) crypto.Hash {
+	if identity := signEntity.PrimaryIdentity(); identity != nil && identity.SelfSignature != nil {
+		for _, id := range identity.SelfSignature.PreferredHash {
+			hash, ok := openpgp.HashIdToHash(id)
+			if !ok || !hash.Available() {
+				continue
+			}
+			for _, allowed := range allowedHashes {
+				if hash == allowed {
+					return hash
+				}
+			}
+		}
+	}
+	return config.Hash()
+}
+
+// getSortedUserIDs returns the user IDs of the entity in a deterministic order.
+func getSortedUserIDs(entity *openpgp.Entity) []string {
+	userIDs := make([]string, 0, len(entity.Identities))
+	for userID := range entity.Identities {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+	return userIDs
+}
+
+func newCertification(userID string, sig *packet.Signature) *Certification {
+	certification := &Certification{
+		UserID:       userID,
+		Level:        int(sig.SigType - packet.SigTypeGenericCert),
+		CreationTime: sig.CreationTime.Unix(),
+		signature:    sig,
+	}
+
+	if sig.IssuerKeyId != nil {
+		certification.SignerKeyID = *sig.IssuerKeyId
+	}
+
+	if sig.IssuerFingerprint != nil {
+		certification.SignerFingerprint = hex.EncodeToString(sig.IssuerFingerprint)
+	}
+
+	if sig.SigLifetimeSecs != nil && *sig.SigLifetimeSecs != 0 {
+		certification.ExpirationTime = certification.CreationTime + int64(*sig.SigLifetimeSecs)
+	}
+
+	if sig.TrustLevel > 0 {
+		certification.TrustDepth = int(sig.TrustLevel)
+		certification.TrustAmount = int(sig.TrustAmount)
+		if sig.TrustRegularExpression != nil {
+			certification.TrustRegex = *sig.TrustRegularExpression
+		}
+	}
+
+	return certification
+}
+
+// isThirdPartyCertification checks whether sig is a certification over a
+// user ID of entity, made by another key.
+func isThirdPartyCertification(entity *openpgp.Entity, sig *packet.Signature) bool {
+	if sig.SigType < packet.SigTypeGenericCert || sig.SigType > packet.SigTypePositiveCert {
+		return false
+	}
+	return !sig.CheckKeyIdOrFingerprint(entity.PrimaryKey)
+}
+
+// getCertifierKeys returns the keys of certifiers that may have issued sig.
+// If verifyTime is not 0, only keys valid for certification at that time are
+// returned.
+func getCertifierKeys(certifiers openpgp.EntityList, sig *packet.Signature, verifyTime int64) []openpgp.Key {
+	if sig.IssuerKeyId == nil {
+		return nil
+	}
+
+	var keys []openpgp.Key
+	for _, candidate := range certifiers.KeysById(*sig.IssuerKeyId) {
+		if !candidate.PublicKey.CanSign() {
+			continue
+		}
+
+		if verifyTime != 0 {
+			key, ok := candidate.Entity.CertificationKeyById(time.Unix(verifyTime, 0), *sig.IssuerKeyId)
+			if !ok {
+				continue
+			}
+			candidate = key
+		} else if candidate.PublicKey != candidate.Entity.PrimaryKey && !candidate.SelfSignature.FlagCertify {
+			continue
+		}
+
+		if sig.IssuerFingerprint != nil && !bytes.Equal(sig.IssuerFingerprint, candidate.PublicKey.Fingerprint) {
+			continue
+		}
+
+		keys = append(keys, candidate)
+	}
+	return keys
+}
+
+// verifyCertificationSignature verifies the certification sig over the given
+// user ID of the certified key, and returns the certifier key that issued it,
+// or nil if the certification is not valid.
+func verifyCertificationSignature(
+	certifiers openpgp.EntityList,
+	certified *packet.PublicKey,
+	userID string,
+	sig *packet.Signature,
+	verifyTime int64,
+) *openpgp.Key {
+	if verifyTime != 0 && sig.SigExpired(time.Unix(verifyTime, 0)) {
+		return nil
+	}
+
+	for _, candidate := range getCertifierKeys(certifiers, sig, verifyTime) {
+		if candidate.PublicKey.VerifyUserIdSignature(userID, certified, sig) == nil {
+			candidate := candidate
+			return &candidate
+		}
+	}
+	return nil
+}
+
+// isCertificationRevoked checks whether the certification sig over the given
+// identity has been revoked by its issuer.
+func isCertificationRevoked(
+	signer *openpgp.Key,
+	certified *packet.PublicKey,
+	identity *openpgp.Identity,
+	sig *packet.Signature,
+	verifyTime int64,
+) bool {
+	for _, revocation := range identity.Signatures {
+		if revocation.SigType != packet.SigTypeCertificationRevocation {
+			continue
+		}
+		if !revocation.CheckKeyIdOrFingerprint(signer.Entity.PrimaryKey) &&
+			!revocation.CheckKeyIdOrFingerprint(signer.PublicKey) {
+			continue
+		}
+		if revocation.CreationTime.Before(sig.CreationTime) {
+			continue
+		}
+		if verifyTime != 0 && revocation.CreationTime.After(time.Unix(verifyTime, 0)) {
+			continue
+		}
+		if signer.PublicKey.VerifyUserIdSignature(identity.Name, certified, revocation) == nil ||
+			signer.Entity.PrimaryKey.VerifyUserIdSignature(identity.Name, certified, revocation) == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package crypto
+
+import (
+	"crypto"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+const certificationTestUserID = "Employee <employee@example.com>"
+
+func generateCertificationTestKeys(t *testing.T) (*KeyRing, *Key) {
+	authority, err := GenerateKey("Authority", "authority@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatal("Cannot generate authority key:", err)
+	}
+
+	authorityKeyRing, err := NewKeyRing(authority)
+	if err != nil {
+		t.Fatal("Cannot create authority keyring:", err)
+	}
+
+	employee, err := GenerateKey("Employee", "employee@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatal("Cannot generate employee key:", err)
+	}
+
+	employeePublic, err := employee.ToPublic()
+	if err != nil {
+		t.Fatal("Cannot extract employee public key:", err)
+	}
+
+	return authorityKeyRing, employeePublic
+}
+
+func TestCertifyKey(t *testing.T) {
+	authorityKeyRing, employee := generateCertificationTestKeys(t)
+
+	certified, err := authorityKeyRing.CertifyKey(employee, certificationTestUserID, constants.CertificationPositive, 0)
+	if err != nil {
+		t.Fatal("Expected no error while certifying key, got:", err)
+	}
+
+	assert.Len(t, employee.GetCertifications(), 0)
+	signatures := certified.entity.Identities[certificationTestUserID].Signatures
+	assert.Nil(t, signatures[len(signatures)-1].SigLifetimeSecs)
+
+	armored, err := certified.GetArmoredPublicKey()
+	if err != nil {
+		t.Fatal("Expected no error while armoring certified key, got:", err)
+	}
+
+	parsed, err := NewKeyFromArmored(armored)
+	if err != nil {
+		t.Fatal("Expected no error while parsing certified key, got:", err)
+	}
+
+	authority, err := authorityKeyRing.GetKey(0)
+	if err != nil {
+		t.Fatal("Expected no error while getting authority key, got:", err)
+	}
+
+	certifications := parsed.GetCertifications()
+	assert.Len(t, certifications, 1)
+	assert.Exactly(t, certificationTestUserID, certifications[0].UserID)
+	assert.Exactly(t, constants.CertificationPositive, certifications[0].Level)
+	assert.Exactly(t, authority.GetKeyID(), certifications[0].SignerKeyID)
+	assert.Exactly(t, authority.GetHexKeyID(), certifications[0].GetHexSignerKeyID())
+	assert.Exactly(t, authority.GetFingerprint(), certifications[0].SignerFingerprint)
+	assert.Exactly(t, GetUnixTime(), certifications[0].CreationTime)
+	assert.Exactly(t, int64(0), certifications[0].ExpirationTime)
+
+	preferredHash, _ := openpgp.HashIdToHash(authority.entity.PrimaryIdentity().SelfSignature.PreferredHash[0])
+	for _, sig := range parsed.entity.Identities[certificationTestUserID].Signatures {
+		if sig.IssuerKeyId != nil && *sig.IssuerKeyId == authority.GetKeyID() {
+			assert.Exactly(t, preferredHash, sig.Hash)
+		}
+	}
+
+	verified, err := parsed.VerifyCertifications([]*KeyRing{keyRingTestPublic, authorityKeyRing}, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error while verifying certifications, got:", err)
+	}
+	assert.Len(t, verified, 1)
+
+	verified, err = parsed.VerifyCertifications([]*KeyRing{keyRingTestPublic}, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error while verifying certifications, got:", err)
+	}
+	assert.Len(t, verified, 0)
+
+	_, err = parsed.VerifyCertifications(nil, GetUnixTime())
+	assert.Error(t, err)
+}
+
+func TestCertifyKeyErrors(t *testing.T) {
+	authorityKeyRing, employee := generateCertificationTestKeys(t)
+
+	_, err := authorityKeyRing.CertifyKey(employee, "Unknown <unknown@example.com>", constants.CertificationGeneric, 0)
+	assert.Error(t, err)
+
+	_, err = authorityKeyRing.CertifyKey(employee, certificationTestUserID, 4, 0)
+	assert.Error(t, err)
+
+	_, err = authorityKeyRing.CertifyKey(employee, certificationTestUserID, constants.CertificationGeneric, GetUnixTime()-1)
+	assert.Error(t, err)
+
+	_, err = authorityKeyRing.CertifyKey(employee, certificationTestUserID, constants.CertificationGeneric, GetUnixTime()+1<<33)
+	assert.Error(t, err)
+
+	authority, err := authorityKeyRing.GetKey(0)
+	if err != nil {
+		t.Fatal("Expected no error while getting authority key, got:", err)
+	}
+	_, err = authorityKeyRing.CertifyKey(authority, "Authority <authority@example.com>", constants.CertificationGeneric, 0)
+	assert.Error(t, err)
+
+	_, err = keyRingTestPublic.CertifyKey(employee, certificationTestUserID, constants.CertificationGeneric, 0)
+	assert.Error(t, err)
+}
+
+func TestVerifyCertificationExpiration(t *testing.T) {
+	authorityKeyRing, employee := generateCertificationTestKeys(t)
+
+	expiry := GetUnixTime() + 3600
+	certified, err := authorityKeyRing.CertifyKey(employee, certificationTestUserID, constants.CertificationCasual, expiry)
+	if err != nil {
+		t.Fatal("Expected no error while certifying key, got:", err)
+	}
+
+	certifications := certified.GetCertifications()
+	assert.Len(t, certifications, 1)
+	assert.Exactly(t, expiry, certifications[0].ExpirationTime)
+	assert.Exactly(t, constants.CertificationCasual, certifications[0].Level)
+
+	verified, err := certified.VerifyCertifications([]*KeyRing{authorityKeyRing}, expiry-1)
+	if err != nil {
+		t.Fatal("Expected no error while verifying certifications, got:", err)
+	}
+	assert.Len(t, verified, 1)
+
+	verified, err = certified.VerifyCertifications([]*KeyRing{authorityKeyRing}, expiry+1)
+	if err != nil {
+		t.Fatal("Expected no error while verifying certifications, got:", err)
+	}
+	assert.Len(t, verified, 0)
+
+	verified, err = certified.VerifyCertifications([]*KeyRing{authorityKeyRing}, 0)
+	if err != nil {
+		t.Fatal("Expected no error while verifying certifications, got:", err)
+	}
+	assert.Len(t, verified, 1)
+}
+
+func TestVerifyCertificationRevoked(t *testing.T) {
+	authorityKeyRing, employee := generateCertificationTestKeys(t)
+
+	certified, err := authorityKeyRing.CertifyKey(employee, certificationTestUserID, constants.CertificationGeneric, 0)
+	if err != nil {
+		t.Fatal("Expected no error while certifying key, got:", err)
+	}
+
+	authority := authorityKeyRing.entities[0]
+	revocation := &packet.Signature{
+		Version:           authority.PrimaryKey.Version,
+		SigType:           packet.SigTypeCertificationRevocation,
+		PubKeyAlgo:        authority.PrimaryKey.PubKeyAlgo,
+		Hash:              crypto.SHA512,
+		CreationTime:      getNow(),
+		IssuerKeyId:       &authority.PrimaryKey.KeyId,
+		IssuerFingerprint: authority.PrimaryKey.Fingerprint,
+	}
+	identity := certified.entity.Identities[certificationTestUserID]
+	err = revocation.SignUserId(certificationTestUserID, certified.entity.PrimaryKey, authority.PrivateKey, nil)
+	if err != nil {
+		t.Fatal("Expected no error while revoking certification, got:", err)
+	}
+	identity.Signatures = append(identity.Signatures, revocation)
+
+	assert.Len(t, certified.GetCertifications(), 1)
+
+	verified, err := certified.VerifyCertifications([]*KeyRing{authorityKeyRing}, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error while verifying certifications, got:", err)
+	}
+	assert.Len(t, verified, 0)
+}
@@ -0,0 +1,104 @@
+package crypto
+
+import (
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// Clean returns a copy of the key without superseded self-signatures, without
+// the subkeys that are expired, and without third-party certifications, except
+// the valid ones issued by a key in one of the keep keyrings. Revoked subkeys
+// are kept with their revocations, so that the revocations keep propagating.
+// Subkeys of private keys are always kept, as they may still be needed to
+// decrypt older messages.
+func (key *Key) Clean(keep []*KeyRing) (*Key, error) {
+	return key.clean(keep, false)
+}
+
+// Minimize returns a cleaned copy of the key, like Clean without keeping any
+// third-party certification. If primaryUserIDOnly is set, the user IDs other
+// than the primary one are dropped as well.
+func (key *Key) Minimize(primaryUserIDOnly bool) (*Key, error) {
+	return key.clean(nil, primaryUserIDOnly)
+}
+
+// --- Internal methods
+
+func (key *Key) clean(keep []*KeyRing, primaryOnly bool) (*Key, error) {
+	cleaned, err := key.Copy()
+	if err != nil {
+		return nil, err
+	}
+
+	var certifiers openpgp.EntityList
+	for _, keyRing := range keep {
+		certifiers = append(certifiers, keyRing.entities...)
+	}
+
+	entity := cleaned.entity
+	// Version 6 keys may have no user ID, and then no primary one
+	if primary := entity.PrimaryIdentity(); primaryOnly && primary != nil {
+		entity.Identities = map[string]*openpgp.Identity{primary.Name: primary}
+	}
+
+	for userID, identity := range entity.Identities {
+		identity.Signatures = cleanIdentitySignatures(entity, certifiers, userID, identity)
+	}
+
+	if entity.PrivateKey == nil {
+		now := getNow()
+		subkeys := entity.Subkeys[:0]
+		for _, subkey := range entity.Subkeys {
+			if !subkey.Revoked(now) &&
+				(subkey.PublicKey.KeyExpired(subkey.Sig, now) || subkey.Sig.SigExpired(now)) {
+				continue
+			}
+			subkeys = append(subkeys, subkey)
+		}
+		entity.Subkeys = subkeys
+	}
+
+	return cleaned.Copy()
+}
+
+// cleanIdentitySignatures returns the signatures of the identity to keep: its
+// current self-signature, its self-revocations, and the certifications issued
+// by certifiers with their revocations.
+func cleanIdentitySignatures(
+	entity *openpgp.Entity,
+	certifiers openpgp.EntityList,
+	userID string,
+	identity *openpgp.Identity,
+) []*packet.Signature {
+	signatures := []*packet.Signature{identity.SelfSignature}
+	signatures = append(signatures, identity.Revocations...)
+
+	if len(certifiers) == 0 {
+		return signatures
+	}
+
+	for _, sig := range identity.Signatures {
+		if !isThirdPartyCertification(entity, sig) {
+			continue
+		}
+
+		signer := verifyCertificationSignature(certifiers, entity.PrimaryKey, userID, sig, 0)
+		if signer == nil {
+			continue
+		}
+		signatures = append(signatures, sig)
+
+		for _, revocation := range identity.Signatures {
+			if revocation.SigType != packet.SigTypeCertificationRevocation ||
+				revocation.CheckKeyIdOrFingerprint(entity.PrimaryKey) {
+				continue
+			}
+			if revocation.CheckKeyIdOrFingerprint(signer.PublicKey) &&
+				signer.PublicKey.VerifyUserIdSignature(userID, entity.PrimaryKey, revocation) == nil {
+				signatures = appendSignature(signatures, revocation)
+			}
+		}
+	}
+
+	return signatures
+}
@@ -0,0 +1,139 @@
+package crypto
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+func TestKeyCleanAndMinimize(t *testing.T) {
+	private, err := GenerateKey("Contact", "contact@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatal("Cannot generate key:", err)
+	}
+
+	config := &packet.Config{Time: getTimeGenerator()}
+	if err = private.entity.AddUserId("Contact", "", "contact@example.org", config); err != nil {
+		t.Fatal("Cannot add user ID:", err)
+	}
+	if err = private.entity.AddEncryptionSubkey(config); err != nil {
+		t.Fatal("Cannot add subkey:", err)
+	}
+	err = private.entity.RevokeSubkey(&private.entity.Subkeys[0], packet.KeySuperseded, "", config)
+	if err != nil {
+		t.Fatal("Cannot revoke subkey:", err)
+	}
+
+	// Add a superseded self-signature
+	identity := private.entity.Identities["Contact <contact@example.com>"]
+	superseded := *identity.SelfSignature
+	superseded.CreationTime = identity.SelfSignature.CreationTime.Add(-time.Hour)
+	err = superseded.SignUserId(identity.Name, private.entity.PrimaryKey, private.entity.PrivateKey, nil)
+	if err != nil {
+		t.Fatal("Cannot sign user ID:", err)
+	}
+	identity.Signatures = append(identity.Signatures, &superseded)
+
+	contact, err := private.ToPublic()
+	if err != nil {
+		t.Fatal("Cannot extract public key:", err)
+	}
+
+	keptKeyRing, _ := generateTrustTestKey(t, "Kept", "kept@example.com")
+	droppedKeyRing, _ := generateTrustTestKey(t, "Dropped", "dropped@example.com")
+	for _, certifier := range []*KeyRing{keptKeyRing, droppedKeyRing} {
+		contact, err = certifier.CertifyKey(contact, "Contact <contact@example.com>", constants.CertificationGeneric, 0)
+		if err != nil {
+			t.Fatal("Cannot certify key:", err)
+		}
+	}
+
+	assert.Len(t, contact.GetCertifications(), 2)
+	assert.Len(t, contact.entity.Subkeys, 2)
+
+	cleaned, err := contact.Clean([]*KeyRing{keptKeyRing})
+	if err != nil {
+		t.Fatal("Expected no error while cleaning key, got:", err)
+	}
+
+	certifications := cleaned.GetCertifications()
+	assert.Len(t, certifications, 1)
+	assert.Exactly(t, keptKeyRing.GetKeyIDs()[0], certifications[0].SignerKeyID)
+	assert.Len(t, cleaned.entity.Identities, 2)
+	assert.Len(t, cleaned.entity.Identities["Contact <contact@example.com>"].Signatures, 2)
+	assert.Len(t, cleaned.entity.Subkeys, 2)
+	assert.Len(t, cleaned.entity.Subkeys[0].Revocations, 1)
+	assert.True(t, cleaned.CanEncrypt())
+
+	minimizedAllUserIDs, err := contact.Minimize(false)
+	if err != nil {
+		t.Fatal("Expected no error while minimizing key, got:", err)
+	}
+	assert.Len(t, minimizedAllUserIDs.GetCertifications(), 0)
+	assert.Len(t, minimizedAllUserIDs.entity.Identities, 2)
+
+	minimized, err := contact.Minimize(true)
+	if err != nil {
+		t.Fatal("Expected no error while minimizing key, got:", err)
+	}
+	assert.Len(t, minimized.GetCertifications(), 0)
+	assert.Len(t, minimized.entity.Identities, 1)
+	assert.Len(t, minimized.entity.Subkeys, 2)
+	assert.Len(t, minimized.entity.Subkeys[0].Revocations, 1)
+	assert.True(t, minimized.CanEncrypt())
+	assert.True(t, minimized.CanVerify())
+
+	contactSerialized, err := contact.Serialize()
+	if err != nil {
+		t.Fatal("Cannot serialize key:", err)
+	}
+	cleanedSerialized, err := cleaned.Serialize()
+	if err != nil {
+		t.Fatal("Cannot serialize key:", err)
+	}
+	minimizedSerialized, err := minimized.Serialize()
+	if err != nil {
+		t.Fatal("Cannot serialize key:", err)
+	}
+	assert.Less(t, len(cleanedSerialized), len(contactSerialized))
+	assert.Less(t, len(minimizedSerialized), len(cleanedSerialized))
+
+	cleanedPrivate, err := private.Clean(nil)
+	if err != nil {
+		t.Fatal("Expected no error while cleaning private key, got:", err)
+	}
+	assert.True(t, cleanedPrivate.IsPrivate())
+	assert.Len(t, cleanedPrivate.entity.Subkeys, 2)
+}
+
+// generateTestV6KeyWithoutUserIDs returns a version 6 private key without user
+// IDs, only bound by its direct-key signature.
+func generateTestV6KeyWithoutUserIDs(t *testing.T) *Key {
+	config := &packet.Config{V6Keys: true, Algorithm: packet.PubKeyAlgoEd25519, Time: getTimeGenerator()}
+	entity, err := openpgp.NewEntity("", "", "v6@example.com", config)
+	if err != nil {
+		t.Fatal("Cannot generate key:", err)
+	}
+	entity.Identities = map[string]*openpgp.Identity{}
+	key, err := NewKeyFromEntity(entity)
+	if err != nil {
+		t.Fatal("Cannot create key:", err)
+	}
+	return key
+}
+
+func TestMinimizeWithoutUserIDs(t *testing.T) {
+	key := generateTestV6KeyWithoutUserIDs(t)
+
+	minimized, err := key.Minimize(true)
+	if err != nil {
+		t.Fatal("Expected no error when minimizing, got:", err)
+	}
+	assert.Empty(t, minimized.entity.Identities)
+	assert.Exactly(t, key.GetFingerprint(), minimized.GetFingerprint())
+}
@@ -0,0 +1,187 @@
+package crypto
+
+import (
+	"bytes"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+)
+
+// Merge returns a copy of the key updated with the user IDs, subkeys,
+// self-signatures, revocations and certifications of other, which must be a
+// copy of the same key. Self-signatures and revocations that do not verify
+// are rejected. The merged key keeps the secret key material of key: if key
+// is private, new subkeys must come with their secret key material.
+func (key *Key) Merge(other *Key) (*Key, error) {
+	if !bytes.Equal(key.entity.PrimaryKey.Fingerprint, other.entity.PrimaryKey.Fingerprint) {
+		return nil, errors.New("gopenpgp: cannot merge different keys")
+	}
+
+	merged, err := key.Copy()
+	if err != nil {
+		return nil, err
+	}
+
+	update, err := other.Copy()
+	if err != nil {
+		return nil, err
+	}
+
+	entity := merged.entity
+	for _, revocation := range update.entity.Revocations {
+		if entity.PrimaryKey.VerifyRevocationSignature(revocation) != nil {
+			return nil, errors.New("gopenpgp: invalid key revocation in merged key")
+		}
+		entity.Revocations = appendSignature(entity.Revocations, revocation)
+	}
+
+	for userID, identity := range update.entity.Identities {
+		if err = mergeIdentity(entity, userID, identity); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range update.entity.Subkeys {
+		if err = mergeSubkey(entity, &update.entity.Subkeys[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Serialize and parse the result, to check its consistency
+	return merged.Copy()
+}
+
+// AddOrMerge adds a key to the keyring, or merges it into the key with the
+// same fingerprint if the keyring already contains one.
+func (keyRing *KeyRing) AddOrMerge(key *Key) error {
+	for i, entity := range keyRing.entities {
+		if !bytes.Equal(entity.PrimaryKey.Fingerprint, key.entity.PrimaryKey.Fingerprint) {
+			continue
+		}
+
+		merged, err := (&Key{entity}).Merge(key)
+		if err != nil {
+			return err
+		}
+
+		if merged.IsPrivate() {
+			isLocked, err := merged.IsLocked()
+			if err != nil {
+				return err
+			}
+			if isLocked {
+				return errors.New("gopenpgp: merged key is not unlocked")
+			}
+		}
+
+		keyRing.entities[i] = merged.entity
+		return nil
+	}
+
+	return keyRing.AddKey(key)
+}
+
+// --- Internal methods
+
+// mergeIdentity merges the signatures over userID into entity, adding the
+// identity if needed.
+func mergeIdentity(entity *openpgp.Entity, userID string, update *openpgp.Identity) error {
+	identity, ok := entity.Identities[userID]
+	if !ok {
+		identity = &openpgp.Identity{
+			Name:   update.Name,
+			UserId: update.UserId,
+		}
+	}
+
+	for _, sig := range update.Signatures {
+		if sig.CheckKeyIdOrFingerprint(entity.PrimaryKey) {
+			if entity.PrimaryKey.VerifyUserIdSignature(userID, entity.PrimaryKey, sig) != nil {
+				return errors.New("gopenpgp: invalid self-signature in merged key")
+			}
+		}
+		identity.Signatures = appendSignature(identity.Signatures, sig)
+	}
+
+	identity.SelfSignature = nil
+	identity.Revocations = nil
+	for _, sig := range identity.Signatures {
+		if !sig.CheckKeyIdOrFingerprint(entity.PrimaryKey) {
+			continue
+		}
+		if sig.SigType == packet.SigTypeCertificationRevocation {
+			identity.Revocations = append(identity.Revocations, sig)
+		} else if identity.SelfSignature == nil || sig.CreationTime.After(identity.SelfSignature.CreationTime) {
+			identity.SelfSignature = sig
+		}
+	}
+
+	if identity.SelfSignature == nil {
+		return errors.New("gopenpgp: user ID without self-signature in merged key")
+	}
+
+	entity.Identities[userID] = identity
+	return nil
+}
+
+// mergeSubkey merges the binding signatures and revocations of update into
+// entity, adding the subkey if needed.
+func mergeSubkey(entity *openpgp.Entity, update *openpgp.Subkey) error {
+	if entity.PrimaryKey.VerifyKeySignature(update.PublicKey, update.Sig) != nil {
+		return errors.New("gopenpgp: invalid subkey binding signature in merged key")
+	}
+	for _, revocation := range update.Revocations {
+		if entity.PrimaryKey.VerifyKeySignature(update.PublicKey, revocation) != nil {
+			return errors.New("gopenpgp: invalid subkey revocation in merged key")
+		}
+	}
+
+	for i := range entity.Subkeys {
+		subkey := &entity.Subkeys[i]
+		if !bytes.Equal(subkey.PublicKey.Fingerprint, update.PublicKey.Fingerprint) {
+			continue
+		}
+
+		if update.Sig.CreationTime.After(subkey.Sig.CreationTime) {
+			subkey.Sig = update.Sig
+		}
+		for _, revocation := range update.Revocations {
+			subkey.Revocations = appendSignature(subkey.Revocations, revocation)
+		}
+		return nil
+	}
+
+	subkey := openpgp.Subkey{
+		PublicKey:   update.PublicKey,
+		Sig:         update.Sig,
+		Revocations: update.Revocations,
+	}
+	if entity.PrivateKey != nil {
+		if update.PrivateKey == nil {
+			return errors.New("gopenpgp: cannot merge a public subkey into a private key")
+		}
+		subkey.PrivateKey = update.PrivateKey
+	}
+
+	entity.Subkeys = append(entity.Subkeys, subkey)
+	return nil
+}
+
+// appendSignature appends sig to signatures, unless an identical signature is
+// already present.
+func appendSignature(signatures []*packet.Signature, sig *packet.Signature) []*packet.Signature {
+	var serialized bytes.Buffer
+	if err := sig.Serialize(&serialized); err != nil {
+		return signatures
+	}
+
+	for _, existing := range signatures {
+		var buffer bytes.Buffer
+		if err := existing.Serialize(&buffer); err == nil && bytes.Equal(buffer.Bytes(), serialized.Bytes()) {
+			return signatures
+		}
+	}
+
+	return append(signatures, sig)
+}
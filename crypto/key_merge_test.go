@@ -0,0 +1,136 @@
+package crypto
+
+import (
+	"crypto"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/assert"
+)
+
+func generateMergeTestKeys(t *testing.T) (base *Key, update *Key) {
+	private, err := GenerateKey("Contact", "contact@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatal("Cannot generate key:", err)
+	}
+
+	base, err = private.ToPublic()
+	if err != nil {
+		t.Fatal("Cannot extract public key:", err)
+	}
+
+	config := &packet.Config{Time: getTimeGenerator(), DefaultHash: crypto.SHA256}
+	if err = private.entity.AddEncryptionSubkey(config); err != nil {
+		t.Fatal("Cannot add subkey:", err)
+	}
+	if err = private.entity.AddUserId("Contact", "", "contact@example.org", config); err != nil {
+		t.Fatal("Cannot add user ID:", err)
+	}
+	err = private.entity.RevokeSubkey(&private.entity.Subkeys[0], packet.KeySuperseded, "", config)
+	if err != nil {
+		t.Fatal("Cannot revoke subkey:", err)
+	}
+
+	update, err = private.ToPublic()
+	if err != nil {
+		t.Fatal("Cannot extract public key:", err)
+	}
+
+	return base, update
+}
+
+func TestKeyMerge(t *testing.T) {
+	base, update := generateMergeTestKeys(t)
+
+	merged, err := base.Merge(update)
+	if err != nil {
+		t.Fatal("Expected no error while merging keys, got:", err)
+	}
+
+	assert.Len(t, base.entity.Subkeys, 1)
+	assert.Len(t, base.entity.Identities, 1)
+	assert.Len(t, merged.entity.Subkeys, 2)
+	assert.Len(t, merged.entity.Identities, 2)
+	assert.Len(t, merged.entity.Subkeys[0].Revocations, 1)
+	assert.False(t, merged.IsPrivate())
+
+	remerged, err := merged.Merge(update)
+	if err != nil {
+		t.Fatal("Expected no error while merging keys, got:", err)
+	}
+
+	serialized, err := merged.Serialize()
+	if err != nil {
+		t.Fatal("Expected no error while serializing key, got:", err)
+	}
+	reserialized, err := remerged.Serialize()
+	if err != nil {
+		t.Fatal("Expected no error while serializing key, got:", err)
+	}
+	assert.Len(t, reserialized, len(serialized))
+
+	reversed, err := update.Merge(base)
+	if err != nil {
+		t.Fatal("Expected no error while merging keys, got:", err)
+	}
+	assert.Len(t, reversed.entity.Subkeys, 2)
+	assert.Len(t, reversed.entity.Identities, 2)
+
+	_, err = base.Merge(keyTestEC)
+	assert.Error(t, err)
+}
+
+func TestKeyMergeInvalidSelfSignature(t *testing.T) {
+	base, update := generateMergeTestKeys(t)
+
+	identity := update.entity.Identities["Contact <contact@example.org>"]
+	identity.Signatures = append(identity.Signatures, update.entity.Identities["Contact <contact@example.com>"].SelfSignature)
+
+	_, err := base.Merge(update)
+	assert.Error(t, err)
+}
+
+func TestKeyMergePublicSubkeyIntoPrivate(t *testing.T) {
+	private, err := GenerateKey("Contact", "contact@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatal("Cannot generate key:", err)
+	}
+
+	update, err := private.Copy()
+	if err != nil {
+		t.Fatal("Cannot copy key:", err)
+	}
+	if err = update.entity.AddEncryptionSubkey(&packet.Config{Time: getTimeGenerator()}); err != nil {
+		t.Fatal("Cannot add subkey:", err)
+	}
+
+	merged, err := private.Merge(update)
+	if err != nil {
+		t.Fatal("Expected no error while merging keys, got:", err)
+	}
+	assert.True(t, merged.IsPrivate())
+	assert.Len(t, merged.entity.Subkeys, 2)
+
+	publicUpdate, err := update.ToPublic()
+	if err != nil {
+		t.Fatal("Cannot extract public key:", err)
+	}
+	_, err = private.Merge(publicUpdate)
+	assert.Error(t, err)
+}
+
+func TestKeyRingAddOrMerge(t *testing.T) {
+	base, update := generateMergeTestKeys(t)
+
+	keyRing, err := NewKeyRing(base)
+	if err != nil {
+		t.Fatal("Expected no error while creating keyring, got:", err)
+	}
+
+	assert.Nil(t, keyRing.AddOrMerge(update))
+	assert.Exactly(t, 1, keyRing.CountEntities())
+	assert.Len(t, keyRing.entities[0].Subkeys, 2)
+
+	assert.Nil(t, keyRing.AddOrMerge(keyTestEC))
+	assert.Exactly(t, 2, keyRing.CountEntities())
+}
@@ -0,0 +1,364 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1" //nolint:gosec
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	goerrors "errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+const (
+	paperKeyVersion    = 0
+	paperKeyLineLength = 20
+)
+
+const (
+	packetTagSecretKey    = 5
+	packetTagPublicKey    = 6
+	packetTagSecretSubkey = 7
+	packetTagPublicSubkey = 14
+)
+
+var paperKeyBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GetPaperKey returns the secret parts of the private key in the binary
+// paperkey format: a version octet, followed for each key by its version,
+// fingerprint, and the length and contents of its secret key material.
+// The secret key material is exported as is, hence encrypted if the key is
+// locked.
+func (key *Key) GetPaperKey() ([]byte, error) {
+	if !key.IsPrivate() {
+		return nil, errors.New("gopenpgp: key is not private")
+	}
+
+	serialized, err := key.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	paperKey := []byte{paperKeyVersion}
+	packets := packet.NewOpaqueReader(bytes.NewReader(serialized))
+	for {
+		p, err := packets.Next()
+		if goerrors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in reading key packets")
+		}
+
+		if p.Tag != packetTagSecretKey && p.Tag != packetTagSecretSubkey {
+			continue
+		}
+
+		publicBody, err := getPublicKeyBody(p.Contents)
+		if err != nil {
+			return nil, err
+		}
+		secret := p.Contents[len(publicBody):]
+		if len(secret) > 0xffff {
+			return nil, errors.New("gopenpgp: secret key material is too long")
+		}
+
+		paperKey = append(paperKey, publicBody[0])
+		paperKey = append(paperKey, getV4Fingerprint(publicBody)...)
+		paperKey = append(paperKey, byte(len(secret)>>8), byte(len(secret)))
+		paperKey = append(paperKey, secret...)
+	}
+
+	return paperKey, nil
+}
+
+// GetPaperKeyText returns the paper key of the private key as printable text,
+// using constants.PaperKeyBase16 or constants.PaperKeyBase32 encoding. Each
+// line ends with the CRC-24 of its data, and the last line holds the CRC-24
+// of the whole paper key.
+func (key *Key) GetPaperKeyText(encoding string) (string, error) {
+	if encoding != constants.PaperKeyBase16 && encoding != constants.PaperKeyBase32 {
+		return "", errors.New("gopenpgp: unknown paper key encoding")
+	}
+
+	paperKey, err := key.GetPaperKey()
+	if err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "# Secret portions of key %s\n", strings.ToUpper(key.GetFingerprint()))
+	fmt.Fprintf(&text, "# Encoding: %s\n", encoding)
+
+	line := 1
+	for offset := 0; offset < len(paperKey); offset += paperKeyLineLength {
+		end := offset + paperKeyLineLength
+		if end > len(paperKey) {
+			end = len(paperKey)
+		}
+		chunk := paperKey[offset:end]
+
+		fmt.Fprintf(&text, "%3d: ", line)
+		if encoding == constants.PaperKeyBase16 {
+			for _, b := range chunk {
+				fmt.Fprintf(&text, "%02X ", b)
+			}
+		} else {
+			encoded := paperKeyBase32.EncodeToString(chunk)
+			for i := 0; i < len(encoded); i += 4 {
+				j := i + 4
+				if j > len(encoded) {
+					j = len(encoded)
+				}
+				text.WriteString(encoded[i:j] + " ")
+			}
+		}
+		fmt.Fprintf(&text, "%06X\n", crc24(chunk))
+		line++
+	}
+	fmt.Fprintf(&text, "%3d: %06X\n", line, crc24(paperKey))
+
+	return text.String(), nil
+}
+
+// NewKeyFromPaperKey rebuilds a private key from its public key and the
+// secret parts exported with GetPaperKey. It returns an error if the
+// fingerprints in the paper key do not match the public key.
+func NewKeyFromPaperKey(publicKey *Key, paperKey []byte) (*Key, error) {
+	secrets, err := parsePaperKey(paperKey)
+	if err != nil {
+		return nil, err
+	}
+
+	serialized, err := publicKey.GetPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var restored bytes.Buffer
+	packets := packet.NewOpaqueReader(bytes.NewReader(serialized))
+	for {
+		p, err := packets.Next()
+		if goerrors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in reading key packets")
+		}
+
+		if p.Tag == packetTagPublicKey || p.Tag == packetTagPublicSubkey {
+			fingerprint := hex.EncodeToString(getV4Fingerprint(p.Contents))
+			secret, ok := secrets[fingerprint]
+			if !ok {
+				return nil, errors.New("gopenpgp: paper key does not match the fingerprint of key " + fingerprint)
+			}
+			delete(secrets, fingerprint)
+
+			if p.Tag == packetTagPublicKey {
+				p.Tag = packetTagSecretKey
+			} else {
+				p.Tag = packetTagSecretSubkey
+			}
+			p.Contents = append(p.Contents, secret...)
+		}
+
+		if err = p.Serialize(&restored); err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in serializing key packets")
+		}
+	}
+
+	if len(secrets) > 0 {
+		return nil, errors.New("gopenpgp: paper key contains keys that do not match the public key")
+	}
+
+	return NewKey(restored.Bytes())
+}
+
+// NewKeyFromPaperKeyText rebuilds a private key from its public key and the
+// text exported with GetPaperKeyText, after checking the CRC-24 of each line
+// and of the whole paper key.
+func NewKeyFromPaperKeyText(publicKey *Key, paperKeyText string) (*Key, error) {
+	paperKey, err := decodePaperKeyText(paperKeyText)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKeyFromPaperKey(publicKey, paperKey)
+}
+
+// --- Internal methods
+
+// parsePaperKey returns the secret key material of each key in the binary
+// paper key, indexed by hex encoded fingerprint.
+func parsePaperKey(paperKey []byte) (map[string][]byte, error) {
+	if len(paperKey) == 0 || paperKey[0] != paperKeyVersion {
+		return nil, errors.New("gopenpgp: unsupported paper key version")
+	}
+
+	secrets := make(map[string][]byte)
+	data := paperKey[1:]
+	for len(data) > 0 {
+		if len(data) < 23 {
+			return nil, errors.New("gopenpgp: truncated paper key")
+		}
+		if data[0] != 4 {
+			return nil, errors.New("gopenpgp: unsupported key version in paper key")
+		}
+
+		fingerprint := hex.EncodeToString(data[1:21])
+		length := int(binary.BigEndian.Uint16(data[21:23]))
+		data = data[23:]
+		if len(data) < length {
+			return nil, errors.New("gopenpgp: truncated paper key")
+		}
+
+		secrets[fingerprint] = clone(data[:length])
+		data = data[length:]
+	}
+
+	return secrets, nil
+}
+
+// decodePaperKeyText decodes the text of a paper key, checking its CRCs.
+func decodePaperKeyText(text string) ([]byte, error) {
+	encoding := constants.PaperKeyBase16
+	var lines [][]string
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			if value := strings.TrimPrefix(line, "# Encoding:"); value != line {
+				encoding = strings.TrimSpace(value)
+			}
+			continue
+		}
+		if line == "" {
+			continue
+		}
+
+		separator := strings.Index(line, ":")
+		if separator < 0 {
+			return nil, errors.New("gopenpgp: malformed paper key line")
+		}
+		number, err := strconv.Atoi(strings.TrimSpace(line[:separator]))
+		if err != nil || number != len(lines)+1 {
+			return nil, errors.New("gopenpgp: missing or misnumbered paper key line")
+		}
+
+		fields := strings.Fields(line[separator+1:])
+		if len(fields) == 0 {
+			return nil, errors.New("gopenpgp: malformed paper key line")
+		}
+		lines = append(lines, fields)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in reading paper key")
+	}
+
+	if len(lines) == 0 {
+		return nil, errors.New("gopenpgp: empty paper key")
+	}
+
+	var paperKey []byte
+	for i, fields := range lines {
+		crc, err := strconv.ParseUint(fields[len(fields)-1], 16, 32)
+		if err != nil {
+			return nil, errors.New("gopenpgp: malformed CRC in paper key line " + strconv.Itoa(i+1))
+		}
+
+		if i == len(lines)-1 {
+			if len(fields) != 1 || uint32(crc) != crc24(paperKey) {
+				return nil, errors.New("gopenpgp: paper key CRC mismatch")
+			}
+			break
+		}
+
+		var chunk []byte
+		data := strings.Join(fields[:len(fields)-1], "")
+		switch encoding {
+		case constants.PaperKeyBase16:
+			chunk, err = hex.DecodeString(data)
+		case constants.PaperKeyBase32:
+			chunk, err = paperKeyBase32.DecodeString(strings.ToUpper(data))
+		default:
+			return nil, errors.New("gopenpgp: unknown paper key encoding")
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: malformed data in paper key line "+strconv.Itoa(i+1))
+		}
+
+		if uint32(crc) != crc24(chunk) {
+			return nil, errors.New("gopenpgp: CRC mismatch in paper key line " + strconv.Itoa(i+1))
+		}
+		paperKey = append(paperKey, chunk...)
+	}
+
+	return paperKey, nil
+}
+
+// getPublicKeyBody returns the prefix of a secret key packet body that holds
+// the public key.
+func getPublicKeyBody(contents []byte) ([]byte, error) {
+	publicKey := &packet.PublicKey{}
+	p, err := packet.Read(bytes.NewReader(append([]byte{0xc0 | byte(packetTagPublicKey), 0xff,
+		byte(len(contents) >> 24), byte(len(contents) >> 16), byte(len(contents) >> 8), byte(len(contents))},
+		contents...)))
+	if err == nil {
+		var ok bool
+		publicKey, ok = p.(*packet.PublicKey)
+		if !ok {
+			err = errors.New("unexpected packet")
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in parsing public key")
+	}
+	if publicKey.Version != 4 {
+		return nil, errors.New("gopenpgp: paper keys only support version 4 keys")
+	}
+
+	var serialized bytes.Buffer
+	if err = publicKey.Serialize(&serialized); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in serializing public key")
+	}
+	public, err := packet.NewOpaqueReader(&serialized).Next()
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in reading public key")
+	}
+
+	return public.Contents, nil
+}
+
+// getV4Fingerprint computes the fingerprint of a version 4 public key packet
+// body.
+func getV4Fingerprint(publicBody []byte) []byte {
+	h := sha1.New() // nolint:gosec
+	h.Write([]byte{0x99, byte(len(publicBody) >> 8), byte(len(publicBody))})
+	h.Write(publicBody)
+	return h.Sum(nil)
+}
+
+// crc24 computes the CRC-24 checksum used by OpenPGP armor and paper keys.
+func crc24(data []byte) uint32 {
+	crc := uint32(0xb704ce)
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= 0x1864cfb
+			}
+		}
+	}
+	return crc & 0xffffff
+}
@@ -0,0 +1,137 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+func TestPaperKeyRoundTrip(t *testing.T) {
+	stub, err := keyTestRSA.ToSecretSubkeysOnly()
+	if err != nil {
+		t.Fatal("Cannot remove primary secret key:", err)
+	}
+
+	for _, private := range []*Key{keyTestRSA, keyTestEC, stub} {
+		public, err := private.ToPublic()
+		if err != nil {
+			t.Fatal("Cannot extract public key:", err)
+		}
+
+		paperKey, err := private.GetPaperKey()
+		if err != nil {
+			t.Fatal("Expected no error while exporting paper key, got:", err)
+		}
+
+		restored, err := NewKeyFromPaperKey(public, paperKey)
+		if err != nil {
+			t.Fatal("Expected no error while restoring paper key, got:", err)
+		}
+		assertSameSerializedKey(t, private, restored)
+
+		for _, encoding := range []string{constants.PaperKeyBase16, constants.PaperKeyBase32} {
+			text, err := private.GetPaperKeyText(encoding)
+			if err != nil {
+				t.Fatal("Expected no error while exporting paper key text, got:", err)
+			}
+			assert.Contains(t, text, strings.ToUpper(private.GetFingerprint()))
+
+			restored, err = NewKeyFromPaperKeyText(public, text)
+			if err != nil {
+				t.Fatal("Expected no error while restoring paper key text, got:", err)
+			}
+			assertSameSerializedKey(t, private, restored)
+		}
+	}
+}
+
+func TestPaperKeyLocked(t *testing.T) {
+	locked, err := keyTestEC.Lock(keyTestPassphrase)
+	if err != nil {
+		t.Fatal("Cannot lock key:", err)
+	}
+
+	text, err := locked.GetPaperKeyText(constants.PaperKeyBase32)
+	if err != nil {
+		t.Fatal("Expected no error while exporting paper key text, got:", err)
+	}
+
+	restored, err := NewKeyFromPaperKeyText(locked, text)
+	if err != nil {
+		t.Fatal("Expected no error while restoring paper key text, got:", err)
+	}
+
+	isLocked, err := restored.IsLocked()
+	if err != nil {
+		t.Fatal("Expected no error while checking key, got:", err)
+	}
+	assert.True(t, isLocked)
+
+	unlocked, err := restored.Unlock(keyTestPassphrase)
+	if err != nil {
+		t.Fatal("Expected no error while unlocking restored key, got:", err)
+	}
+	assertSameSerializedKey(t, keyTestEC, unlocked)
+}
+
+func TestPaperKeyErrors(t *testing.T) {
+	public, err := keyTestEC.ToPublic()
+	if err != nil {
+		t.Fatal("Cannot extract public key:", err)
+	}
+
+	_, err = public.GetPaperKey()
+	assert.Error(t, err)
+
+	_, err = keyTestEC.GetPaperKeyText("base64")
+	assert.Error(t, err)
+
+	paperKey, err := keyTestEC.GetPaperKey()
+	if err != nil {
+		t.Fatal("Expected no error while exporting paper key, got:", err)
+	}
+
+	// Wrong public key
+	_, err = NewKeyFromPaperKey(keyTestRSA, paperKey)
+	assert.Error(t, err)
+
+	// Truncated paper key
+	_, err = NewKeyFromPaperKey(public, paperKey[:len(paperKey)-1])
+	assert.Error(t, err)
+
+	text, err := keyTestEC.GetPaperKeyText(constants.PaperKeyBase16)
+	if err != nil {
+		t.Fatal("Expected no error while exporting paper key text, got:", err)
+	}
+
+	// Corrupted data
+	corrupted := strings.Replace(text, "  1: 00 04", "  1: 00 05", 1)
+	assert.NotEqual(t, text, corrupted)
+	_, err = NewKeyFromPaperKeyText(public, corrupted)
+	assert.Error(t, err)
+
+	// Missing line
+	lines := strings.Split(text, "\n")
+	_, err = NewKeyFromPaperKeyText(public, strings.Join(append(lines[:3], lines[4:]...), "\n"))
+	assert.Error(t, err)
+}
+
+func assertSameSerializedKey(t *testing.T, expected, actual *Key) {
+	// Compare with a parsed copy, as parsing may reorder secret key material
+	expected, err := expected.Copy()
+	if err != nil {
+		t.Fatal("Cannot copy key:", err)
+	}
+	expectedSerialized, err := expected.Serialize()
+	if err != nil {
+		t.Fatal("Cannot serialize key:", err)
+	}
+	actualSerialized, err := actual.Serialize()
+	if err != nil {
+		t.Fatal("Cannot serialize key:", err)
+	}
+	assert.Exactly(t, expectedSerialized, actualSerialized)
+}
@@ -0,0 +1,233 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	goerrors "errors"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/ProtonMail/go-crypto/openpgp/s2k"
+	"github.com/pkg/errors"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+// S2K usage octets of secret key packets.
+const (
+	s2kUsageNone     = 0
+	s2kUsageAEAD     = 253
+	s2kUsageSHA1     = 254
+	s2kUsageChecksum = 255
+)
+
+var aeadModes = map[string]packet.AEADMode{
+	constants.AEADEAX: packet.AEADModeEAX,
+	constants.AEADOCB: packet.AEADModeOCB,
+	constants.AEADGCM: packet.AEADModeGCM,
+}
+
+// KeyLockOptions are the options to protect the secret key material of
+// private keys with a passphrase.
+type KeyLockOptions struct {
+	// S2K are the parameters of the key derivation from the passphrase. If
+	// nil, iterated and salted S2K is used with default parameters.
+	S2K *S2KParams
+	// AEAD is the AEAD mode protecting the secret key material
+	// (constants.AEADOCB, constants.AEADEAX or constants.AEADGCM), or empty to
+	// use CFB with a SHA-1 checksum. Argon2 S2K requires AEAD.
+	AEAD string
+	// Cipher is the symmetric cipher protecting the secret key material
+	// (constants.AES128, constants.AES192 or constants.AES256), or empty to
+	// use AES-256.
+	Cipher string
+}
+
+// NewKeyLockOptions returns key lock options with the given S2K parameters
+// and AEAD mode, and AES-256.
+func NewKeyLockOptions(s2kParams *S2KParams, aead string) *KeyLockOptions {
+	return &KeyLockOptions{
+		S2K:    s2kParams,
+		AEAD:   aead,
+		Cipher: constants.AES256,
+	}
+}
+
+// LockWithOptions locks a copy of the key with the given options. Nil options
+// lock the key like Lock.
+func (key *Key) LockWithOptions(passphrase []byte, options *KeyLockOptions) (*Key, error) {
+	unlocked, err := key.IsUnlocked()
+	if err != nil {
+		return nil, err
+	}
+
+	if !unlocked {
+		return nil, errors.New("gopenpgp: key is not unlocked")
+	}
+
+	if options == nil {
+		options = &KeyLockOptions{}
+	}
+
+	config, err := options.getConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	lockedKey, err := key.Copy()
+	if err != nil {
+		return nil, err
+	}
+
+	if passphrase == nil || !key.hasSecretMaterial() {
+		return lockedKey, nil
+	}
+
+	// A single key is derived from the passphrase for the primary key and all
+	// subkeys.
+	if err = lockedKey.entity.EncryptPrivateKeys(passphrase, config); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in locking key")
+	}
+
+	locked, err := lockedKey.IsLocked()
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, errors.New("gopenpgp: unable to lock key")
+	}
+
+	return lockedKey, nil
+}
+
+// GetLockOptions returns the options the private key is locked with, to lock
+// it again in the same way, for instance after changing its passphrase.
+func (key *Key) GetLockOptions() (*KeyLockOptions, error) {
+	if !key.IsPrivate() {
+		return nil, errors.New("gopenpgp: a public key cannot be locked")
+	}
+
+	serialized, err := key.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	var options *KeyLockOptions
+	err = forEachSecretKeyPacket(serialized, func(secret []byte) {
+		if options != nil || len(secret) < 3 {
+			return
+		}
+
+		switch secret[0] {
+		case s2kUsageAEAD:
+			mode := packet.AEADMode(secret[2])
+			for name, aeadMode := range aeadModes {
+				if aeadMode == mode {
+					options = NewKeyLockOptions(parseS2KParams(secret[3:]), name)
+				}
+			}
+		case s2kUsageSHA1, s2kUsageChecksum:
+			if !bytes.Equal(secret, gnuDummyS2K) {
+				options = NewKeyLockOptions(parseS2KParams(secret[2:]), "")
+			}
+		}
+		if options != nil {
+			options.Cipher = getCipherName(packet.CipherFunction(secret[1]))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if options == nil {
+		return nil, errors.New("gopenpgp: key is not locked")
+	}
+
+	return options, nil
+}
+
+// --- Internal methods
+
+// getConfig returns the go-crypto configuration to lock keys with the
+// options.
+func (options *KeyLockOptions) getConfig() (*packet.Config, error) {
+	s2kConfig, err := options.S2K.getConfig()
+	if err != nil {
+		return nil, err
+	}
+	if s2kConfig == nil {
+		s2kConfig = &s2k.Config{
+			S2KMode:  s2k.IteratedSaltedS2K,
+			Hash:     crypto.SHA256,
+			S2KCount: 65536,
+		}
+	}
+
+	config := &packet.Config{
+		S2KConfig:     s2kConfig,
+		DefaultCipher: packet.CipherAES256,
+	}
+
+	if options.Cipher != "" {
+		cipherFunc, ok := symKeyAlgos[options.Cipher]
+		if !ok {
+			return nil, errors.New("gopenpgp: unknown cipher " + options.Cipher)
+		}
+		config.DefaultCipher = cipherFunc
+	}
+
+	if options.AEAD == "" {
+		if s2kConfig.Mode() == s2k.Argon2S2K {
+			return nil, errors.New("gopenpgp: Argon2 S2K requires AEAD key protection")
+		}
+		return config, nil
+	}
+
+	mode, ok := aeadModes[options.AEAD]
+	if !ok {
+		return nil, errors.New("gopenpgp: unknown AEAD mode " + options.AEAD)
+	}
+	switch config.DefaultCipher {
+	case packet.CipherAES128, packet.CipherAES192, packet.CipherAES256:
+	default:
+		return nil, errors.New("gopenpgp: unsupported cipher for AEAD")
+	}
+	config.AEADConfig = &packet.AEADConfig{DefaultMode: mode}
+
+	return config, nil
+}
+
+// getCipherName returns the name of the cipher, as in constants.
+func getCipherName(cipherFunc packet.CipherFunction) string {
+	for _, name := range []string{constants.AES256, constants.AES192, constants.AES128, constants.CAST5, constants.ThreeDES} {
+		if symKeyAlgos[name] == cipherFunc {
+			return name
+		}
+	}
+	return ""
+}
+
+// forEachSecretKeyPacket calls read on the secret part of each version 4
+// secret key packet of data.
+func forEachSecretKeyPacket(data []byte, read func(secret []byte)) error {
+	packets := packet.NewOpaqueReader(bytes.NewReader(data))
+	for {
+		p, err := packets.Next()
+		if goerrors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "gopenpgp: error in reading key packets")
+		}
+
+		if (p.Tag != packetTagSecretKey && p.Tag != packetTagSecretSubkey) ||
+			len(p.Contents) == 0 || p.Contents[0] != 4 {
+			continue
+		}
+
+		publicBody, err := getPublicKeyBody(p.Contents)
+		if err == nil && len(publicBody) < len(p.Contents) {
+			read(p.Contents[len(publicBody):])
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+func getTestArgon2S2KParams() *S2KParams {
+	return NewArgon2S2KParams(1, 1, 64)
+}
+
+func TestLockWithArgon2AndAEAD(t *testing.T) {
+	for _, aead := range []string{constants.AEADOCB, constants.AEADEAX, constants.AEADGCM} {
+		locked, err := keyTestEC.LockWithOptions(keyTestPassphrase, NewKeyLockOptions(getTestArgon2S2KParams(), aead))
+		if err != nil {
+			t.Fatal("Expected no error while locking key, got:", err)
+		}
+
+		armored, err := locked.Armor()
+		if err != nil {
+			t.Fatal("Expected no error while armoring key, got:", err)
+		}
+		parsed, err := NewKeyFromArmored(armored)
+		if err != nil {
+			t.Fatal("Expected no error while parsing key, got:", err)
+		}
+
+		serialized, err := parsed.Serialize()
+		if err != nil {
+			t.Fatal("Expected no error while serializing key, got:", err)
+		}
+		protectedKeys := 0
+		err = forEachSecretKeyPacket(serialized, func(secret []byte) {
+			assert.Exactly(t, byte(s2kUsageAEAD), secret[0])
+			protectedKeys++
+		})
+		if err != nil {
+			t.Fatal("Expected no error while reading key packets, got:", err)
+		}
+		assert.Exactly(t, 2, protectedKeys)
+
+		isLocked, err := parsed.IsLocked()
+		if err != nil {
+			t.Fatal("Expected no error while checking key, got:", err)
+		}
+		assert.True(t, isLocked)
+		assert.False(t, parsed.HasPrimaryKeyStub())
+
+		options, err := parsed.GetLockOptions()
+		if err != nil {
+			t.Fatal("Expected no error while reading lock options, got:", err)
+		}
+		assert.Exactly(t, aead, options.AEAD)
+		assert.Exactly(t, getTestArgon2S2KParams(), options.S2K)
+
+		_, err = NewKeyRing(parsed)
+		assert.Error(t, err)
+
+		_, err = parsed.Unlock([]byte("wrong passphrase"))
+		assert.Error(t, err)
+
+		unlocked, err := parsed.Unlock(keyTestPassphrase)
+		if err != nil {
+			t.Fatal("Expected no error while unlocking key, got:", err)
+		}
+		assertSameSerializedKey(t, keyTestEC, unlocked)
+	}
+}
+
+func TestLockWithIteratedS2K(t *testing.T) {
+	locked, err := keyTestEC.LockWithOptions(keyTestPassphrase, NewKeyLockOptions(NewIteratedS2KParams(1<<20), ""))
+	if err != nil {
+		t.Fatal("Expected no error while locking key, got:", err)
+	}
+
+	options, err := locked.GetLockOptions()
+	if err != nil {
+		t.Fatal("Expected no error while reading lock options, got:", err)
+	}
+	assert.Exactly(t, "", options.AEAD)
+	assert.Exactly(t, NewIteratedS2KParams(1<<20), options.S2K)
+
+	unlocked, err := locked.Unlock(keyTestPassphrase)
+	if err != nil {
+		t.Fatal("Expected no error while unlocking key, got:", err)
+	}
+	assertSameSerializedKey(t, keyTestEC, unlocked)
+
+	_, err = keyTestEC.GetLockOptions()
+	assert.Error(t, err)
+}
+
+func TestLockKeepsCipher(t *testing.T) {
+	for _, aead := range []string{"", constants.AEADOCB} {
+		options := NewKeyLockOptions(NewIteratedS2KParams(65536), aead)
+		options.Cipher = constants.AES128
+		locked, err := keyTestEC.LockWithOptions(keyTestPassphrase, options)
+		if err != nil {
+			t.Fatal("Expected no error while locking key, got:", err)
+		}
+
+		lockOptions, err := locked.GetLockOptions()
+		if err != nil {
+			t.Fatal("Expected no error while reading lock options, got:", err)
+		}
+		assert.Exactly(t, options, lockOptions)
+
+		// The protection is kept by the entity, also once in a keyring
+		keyRing := &KeyRing{}
+		keyRing.appendKey(locked)
+		fromKeyRing, err := keyRing.GetKey(0)
+		if err != nil {
+			t.Fatal("Expected no error while getting key, got:", err)
+		}
+		lockOptions, err = fromKeyRing.GetLockOptions()
+		if err != nil {
+			t.Fatal("Expected no error while reading lock options, got:", err)
+		}
+		assert.Exactly(t, options, lockOptions)
+
+		unlocked, err := fromKeyRing.Unlock(keyTestPassphrase)
+		if err != nil {
+			t.Fatal("Expected no error while unlocking key, got:", err)
+		}
+		assertSameSerializedKey(t, keyTestEC, unlocked)
+	}
+}
+
+func TestLockWithInvalidOptions(t *testing.T) {
+	_, err := keyTestEC.LockWithOptions(keyTestPassphrase, NewKeyLockOptions(getTestArgon2S2KParams(), ""))
+	assert.Error(t, err)
+
+	_, err = keyTestEC.LockWithOptions(keyTestPassphrase, NewKeyLockOptions(nil, "cfb"))
+	assert.Error(t, err)
+
+	_, err = keyTestEC.LockWithOptions(keyTestPassphrase, NewKeyLockOptions(NewArgon2S2KParams(0, 1, 64), constants.AEADOCB))
+	assert.Error(t, err)
+
+	_, err = keyTestEC.LockWithOptions(keyTestPassphrase, NewKeyLockOptions(NewIteratedS2KParams(1024), ""))
+	assert.Error(t, err)
+
+	_, err = keyTestEC.LockWithOptions(keyTestPassphrase, &KeyLockOptions{Cipher: "aes512"})
+	assert.Error(t, err)
+
+	_, err = keyTestEC.LockWithOptions(keyTestPassphrase, &KeyLockOptions{AEAD: constants.AEADOCB, Cipher: constants.CAST5})
+	assert.Error(t, err)
+}
+
+func TestLockWithAEADPrimaryKeyStub(t *testing.T) {
+	stub, err := keyTestEC.ToSecretSubkeysOnly()
+	if err != nil {
+		t.Fatal("Cannot remove primary secret key:", err)
+	}
+
+	locked, err := stub.LockWithOptions(keyTestPassphrase, NewKeyLockOptions(getTestArgon2S2KParams(), constants.AEADOCB))
+	if err != nil {
+		t.Fatal("Expected no error while locking key, got:", err)
+	}
+	assert.True(t, locked.HasPrimaryKeyStub())
+
+	copied, err := locked.Copy()
+	if err != nil {
+		t.Fatal("Expected no error while copying key, got:", err)
+	}
+
+	unlocked, err := copied.Unlock(keyTestPassphrase)
+	if err != nil {
+		t.Fatal("Expected no error while unlocking key, got:", err)
+	}
+	assert.True(t, unlocked.HasPrimaryKeyStub())
+	assertSameSerializedKey(t, stub, unlocked)
+}
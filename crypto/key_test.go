@@ -452,3 +452,119 @@ func TestKeyCompression(t *testing.T) {
 		keyTestEC.entity.PrimaryIdentity().SelfSignature.PreferredCompression,
 	)
 }
+
+func TestSecretSubkeysOnly(t *testing.T) {
+	fullKey, err := keyTestEC.Copy()
+	if err != nil {
+		t.Fatal("Cannot copy key:", err)
+	}
+	if err = fullKey.entity.AddSigningSubkey(&packet.Config{Time: getTimeGenerator()}); err != nil {
+		t.Fatal("Cannot add signing subkey:", err)
+	}
+
+	stubbedKey, err := fullKey.ToSecretSubkeysOnly()
+	if err != nil {
+		t.Fatal("Expected no error while stubbing primary key, got:", err)
+	}
+	assert.False(t, fullKey.HasPrimaryKeyStub())
+	assert.True(t, stubbedKey.HasPrimaryKeyStub())
+
+	locked, err := stubbedKey.Lock(keyTestPassphrase)
+	if err != nil {
+		t.Fatal("Expected no error while locking stubbed key, got:", err)
+	}
+
+	armored, err := locked.Armor()
+	if err != nil {
+		t.Fatal("Expected no error while armoring stubbed key, got:", err)
+	}
+
+	parsed, err := NewKeyFromArmored(armored)
+	if err != nil {
+		t.Fatal("Expected no error while parsing stubbed key, got:", err)
+	}
+	assert.True(t, parsed.HasPrimaryKeyStub())
+	assert.Exactly(t, fullKey.GetFingerprint(), parsed.GetFingerprint())
+
+	isLocked, err := parsed.IsLocked()
+	assert.Nil(t, err)
+	assert.True(t, isLocked)
+
+	_, err = NewKeyRing(parsed)
+	assert.Error(t, err)
+
+	unlocked, err := parsed.Unlock(keyTestPassphrase)
+	if err != nil {
+		t.Fatal("Expected no error while unlocking stubbed key, got:", err)
+	}
+
+	isUnlocked, err := unlocked.IsUnlocked()
+	assert.Nil(t, err)
+	assert.True(t, isUnlocked)
+
+	ok, err := unlocked.Check()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	keyRing, err := NewKeyRing(unlocked)
+	if err != nil {
+		t.Fatal("Expected no error while building keyring, got:", err)
+	}
+
+	message := NewPlainMessageFromString("hello")
+	ciphertext, err := keyRing.Encrypt(message, keyRing)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+
+	decrypted, err := keyRing.Decrypt(ciphertext, keyRing, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+
+	_, err = keyRing.CertifyKey(keyTestRSA, keyTestName+" <"+keyTestDomain+">", 0, 0)
+	assert.Error(t, err)
+}
+
+func TestSecretSubkeysOnlyWithoutSigningSubkey(t *testing.T) {
+	stubbedKey, err := keyTestEC.ToSecretSubkeysOnly()
+	if err != nil {
+		t.Fatal("Expected no error while stubbing primary key, got:", err)
+	}
+
+	keyRing, err := NewKeyRing(stubbedKey)
+	if err != nil {
+		t.Fatal("Expected no error while building keyring, got:", err)
+	}
+
+	_, err = keyRing.SignDetached(NewPlainMessageFromString("hello"))
+	assert.Error(t, err)
+
+	allStubs, err := stubbedKey.Copy()
+	if err != nil {
+		t.Fatal("Cannot copy key:", err)
+	}
+	allStubs.entity.Subkeys = nil
+
+	isLocked, err := allStubs.IsLocked()
+	assert.Nil(t, err)
+	assert.False(t, isLocked)
+
+	_, err = allStubs.Lock(keyTestPassphrase)
+	assert.Nil(t, err)
+
+	_, err = allStubs.Unlock(keyTestPassphrase)
+	assert.Nil(t, err)
+
+	publicKey, err := keyTestEC.ToPublic()
+	if err != nil {
+		t.Fatal("Cannot extract public key:", err)
+	}
+	_, err = publicKey.ToSecretSubkeysOnly()
+	assert.Error(t, err)
+
+	// The stub has the version 4 secret key packet layout
+	_, err = generateTestV6KeyWithoutUserIDs(t).ToSecretSubkeysOnly()
+	assert.Error(t, err)
+}
@@ -75,7 +75,7 @@ func (keyRing *KeyRing) getSigningEntity() (*openpgp.Entity, error) {
 	for _, e := range keyRing.entities {
 		// Entity.PrivateKey must be a signing key
 		if e.PrivateKey != nil {
-			if !e.PrivateKey.Encrypted {
+			if !e.PrivateKey.Encrypted && hasSigningSecret(e) {
 				signEntity = e
 				break
 			}
@@ -88,6 +88,16 @@ func (keyRing *KeyRing) getSigningEntity() (*openpgp.Entity, error) {
 	return signEntity, nil
 }
 
+// hasSigningSecret checks that the signing key of the entity is not a
+// GNU-dummy stub without secret key material.
+func hasSigningSecret(e *openpgp.Entity) bool {
+	signingKey, ok := e.SigningKey(getNow())
+	if !ok {
+		return !e.PrivateKey.Dummy()
+	}
+	return signingKey.PrivateKey != nil && !signingKey.PrivateKey.Dummy()
+}
+
 // --- Extract info from key
 
 // CountEntities returns the number of entities in the keyring.
@@ -0,0 +1,156 @@
+package crypto
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+// BulkRecipientResult is the key packet of one recipient of a bulk
+// encryption, or the reason why the message could not be encrypted to it.
+type BulkRecipientResult struct {
+	key       *Key
+	keyPacket []byte
+	err       error
+}
+
+// GetKey returns the key of the recipient.
+func (res *BulkRecipientResult) GetKey() *Key {
+	return res.key
+}
+
+// GetKeyPacket returns the Public-Key Encrypted Session Key Packet of the
+// recipient, or the error that prevented encrypting the session key to it,
+// e.g. an expired or revoked key, or a key without encryption subkey.
+func (res *BulkRecipientResult) GetKeyPacket() ([]byte, error) {
+	if res.err != nil {
+		return nil, res.err
+	}
+	return res.keyPacket, nil
+}
+
+// BulkEncryptSplitResult is used to wrap the encryption writecloser while
+// storing the key packet of each recipient.
+type BulkEncryptSplitResult struct {
+	recipients         []*BulkRecipientResult
+	plainMessageWriter WriteCloser // The writer to writer plaintext data in.
+}
+
+func (res *BulkEncryptSplitResult) Write(b []byte) (n int, err error) {
+	return res.plainMessageWriter.Write(b)
+}
+
+func (res *BulkEncryptSplitResult) Close() (err error) {
+	return res.plainMessageWriter.Close()
+}
+
+// GetRecipientCount returns the number of recipients, one per key of the
+// encryption keyring.
+func (res *BulkEncryptSplitResult) GetRecipientCount() int {
+	return len(res.recipients)
+}
+
+// GetRecipient returns the result of the n-th recipient, in the order of the
+// keys of the encryption keyring.
+func (res *BulkEncryptSplitResult) GetRecipient(n int) (*BulkRecipientResult, error) {
+	if n < 0 || n >= len(res.recipients) {
+		return nil, errors.New("gopenpgp: out of bound when fetching recipient")
+	}
+	return res.recipients[n], nil
+}
+
+// EncryptSplitStreamPerRecipient is used to encrypt data as a stream to many
+// recipients. The data packet is encrypted once, with an AES-256 session key,
+// and written to the writer for the Symmetrically Encrypted Data Packet
+// (https://datatracker.ietf.org/doc/html/rfc4880#section-5.7).
+// A separate key packet is produced for each key of the keyring, in parallel
+// across the available cores. Keys the session key can't be encrypted to are
+// reported in their BulkRecipientResult instead of failing the encryption,
+// which fails only if no recipient is left.
+// If signKeyRing is not nil, it is used to do an embedded signature.
+func (keyRing *KeyRing) EncryptSplitStreamPerRecipient(
+	dataPacketWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	signKeyRing *KeyRing,
+) (*BulkEncryptSplitResult, error) {
+	sk, err := GenerateSessionKeyAlgo(constants.AES256)
+	if err != nil {
+		return nil, err
+	}
+	defer sk.Clear()
+
+	cf, err := sk.GetCipherFunc()
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to encrypt session key")
+	}
+
+	recipients := make([]*BulkRecipientResult, len(keyRing.entities))
+	indexes := make(chan int)
+	var done sync.WaitGroup
+	for worker := 0; worker < runtime.NumCPU(); worker++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			for i := range indexes {
+				entity := keyRing.entities[i]
+				keyPacket, err := encryptSessionKeyToEntity(entity, cf, sk.Key)
+				recipients[i] = &BulkRecipientResult{
+					key:       &Key{entity: entity},
+					keyPacket: keyPacket,
+					err:       err,
+				}
+			}
+		}()
+	}
+	for i := range keyRing.entities {
+		indexes <- i
+	}
+	close(indexes)
+	done.Wait()
+
+	encrypted := false
+	for _, recipient := range recipients {
+		encrypted = encrypted || recipient.err == nil
+	}
+	if !encrypted {
+		return nil, errors.New("gopenpgp: no recipient can be encrypted to")
+	}
+
+	plainMessageWriter, err := sk.encryptStream(dataPacketWriter, plainMessageMetadata, signKeyRing, false, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BulkEncryptSplitResult{
+		recipients:         recipients,
+		plainMessageWriter: plainMessageWriter,
+	}, nil
+}
+
+// encryptSessionKeyToEntity returns the key packet encrypting the session key
+// to the encryption key of the entity.
+func encryptSessionKeyToEntity(entity *openpgp.Entity, cf packet.CipherFunction, sessionKey []byte) ([]byte, error) {
+	key := &Key{entity: entity}
+	if key.IsRevoked() {
+		return nil, errors.New("gopenpgp: recipient key " + key.GetHexKeyID() + " is revoked")
+	}
+	if key.IsExpired() {
+		return nil, errors.New("gopenpgp: recipient key " + key.GetHexKeyID() + " is expired")
+	}
+	encryptionKey, ok := entity.EncryptionKey(getNow())
+	if !ok {
+		return nil, errors.New("gopenpgp: recipient key " + key.GetHexKeyID() + " has no valid encryption subkey")
+	}
+
+	var keyPacket bytes.Buffer
+	if err := packet.SerializeEncryptedKey(&keyPacket, encryptionKey.PublicKey, cf, sessionKey, nil); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: cannot encrypt session key to recipient key "+key.GetHexKeyID())
+	}
+	return keyPacket.Bytes(), nil
+}
@@ -0,0 +1,89 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyRing_EncryptSplitStreamPerRecipient(t *testing.T) {
+	expiredKey, err := NewKeyFromArmored(readTestFile("key_expiredKey", false))
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring the expired key, got:", err)
+	}
+	recipients, err := NewKeyRing(keyTestRSA)
+	if err != nil {
+		t.Fatal("Expected no error while building the keyring, got:", err)
+	}
+	for _, key := range []*Key{expiredKey, keyTestEC} {
+		if err = recipients.AddKey(key); err != nil {
+			t.Fatal("Expected no error while adding a key to the keyring, got:", err)
+		}
+	}
+
+	messageBytes := []byte("Hello World!")
+	var dataPacketBuf bytes.Buffer
+	encryptionResult, err := recipients.EncryptSplitStreamPerRecipient(&dataPacketBuf, testMeta, nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting the stream, got:", err)
+	}
+	if _, err = encryptionResult.Write(messageBytes); err != nil {
+		t.Fatal("Expected no error while writing data, got:", err)
+	}
+	if err = encryptionResult.Close(); err != nil {
+		t.Fatal("Expected no error while closing the plaintext writer, got:", err)
+	}
+	assert.Exactly(t, 3, encryptionResult.GetRecipientCount())
+
+	for i, key := range []*Key{keyTestRSA, keyTestEC} {
+		recipient, err := encryptionResult.GetRecipient(i * 2)
+		if err != nil {
+			t.Fatal("Expected no error while getting the recipient, got:", err)
+		}
+		assert.Exactly(t, key.GetFingerprint(), recipient.GetKey().GetFingerprint())
+		keyPacket, err := recipient.GetKeyPacket()
+		if err != nil {
+			t.Fatal("Expected no error while getting the key packet, got:", err)
+		}
+
+		keyRing, err := NewKeyRing(key)
+		if err != nil {
+			t.Fatal("Expected no error while building the keyring, got:", err)
+		}
+		message := NewPGPSplitMessage(keyPacket, dataPacketBuf.Bytes()).GetPGPMessage()
+		decrypted, err := keyRing.Decrypt(message, nil, 0)
+		if err != nil {
+			t.Fatal("Expected no error while decrypting, got:", err)
+		}
+		assert.Exactly(t, messageBytes, decrypted.GetBinary())
+	}
+
+	expired, _ := encryptionResult.GetRecipient(1)
+	_, err = expired.GetKeyPacket()
+	assert.EqualError(t, err, "gopenpgp: recipient key "+expiredKey.GetHexKeyID()+" is expired")
+	_, err = encryptionResult.GetRecipient(3)
+	assert.NotNil(t, err)
+
+	invalidRecipients, err := NewKeyRing(expiredKey)
+	if err != nil {
+		t.Fatal("Expected no error while building the keyring, got:", err)
+	}
+	_, err = invalidRecipients.EncryptSplitStreamPerRecipient(&dataPacketBuf, testMeta, nil)
+	assert.NotNil(t, err)
+}
+
+func TestEncryptSessionKeyToRevokedEntity(t *testing.T) {
+	pgp.latestServerTime = 1632219895
+	defer func() {
+		pgp.latestServerTime = testTime
+	}()
+
+	revokedKey, err := NewKeyFromArmored(readTestFile("key_revoked", false))
+	if err != nil {
+		t.Fatal("Expected no error while unarmoring the revoked key, got:", err)
+	}
+	_, err = encryptSessionKeyToEntity(revokedKey.entity, packet.CipherAES256, testSessionKey.Key)
+	assert.EqualError(t, err, "gopenpgp: recipient key "+revokedKey.GetHexKeyID()+" is revoked")
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
+	pgpErrors "github.com/ProtonMail/go-crypto/openpgp/errors"
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
 	"github.com/ProtonMail/gopenpgp/v2/constants"
 	"github.com/pkg/errors"
@@ -17,7 +18,7 @@ import (
 // * message    : The plaintext input as a PlainMessage.
 // * privateKey : (optional) an unlocked private keyring to include signature in the message.
 func (keyRing *KeyRing) Encrypt(message *PlainMessage, privateKey *KeyRing) (*PGPMessage, error) {
-	return asymmetricEncrypt(message, keyRing, privateKey, false, nil)
+	return asymmetricEncrypt(message, keyRing, privateKey, false, nil, nil, false)
 }
 
 // EncryptWithContext encrypts a PlainMessage, outputs a PGPMessage.
@@ -26,7 +27,7 @@ func (keyRing *KeyRing) Encrypt(message *PlainMessage, privateKey *KeyRing) (*PG
 // * privateKey : (optional) an unlocked private keyring to include signature in the message.
 // * signingContext : (optional) the context for the signature.
 func (keyRing *KeyRing) EncryptWithContext(message *PlainMessage, privateKey *KeyRing, signingContext *SigningContext) (*PGPMessage, error) {
-	return asymmetricEncrypt(message, keyRing, privateKey, false, signingContext)
+	return asymmetricEncrypt(message, keyRing, privateKey, false, signingContext, nil, false)
 }
 
 // EncryptWithCompression encrypts with compression support a PlainMessage to PGPMessage using public/private keys.
@@ -34,7 +35,7 @@ func (keyRing *KeyRing) EncryptWithContext(message *PlainMessage, privateKey *Ke
 // * privateKey : (optional) an unlocked private keyring to include signature in the message.
 // * output  : The encrypted data as PGPMessage.
 func (keyRing *KeyRing) EncryptWithCompression(message *PlainMessage, privateKey *KeyRing) (*PGPMessage, error) {
-	return asymmetricEncrypt(message, keyRing, privateKey, true, nil)
+	return asymmetricEncrypt(message, keyRing, privateKey, true, nil, nil, false)
 }
 
 // EncryptWithContextAndCompression encrypts with compression support a PlainMessage to PGPMessage using public/private keys.
@@ -43,7 +44,78 @@ func (keyRing *KeyRing) EncryptWithCompression(message *PlainMessage, privateKey
 // * signingContext : (optional) the context for the signature.
 // * output  : The encrypted data as PGPMessage.
 func (keyRing *KeyRing) EncryptWithContextAndCompression(message *PlainMessage, privateKey *KeyRing, signingContext *SigningContext) (*PGPMessage, error) {
-	return asymmetricEncrypt(message, keyRing, privateKey, true, signingContext)
+	return asymmetricEncrypt(message, keyRing, privateKey, true, signingContext, nil, false)
+}
+
+// EncryptWithPadding encrypts a PlainMessage, outputs a PGPMessage, padding
+// the encrypted data as described by the padding policy, to hide the length of
+// the plaintext.
+// If an unlocked private key is also provided it will also sign the message.
+// * message    : The plaintext input as a PlainMessage.
+// * privateKey : (optional) an unlocked private keyring to include signature in the message.
+// * padding    : The padding policy, e.g. NewPowerOfTwoPaddingPolicy().
+func (keyRing *KeyRing) EncryptWithPadding(message *PlainMessage, privateKey *KeyRing, padding *PaddingPolicy) (*PGPMessage, error) {
+	if padding == nil {
+		return nil, errors.New("gopenpgp: no padding policy provided")
+	}
+	return asymmetricEncrypt(message, keyRing, privateKey, false, nil, padding, false)
+}
+
+// EncryptWithIntendedRecipients encrypts a PlainMessage, outputs a PGPMessage,
+// like Encrypt. The embedded signature lists the fingerprints of the
+// recipients as intended recipients, so that a recipient can't forward the
+// signed message to a third party unnoticed, see
+// DecryptWithIntendedRecipientCheck.
+// * message    : The plaintext input as a PlainMessage.
+// * privateKey : An unlocked private keyring to include signature in the message.
+func (keyRing *KeyRing) EncryptWithIntendedRecipients(message *PlainMessage, privateKey *KeyRing) (*PGPMessage, error) {
+	if privateKey == nil {
+		return nil, errors.New("gopenpgp: no signing key provided")
+	}
+	return asymmetricEncrypt(message, keyRing, privateKey, false, nil, nil, true)
+}
+
+// EncryptWithHiddenRecipients encrypts a PlainMessage to PGPMessage to the
+// keys of the keyring and to hidden recipients, whose key packets have a
+// wildcard key ID so that the message does not reveal who it is for.
+// The keyring can be nil to encrypt to hidden recipients only.
+// * message          : The plain data as a PlainMessage.
+// * hiddenRecipients : The public keys of the hidden recipients.
+// * privateKey       : (optional) an unlocked private keyring to include signature in the message.
+// * output           : The encrypted data as PGPMessage.
+func (keyRing *KeyRing) EncryptWithHiddenRecipients(
+	message *PlainMessage,
+	hiddenRecipients *KeyRing,
+	privateKey *KeyRing,
+) (*PGPMessage, error) {
+	if hiddenRecipients == nil {
+		return nil, errors.New("gopenpgp: no hidden recipient provided")
+	}
+
+	sk, err := GenerateSessionKeyAlgo(constants.AES256)
+	if err != nil {
+		return nil, err
+	}
+	defer sk.Clear()
+
+	var keyPackets []byte
+	if keyRing != nil {
+		if keyPackets, err = keyRing.EncryptSessionKey(sk); err != nil {
+			return nil, err
+		}
+	}
+	hiddenKeyPackets, err := hiddenRecipients.EncryptSessionKeyToHiddenRecipients(sk)
+	if err != nil {
+		return nil, err
+	}
+	keyPackets = append(keyPackets, hiddenKeyPackets...)
+
+	dataPacket, err := sk.EncryptAndSign(message, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPGPSplitMessage(keyPackets, dataPacket).GetPGPMessage(), nil
 }
 
 // Decrypt decrypts encrypted string using pgp keys, returning a PlainMessage
@@ -60,6 +132,76 @@ func (keyRing *KeyRing) Decrypt(
 	return asymmetricDecrypt(message.NewReader(), keyRing, verifyKey, verifyTime, nil)
 }
 
+// DecryptAndGetSessionKey decrypts encrypted string using pgp keys, returning
+// a DecryptionResult with the PlainMessage, its session key, and the ID of the
+// key that decrypted the session key.
+// * message    : The encrypted input as a PGPMessage
+// * verifyKey  : Public key for signature verification (optional)
+// * verifyTime : Time at verification (necessary only if verifyKey is not nil)
+//
+// When verifyKey is not provided, then verifyTime should be zero, and
+// signature verification will be ignored. If the signature verification
+// fails, the DecryptionResult is returned along with the error.
+func (keyRing *KeyRing) DecryptAndGetSessionKey(
+	message *PGPMessage, verifyKey *KeyRing, verifyTime int64,
+) (*DecryptionResult, error) {
+	plainMessageReader, err := decryptStream(keyRing, message.NewReader(), verifyKey, verifyTime, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	plainMessage, err := readPlainMessage(plainMessageReader)
+	if err != nil {
+		return nil, err
+	}
+
+	sk, err := plainMessageReader.GetSessionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DecryptionResult{
+		Message:    plainMessage,
+		SessionKey: sk,
+		KeyID:      plainMessageReader.details.DecryptedWith.PublicKey.KeyId,
+	}
+
+	if verifyKey != nil {
+		err = plainMessageReader.VerifySignature()
+	}
+	return result, err
+}
+
+// DecryptWithIntendedRecipientCheck decrypts encrypted string using pgp keys,
+// returning a PlainMessage, like Decrypt. The signature verification also
+// fails, with status constants.SIGNATURE_BAD_RECIPIENT, if the signature lists
+// intended recipients and the decryption key isn't one of them, which happens
+// when a recipient forwards the signed message to a third party.
+// * message    : The encrypted input as a PGPMessage
+// * verifyKey  : Public key for signature verification (optional)
+// * verifyTime : Time at verification (necessary only if verifyKey is not nil)
+//
+// When verifyKey is not provided, then verifyTime should be zero, and
+// signature verification will be ignored.
+func (keyRing *KeyRing) DecryptWithIntendedRecipientCheck(
+	message *PGPMessage, verifyKey *KeyRing, verifyTime int64,
+) (*PlainMessage, error) {
+	plainMessageReader, err := decryptStream(keyRing, message.NewReader(), verifyKey, verifyTime, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	plainMessage, err := readPlainMessage(plainMessageReader)
+	if err != nil {
+		return nil, err
+	}
+
+	if verifyKey != nil {
+		err = plainMessageReader.VerifySignatureAndIntendedRecipient()
+	}
+	return plainMessage, err
+}
+
 // DecryptWithContext decrypts encrypted string using pgp keys, returning a PlainMessage
 // * message    : The encrypted input as a PGPMessage
 // * verifyKey  : Public key for signature verification (optional)
@@ -201,6 +343,8 @@ func asymmetricEncrypt(
 	publicKey, privateKey *KeyRing,
 	compress bool,
 	signingContext *SigningContext,
+	padding *PaddingPolicy,
+	intendedRecipients bool,
 ) (*PGPMessage, error) {
 	var outBuf bytes.Buffer
 	var encryptWriter io.WriteCloser
@@ -212,7 +356,7 @@ func asymmetricEncrypt(
 		ModTime:  plainMessage.getFormattedTime(),
 	}
 
-	encryptWriter, err = asymmetricEncryptStream(hints, &outBuf, &outBuf, publicKey, privateKey, compress, signingContext)
+	encryptWriter, err = asymmetricEncryptStream(hints, &outBuf, &outBuf, publicKey, privateKey, compress, signingContext, padding, intendedRecipients)
 	if err != nil {
 		return nil, err
 	}
@@ -238,10 +382,13 @@ func asymmetricEncryptStream(
 	publicKey, privateKey *KeyRing,
 	compress bool,
 	signingContext *SigningContext,
+	padding *PaddingPolicy,
+	intendedRecipients bool,
 ) (encryptWriter io.WriteCloser, err error) {
 	config := &packet.Config{
-		DefaultCipher: packet.CipherAES256,
-		Time:          getTimeGenerator(),
+		DefaultCipher:                         packet.CipherAES256,
+		Time:                                  getTimeGenerator(),
+		NonDeterministicSignaturesViaNotation: &saltNotation,
 	}
 
 	if compress {
@@ -262,6 +409,14 @@ func asymmetricEncryptStream(
 		}
 	}
 
+	if padding != nil || intendedRecipients && signEntity != nil {
+		// openpgp.EncryptSplit can neither pad the message nor list the
+		// intended recipients in the signature
+		return encryptSplitWithSessionKey(
+			hints, keyPacketWriter, dataPacketWriter, publicKey.entities, signEntity, config, padding, intendedRecipients,
+		)
+	}
+
 	if hints.IsBinary {
 		encryptWriter, err = openpgp.EncryptSplit(keyPacketWriter, dataPacketWriter, publicKey.entities, signEntity, hints, config)
 	} else {
@@ -273,6 +428,22 @@ func asymmetricEncryptStream(
 	return encryptWriter, nil
 }
 
+// readPlainMessage reads the whole data of the decrypted message.
+func readPlainMessage(plainMessageReader *PlainMessageReader) (*PlainMessage, error) {
+	body, err := ioutil.ReadAll(plainMessageReader)
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in reading message body")
+	}
+
+	literalData := plainMessageReader.details.LiteralData
+	return &PlainMessage{
+		Data:     body,
+		TextType: !literalData.IsBinary,
+		Filename: literalData.FileName,
+		Time:     literalData.Time,
+	}, nil
+}
+
 // Core for decryption+verification (non streaming) functions.
 func asymmetricDecrypt(
 	encryptedIO io.Reader,
@@ -281,7 +452,7 @@ func asymmetricDecrypt(
 	verifyTime int64,
 	verificationContext *VerificationContext,
 ) (message *PlainMessage, err error) {
-	messageDetails, err := asymmetricDecryptStream(
+	messageDetails, _, err := asymmetricDecryptStream(
 		encryptedIO,
 		privateKey,
 		verifyKey,
@@ -310,14 +481,15 @@ func asymmetricDecrypt(
 	}, err
 }
 
-// Core for decryption+verification (all) functions.
+// Core for decryption+verification (all) functions. The session key is returned
+// when the message is encrypted.
 func asymmetricDecryptStream(
 	encryptedIO io.Reader,
 	privateKey *KeyRing,
 	verifyKey *KeyRing,
 	verifyTime int64,
 	verificationContext *VerificationContext,
-) (messageDetails *openpgp.MessageDetails, err error) {
+) (messageDetails *openpgp.MessageDetails, sk *SessionKey, err error) {
 	privKeyEntries := privateKey.entities
 	var additionalEntries openpgp.EntityList
 
@@ -347,9 +519,40 @@ func asymmetricDecryptStream(
 		config.KnownNotations = map[string]bool{constants.SignatureContextName: true}
 	}
 
-	messageDetails, err = openpgp.ReadMessage(encryptedIO, privKeyEntries, nil, config)
+	keyPackets, encryptedIO := readKeyPackets(encryptedIO)
+	messageReader := &countingReader{reader: encryptedIO, count: int64(len(keyPackets))}
+	limits := getDecryptionLimits()
+
+	if len(keyPackets) == 0 {
+		// Not encrypted to a key: go-crypto reads the message if it is not
+		// encrypted, or reports the error
+		var packets io.Reader
+		if packets, err = readCompressedLayers(messageReader, limits); err != nil {
+			return nil, nil, err
+		}
+		messageDetails, err = openpgp.ReadMessage(packets, privKeyEntries, nil, config)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "gopenpgp: error in reading message")
+		}
+		messageDetails.UnverifiedBody = newLimitedReader(messageDetails.UnverifiedBody, messageReader, limits)
+		return messageDetails, nil, nil
+	}
+
+	// The session key is decrypted first, so that the decrypted packets are
+	// read within the decryption limits
+	sk, decryptionKey, err := decryptSessionKeyWithEntities(keyPackets, privateKey.entities)
+	if err != nil {
+		if IsDecryptionLimitError(err) {
+			return nil, nil, err
+		}
+		return nil, nil, errors.Wrap(pgpErrors.ErrKeyIncorrect, "gopenpgp: error in reading message")
+	}
+
+	messageDetails, err = decryptStreamWithSessionKeyAndConfig(sk, messageReader, privKeyEntries, config)
 	if err != nil {
-		return nil, errors.Wrap(err, "gopenpgp: error in reading message")
+		return nil, nil, errors.Wrap(err, "gopenpgp: error in reading message")
 	}
-	return messageDetails, err
+	messageDetails.EncryptedToKeyIds, _ = (&PGPMessage{Data: keyPackets}).GetEncryptionKeyIDs()
+	messageDetails.DecryptedWith = decryptionKey
+	return messageDetails, sk, nil
 }
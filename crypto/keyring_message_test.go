@@ -1,10 +1,14 @@
 package crypto
 
 import (
+	"bytes"
 	"io/ioutil"
 	"testing"
 
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
 )
 
 func TestAEADKeyRingDecryption(t *testing.T) {
@@ -78,3 +82,236 @@ func TestTextMessageEncryptionWithSignatureAndContextAndCompression(t *testing.T
 	}
 	assert.Exactly(t, message.GetString(), decrypted.GetString())
 }
+
+func TestDecryptAndGetSessionKey(t *testing.T) {
+	var message = NewPlainMessageFromString("The secret code is... 1, 2, 3, 4, 5")
+
+	ciphertext, err := keyRingTestPublic.Encrypt(message, keyRingTestPrivate)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	result, err := keyRingTestPrivate.DecryptAndGetSessionKey(ciphertext, keyRingTestPublic, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), result.Message.GetString())
+	assert.False(t, result.IsPasswordDecrypted)
+
+	keyIDs, ok := ciphertext.GetHexEncryptionKeyIDs()
+	assert.True(t, ok)
+	assert.Contains(t, keyIDs, result.GetHexKeyID())
+
+	split, err := ciphertext.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error when splitting, got:", err)
+	}
+	sk, err := keyRingTestPrivate.DecryptSessionKey(split.GetBinaryKeyPacket())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting the session key, got:", err)
+	}
+	assert.Exactly(t, sk, result.SessionKey)
+}
+
+func TestEncryptWithHiddenRecipients(t *testing.T) {
+	var message = NewPlainMessageFromString("The secret code is... 1, 2, 3, 4, 5")
+
+	hiddenKeyRing, err := NewKeyRing(keyTestEC)
+	if err != nil {
+		t.Fatal("Expected no error when building the keyring, got:", err)
+	}
+	ciphertext, err := keyRingTestPublic.EncryptWithHiddenRecipients(message, hiddenKeyRing, keyRingTestPrivate)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	keyIDs, ok := ciphertext.GetEncryptionKeyIDs()
+	assert.True(t, ok)
+	assert.Len(t, keyIDs, 2)
+	assert.Contains(t, keyIDs, uint64(0))
+	assert.True(t, ciphertext.HasHiddenRecipients())
+
+	for _, keyRing := range []*KeyRing{keyRingTestPrivate, hiddenKeyRing} {
+		decrypted, err := keyRing.Decrypt(ciphertext, keyRingTestPublic, GetUnixTime())
+		if err != nil {
+			t.Fatal("Expected no error when decrypting, got:", err)
+		}
+		assert.Exactly(t, message.GetString(), decrypted.GetString())
+	}
+
+	split, err := ciphertext.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error when splitting, got:", err)
+	}
+	sk, err := hiddenKeyRing.DecryptSessionKey(split.GetBinaryKeyPacket())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting the session key, got:", err)
+	}
+	result, err := hiddenKeyRing.DecryptAndGetSessionKey(ciphertext, nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, sk, result.SessionKey)
+
+	otherKeyRing, err := NewKeyRing(keyTestRSA)
+	if err != nil {
+		t.Fatal("Expected no error when building the keyring, got:", err)
+	}
+	_, err = otherKeyRing.Decrypt(ciphertext, nil, 0)
+	assert.NotNil(t, err)
+
+	visibleOnly, err := keyRingTestPublic.Encrypt(message, nil)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	assert.False(t, visibleOnly.HasHiddenRecipients())
+}
+
+func TestDecryptWithIntendedRecipientCheck(t *testing.T) {
+	var message = NewPlainMessageFromString("The secret code is... 1, 2, 3, 4, 5")
+
+	recipientKeyRing, err := NewKeyRing(keyTestEC)
+	if err != nil {
+		t.Fatal("Expected no error when building the keyring, got:", err)
+	}
+	thirdPartyKeyRing, err := NewKeyRing(keyTestRSA)
+	if err != nil {
+		t.Fatal("Expected no error when building the keyring, got:", err)
+	}
+
+	ciphertext, err := recipientKeyRing.EncryptWithIntendedRecipients(message, keyRingTestPrivate)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	sig := readEmbeddedSignature(t, recipientKeyRing, ciphertext)
+	assert.Len(t, sig.IntendedRecipients, 1)
+	assert.Exactly(t, recipientKeyRing.entities[0].PrimaryKey.Version, sig.IntendedRecipients[0].KeyVersion)
+	assert.Exactly(t, recipientKeyRing.entities[0].PrimaryKey.Fingerprint, sig.IntendedRecipients[0].Fingerprint)
+
+	decrypted, err := recipientKeyRing.DecryptWithIntendedRecipientCheck(ciphertext, keyRingTestPublic, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+
+	// The recipient forwards the signed message to a third party
+	split, err := ciphertext.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error when splitting, got:", err)
+	}
+	sk, err := recipientKeyRing.DecryptSessionKey(split.GetBinaryKeyPacket())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting the session key, got:", err)
+	}
+	keyPacket, err := thirdPartyKeyRing.EncryptSessionKey(sk)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting the session key, got:", err)
+	}
+	forwarded := NewPGPSplitMessage(keyPacket, split.GetBinaryDataPacket()).GetPGPMessage()
+
+	_, err = thirdPartyKeyRing.Decrypt(forwarded, keyRingTestPublic, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting without the check, got:", err)
+	}
+	decrypted, err = thirdPartyKeyRing.DecryptWithIntendedRecipientCheck(forwarded, keyRingTestPublic, GetUnixTime())
+	checkVerificationError(t, err, constants.SIGNATURE_BAD_RECIPIENT)
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+
+	// Signatures without intended recipients are accepted
+	dataPacket, err := sk.EncryptAndSign(message, keyRingTestPrivate)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	withoutRecipients := NewPGPSplitMessage(keyPacket, dataPacket).GetPGPMessage()
+	_, err = thirdPartyKeyRing.DecryptWithIntendedRecipientCheck(withoutRecipients, keyRingTestPublic, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+
+	// Encrypt doesn't list the intended recipients unless asked to
+	ciphertext, err = recipientKeyRing.Encrypt(message, keyRingTestPrivate)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	assert.Empty(t, readEmbeddedSignature(t, recipientKeyRing, ciphertext).IntendedRecipients)
+}
+
+func TestEncryptStreamWithIntendedRecipients(t *testing.T) {
+	var message = NewPlainMessageFromString("The secret code is... 1, 2, 3, 4, 5")
+
+	var ciphertext bytes.Buffer
+	plainMessageWriter, err := keyRingTestPublic.EncryptStreamWithIntendedRecipients(&ciphertext, nil, keyRingTestPrivate)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	if _, err = plainMessageWriter.Write(message.GetBinary()); err != nil {
+		t.Fatal("Expected no error when writing, got:", err)
+	}
+	if err = plainMessageWriter.Close(); err != nil {
+		t.Fatal("Expected no error when closing, got:", err)
+	}
+
+	decrypted, err := keyRingTestPrivate.DecryptWithIntendedRecipientCheck(
+		NewPGPMessage(ciphertext.Bytes()), keyRingTestPublic, GetUnixTime(),
+	)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+	assert.Len(t, readEmbeddedSignature(t, keyRingTestPrivate, NewPGPMessage(ciphertext.Bytes())).IntendedRecipients, 1)
+
+	_, err = keyRingTestPublic.EncryptStreamWithIntendedRecipients(&ciphertext, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestEncryptStreamWithIntendedRecipientsText(t *testing.T) {
+	for _, isBinary := range []bool{false, true} {
+		var ciphertext bytes.Buffer
+		plainMessageWriter, err := keyRingTestPublic.EncryptStreamWithIntendedRecipients(
+			&ciphertext, NewPlainMessageMetadata(isBinary, "", GetUnixTime()), keyRingTestPrivate,
+		)
+		if err != nil {
+			t.Fatal("Expected no error when encrypting, got:", err)
+		}
+		// The line ending is split across writes
+		for _, data := range []string{"first line\r", "\nsecond line\n", "third line\n"} {
+			if _, err = plainMessageWriter.Write([]byte(data)); err != nil {
+				t.Fatal("Expected no error when writing, got:", err)
+			}
+		}
+		if err = plainMessageWriter.Close(); err != nil {
+			t.Fatal("Expected no error when closing, got:", err)
+		}
+
+		decrypted, err := keyRingTestPrivate.DecryptWithIntendedRecipientCheck(
+			NewPGPMessage(ciphertext.Bytes()), keyRingTestPublic, GetUnixTime(),
+		)
+		if err != nil {
+			t.Fatal("Expected no error when decrypting, got:", err)
+		}
+		sig := readEmbeddedSignature(t, keyRingTestPrivate, NewPGPMessage(ciphertext.Bytes()))
+		assert.Exactly(t, isBinary, decrypted.IsBinary())
+		if isBinary {
+			assert.Exactly(t, packet.SigTypeBinary, sig.SigType)
+			assert.Exactly(t, "first line\r\nsecond line\nthird line\n", string(decrypted.GetBinary()))
+		} else {
+			assert.Exactly(t, packet.SigTypeText, sig.SigType)
+			assert.Exactly(t, "first line\r\nsecond line\r\nthird line\r\n", string(decrypted.GetBinary()))
+		}
+	}
+}
+
+// readEmbeddedSignature decrypts the message and returns its signature.
+func readEmbeddedSignature(t *testing.T, keyRing *KeyRing, message *PGPMessage) *packet.Signature {
+	plainMessageReader, err := keyRing.DecryptStream(message.NewReader(), keyRingTestPublic, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	if _, err = ioutil.ReadAll(plainMessageReader); err != nil {
+		t.Fatal("Expected no error when reading, got:", err)
+	}
+	if err = plainMessageReader.VerifySignature(); err != nil {
+		t.Fatal("Expected no error when verifying, got:", err)
+	}
+	return plainMessageReader.details.Signature
+}
@@ -0,0 +1,228 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+// EncryptWithPasswords encrypts a PlainMessage to the keys of the keyring and
+// with each of the passwords, outputs a PGPMessage. The public-key and
+// symmetric-key encrypted session key packets all encrypt the same session
+// key, so that the message can be decrypted with any of the private keys or
+// passwords. The keyring can be nil to encrypt with passwords only.
+// * message    : The plaintext input as a PlainMessage.
+// * passwords  : The passwords that will be derived into encryption keys.
+// * privateKey : (optional) an unlocked private keyring to include signature in the message.
+func (keyRing *KeyRing) EncryptWithPasswords(
+	message *PlainMessage,
+	passwords [][]byte,
+	privateKey *KeyRing,
+) (*PGPMessage, error) {
+	var outBuf bytes.Buffer
+
+	encryptWriter, err := encryptStreamWithPasswords(
+		keyRing,
+		&outBuf,
+		&outBuf,
+		NewPlainMessageMetadata(message.IsBinary(), message.Filename, int64(message.Time)),
+		passwords,
+		privateKey,
+	)
+	if err != nil {
+		return nil, err
+	}
+	_, err = encryptWriter.Write(message.GetBinary())
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in writing message")
+	}
+	err = encryptWriter.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in closing encryption writer")
+	}
+
+	return NewPGPMessage(outBuf.Bytes()), nil
+}
+
+// EncryptSplitStreamWithPasswords is used to encrypt data as a stream to the
+// keys of the keyring and with each of the passwords.
+// It takes a writer for the Symmetrically Encrypted Data Packet
+// (https://datatracker.ietf.org/doc/html/rfc4880#section-5.7)
+// and returns a writer for the plaintext data and the key packets.
+// If signKeyRing is not nil, it is used to do an embedded signature.
+func (keyRing *KeyRing) EncryptSplitStreamWithPasswords(
+	dataPacketWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	passwords [][]byte,
+	signKeyRing *KeyRing,
+) (*EncryptSplitResult, error) {
+	var keyPacketBuf bytes.Buffer
+	plainMessageWriter, err := encryptStreamWithPasswords(
+		keyRing,
+		&keyPacketBuf,
+		dataPacketWriter,
+		plainMessageMetadata,
+		passwords,
+		signKeyRing,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptSplitResult{
+		keyPacketBuf:       &keyPacketBuf,
+		plainMessageWriter: plainMessageWriter,
+	}, nil
+}
+
+// DecryptWithKeyRingOrPassword decrypts a message encrypted to public keys
+// and passwords, returning a PlainMessage. The session key is decrypted with
+// the keyring if it is not nil, and otherwise, or if it fails, with the
+// password.
+// * message    : The encrypted input as a PGPMessage
+// * keyRing    : (optional) an unlocked private keyring
+// * password   : (optional) a password of the message
+// * verifyKey  : Public key for signature verification (optional)
+// * verifyTime : Time at verification (necessary only if verifyKey is not nil)
+func DecryptWithKeyRingOrPassword(
+	message *PGPMessage,
+	keyRing *KeyRing,
+	password []byte,
+	verifyKey *KeyRing,
+	verifyTime int64,
+) (*PlainMessage, error) {
+	split, err := message.SplitMessage()
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in splitting message")
+	}
+
+	if keyRing == nil && password == nil {
+		return nil, errors.New("gopenpgp: no decryption key ring or password provided")
+	}
+
+	if keyRing != nil {
+		sk, err := keyRing.DecryptSessionKey(split.GetBinaryKeyPacket())
+		if err == nil {
+			defer sk.Clear()
+			return sk.DecryptAndVerify(split.GetBinaryDataPacket(), verifyKey, verifyTime)
+		}
+		if password == nil {
+			return nil, err
+		}
+	}
+
+	// A wrong password may decrypt a session key packet to a wrong session
+	// key, so the data packet is decrypted with each candidate in turn
+	sessionKeys, _, err := decryptSessionKeysWithPassword(split.GetBinaryKeyPacket(), password)
+	if err != nil {
+		return nil, err
+	}
+	var plainMessage *PlainMessage
+	for _, sk := range sessionKeys {
+		plainMessage, err = sk.DecryptAndVerify(split.GetBinaryDataPacket(), verifyKey, verifyTime)
+		sk.Clear()
+		var signatureErr SignatureVerificationError
+		if err == nil || errors.As(err, &signatureErr) {
+			break
+		}
+	}
+	return plainMessage, err
+}
+
+// DecryptSplitStreamWithKeyRingOrPassword is used to decrypt a split pgp
+// message encrypted to public keys and passwords as a Reader.
+// It takes the key packets and a reader for the data packet
+// and returns a PlainMessageReader for the plaintext data.
+// The session key is decrypted with the keyring if it is not nil, and
+// otherwise, or if it fails, with the password. If the password decrypts
+// several key packets, the data packet is buffered in memory, to check each of
+// their session keys against the whole data packet.
+// If verifyKeyRing is not nil, PlainMessageReader.VerifySignature() will
+// verify the embedded signature with the given key ring and verification time.
+func DecryptSplitStreamWithKeyRingOrPassword(
+	keyPacket []byte,
+	dataPacketReader Reader,
+	keyRing *KeyRing,
+	password []byte,
+	verifyKeyRing *KeyRing,
+	verifyTime int64,
+) (plainMessage *PlainMessageReader, err error) {
+	if keyRing == nil && password == nil {
+		return nil, errors.New("gopenpgp: no decryption key ring or password provided")
+	}
+
+	if keyRing != nil {
+		sk, err := keyRing.DecryptSessionKey(keyPacket)
+		if err == nil {
+			return decryptStreamWithSessionKeyAndContext(sk, dataPacketReader, verifyKeyRing, verifyTime, nil)
+		}
+		if password == nil {
+			return nil, err
+		}
+	}
+
+	// A wrong password may decrypt a session key packet to a wrong session
+	// key, so the session keys are tried in turn on the data packet
+	sessionKeys, _, err := decryptSessionKeysWithPassword(keyPacket, password)
+	if err != nil {
+		return nil, err
+	}
+	sk, dataPacketReader, err := selectStreamSessionKey(sessionKeys, dataPacketReader, func(sk *SessionKey, dataPacketReader io.Reader) (io.Reader, error) {
+		return decryptStreamWithSessionKeyAndContext(sk, dataPacketReader, nil, 0, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return decryptStreamWithSessionKeyAndContext(sk, dataPacketReader, verifyKeyRing, verifyTime, nil)
+}
+
+// --- Internal methods
+
+// encryptStreamWithPasswords writes the key packets encrypting a random
+// session key to the keys of the keyring and with the passwords, and returns
+// the writer of the data packet encrypted with the session key.
+func encryptStreamWithPasswords(
+	keyRing *KeyRing,
+	keyPacketWriter Writer,
+	dataPacketWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	passwords [][]byte,
+	signKeyRing *KeyRing,
+) (plainMessageWriter WriteCloser, err error) {
+	if keyRing == nil && len(passwords) == 0 {
+		return nil, errors.New("gopenpgp: no encryption key ring or password provided")
+	}
+
+	sk, err := GenerateSessionKeyAlgo(constants.AES256)
+	if err != nil {
+		return nil, err
+	}
+	defer sk.Clear()
+
+	keyPackets := make([][]byte, 0, len(passwords)+1)
+	if keyRing != nil {
+		keyPacket, err := keyRing.EncryptSessionKey(sk)
+		if err != nil {
+			return nil, err
+		}
+		keyPackets = append(keyPackets, keyPacket)
+	}
+	for _, password := range passwords {
+		keyPacket, err := EncryptSessionKeyWithPassword(sk, password)
+		if err != nil {
+			return nil, err
+		}
+		keyPackets = append(keyPackets, keyPacket)
+	}
+
+	for _, keyPacket := range keyPackets {
+		if _, err = keyPacketWriter.Write(keyPacket); err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in writing key packet")
+		}
+	}
+
+	return sk.encryptStream(dataPacketWriter, plainMessageMetadata, signKeyRing, false, nil, nil)
+}
@@ -0,0 +1,212 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+func TestEncryptWithPasswords(t *testing.T) {
+	message := NewPlainMessageFromString("shared with the owner and a password")
+	passwords := [][]byte{[]byte("first password"), []byte("second password")}
+
+	encrypted, err := keyRingTestPublic.EncryptWithPasswords(message, passwords, nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+
+	var publicKeyPackets, symmetricKeyPackets int
+	packets := packet.NewReader(bytes.NewReader(encrypted.GetBinary()))
+	for p, err := packets.Next(); err == nil; p, err = packets.Next() {
+		switch p.(type) {
+		case *packet.EncryptedKey:
+			publicKeyPackets++
+		case *packet.SymmetricKeyEncrypted:
+			symmetricKeyPackets++
+		}
+	}
+	assert.Exactly(t, len(keyRingTestPublic.entities), publicKeyPackets)
+	assert.Exactly(t, 2, symmetricKeyPackets)
+
+	decrypted, err := keyRingTestPrivate.Decrypt(encrypted, nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting with key ring, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+
+	for _, password := range passwords {
+		decrypted, err = DecryptMessageWithPassword(encrypted, password)
+		if err != nil {
+			t.Fatal("Expected no error while decrypting with password, got:", err)
+		}
+		assert.Exactly(t, message.GetString(), decrypted.GetString())
+	}
+
+	otherKeyRing, err := NewKeyRing(keyTestEC)
+	if err != nil {
+		t.Fatal("Expected no error while building key ring, got:", err)
+	}
+	for _, keyRing := range []*KeyRing{keyRingTestPrivate, otherKeyRing, nil} {
+		decrypted, err = DecryptWithKeyRingOrPassword(encrypted, keyRing, passwords[1], nil, 0)
+		if err != nil {
+			t.Fatal("Expected no error while decrypting with key ring or password, got:", err)
+		}
+		assert.Exactly(t, message.GetString(), decrypted.GetString())
+	}
+
+	_, err = DecryptWithKeyRingOrPassword(encrypted, otherKeyRing, []byte("wrong password"), nil, 0)
+	assert.Error(t, err)
+	_, err = DecryptWithKeyRingOrPassword(encrypted, nil, nil, nil, 0)
+	assert.Error(t, err)
+
+	_, err = (*KeyRing)(nil).EncryptWithPasswords(message, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestEncryptSplitStreamWithPasswords(t *testing.T) {
+	messageBytes := []byte("Hello World!")
+	password := []byte("shared password")
+
+	var dataPacketBuf bytes.Buffer
+	encryptResult, err := keyRingTestPublic.EncryptSplitStreamWithPasswords(
+		&dataPacketBuf,
+		testMeta,
+		[][]byte{password},
+		keyRingTestPrivate,
+	)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting split stream, got:", err)
+	}
+	if _, err = encryptResult.Write(messageBytes); err != nil {
+		t.Fatal("Expected no error while writing data, got:", err)
+	}
+	if err = encryptResult.Close(); err != nil {
+		t.Fatal("Expected no error while closing plaintext writer, got:", err)
+	}
+	keyPacket, err := encryptResult.GetKeyPacket()
+	if err != nil {
+		t.Fatal("Expected no error while accessing key packet, got:", err)
+	}
+
+	for _, decrypt := range []func() (*PlainMessageReader, error){
+		func() (*PlainMessageReader, error) {
+			return keyRingTestPrivate.DecryptSplitStream(keyPacket, bytes.NewReader(dataPacketBuf.Bytes()), keyRingTestPublic, GetUnixTime())
+		},
+		func() (*PlainMessageReader, error) {
+			return DecryptSplitStreamWithKeyRingOrPassword(keyPacket, bytes.NewReader(dataPacketBuf.Bytes()), nil, password, keyRingTestPublic, GetUnixTime())
+		},
+	} {
+		decryptedReader, err := decrypt()
+		if err != nil {
+			t.Fatal("Expected no error while decrypting split stream, got:", err)
+		}
+		decryptedBytes, err := ioutil.ReadAll(decryptedReader)
+		if err != nil {
+			t.Fatal("Expected no error while reading the decrypted data, got:", err)
+		}
+		assert.Exactly(t, messageBytes, decryptedBytes)
+		assert.NoError(t, decryptedReader.VerifySignature())
+	}
+}
+
+func TestDecryptWithPasswordWrongCandidateSessionKey(t *testing.T) {
+	var message = NewPlainMessageFromString("The secret code is... 1, 2, 3, 4, 5")
+	sk, err := GenerateSessionKeyAlgo(constants.AES256)
+	if err != nil {
+		t.Fatal("Expected no error while generating session key, got:", err)
+	}
+	dataPacket, err := sk.Encrypt(message)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+
+	// Find a key packet for another password which the password decrypts to
+	// a wrong session key
+	var wrongKeyPacket []byte
+	for i := 0; i < 10000 && wrongKeyPacket == nil; i++ {
+		keyPacket, err := EncryptSessionKeyWithPasswordAndS2K(sk, []byte("other password"), NewIteratedS2KParams(65536))
+		if err != nil {
+			t.Fatal("Expected no error while encrypting session key, got:", err)
+		}
+		if _, err = DecryptSessionKeyWithPassword(keyPacket, testSymmetricKey); err == nil {
+			wrongKeyPacket = keyPacket
+		}
+	}
+	if wrongKeyPacket == nil {
+		t.Fatal("Expected to find a key packet decrypting to a wrong session key")
+	}
+	keyPacket, err := EncryptSessionKeyWithPassword(sk, testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting session key, got:", err)
+	}
+	encrypted := NewPGPSplitMessage(append(wrongKeyPacket, keyPacket...), dataPacket).GetPGPMessage()
+
+	decrypted, err := DecryptMessageWithPassword(encrypted, testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting with password, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+
+	decrypted, err = DecryptWithKeyRingOrPassword(encrypted, nil, testSymmetricKey, nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting with password, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+
+	for _, decrypt := range []func() (*PlainMessageReader, error){
+		func() (*PlainMessageReader, error) {
+			return DecryptStreamWithPassword(bytes.NewReader(encrypted.GetBinary()), testSymmetricKey)
+		},
+		func() (*PlainMessageReader, error) {
+			return DecryptSplitStreamWithKeyRingOrPassword(
+				append(wrongKeyPacket, keyPacket...), bytes.NewReader(dataPacket), nil, testSymmetricKey, nil, 0,
+			)
+		},
+	} {
+		decryptedReader, err := decrypt()
+		if err != nil {
+			t.Fatal("Expected no error while decrypting stream with password, got:", err)
+		}
+		decryptedBytes, err := ioutil.ReadAll(decryptedReader)
+		if err != nil {
+			t.Fatal("Expected no error while reading the decrypted data, got:", err)
+		}
+		assert.Exactly(t, message.GetBinary(), decryptedBytes)
+	}
+}
+
+func TestSelectStreamSessionKeyIntegrityAtEnd(t *testing.T) {
+	wrongSessionKey := &SessionKey{Key: []byte("wrong"), Algo: constants.AES256}
+	sessionKey := &SessionKey{Key: []byte("right"), Algo: constants.AES256}
+	dataPacket := []byte("data packet")
+
+	sk, dataPacketReader, err := selectStreamSessionKey(
+		[]*SessionKey{wrongSessionKey, sessionKey},
+		bytes.NewReader(dataPacket),
+		func(sk *SessionKey, dataPacketReader io.Reader) (io.Reader, error) {
+			if sk == wrongSessionKey {
+				// The start of the data packet decrypts, the integrity check
+				// fails at its end
+				return io.MultiReader(dataPacketReader, iotest.ErrReader(errors.New("integrity check failed"))), nil
+			}
+			return dataPacketReader, nil
+		},
+	)
+	if err != nil {
+		t.Fatal("Expected no error while selecting the session key, got:", err)
+	}
+	assert.Exactly(t, sessionKey, sk)
+	read, err := ioutil.ReadAll(dataPacketReader)
+	if err != nil {
+		t.Fatal("Expected no error while reading the data packet, got:", err)
+	}
+	assert.Exactly(t, dataPacket, read)
+}
@@ -2,25 +2,40 @@ package crypto
 
 import (
 	"bytes"
+	goerrors "errors"
+	"io"
 	"strconv"
 
 	"github.com/pkg/errors"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
 )
 
 // DecryptSessionKey returns the decrypted session key from one or multiple binary encrypted session key packets.
 func (keyRing *KeyRing) DecryptSessionKey(keyPacket []byte) (*SessionKey, error) {
+	sk, _, err := decryptSessionKeyWithEntities(keyPacket, keyRing.entities)
+	return sk, err
+}
+
+// decryptSessionKeyWithEntities returns the decrypted session key from the key
+// packets, and the key of the entities that decrypted it.
+func decryptSessionKeyWithEntities(keyPacket []byte, entities openpgp.EntityList) (*SessionKey, openpgp.Key, error) {
 	var p packet.Packet
 	var ek *packet.EncryptedKey
+	var decryptionKey openpgp.Key
 
 	var err error
 	var hasPacket = false
 	var decryptErr error
+	var keyPacketCount = 0
+	limits := getDecryptionLimits()
 
 	keyReader := bytes.NewReader(keyPacket)
 	packets := packet.NewReader(keyReader)
 
+	decryptionKeys := entities.DecryptionKeys()
+
 Loop:
 	for {
 		if p, err = packets.Next(); err != nil {
@@ -32,13 +47,25 @@ Loop:
 			hasPacket = true
 			ek = p
 
-			for _, key := range keyRing.entities.DecryptionKeys() {
+			keyPacketCount++
+			if err = checkKeyPacketCount(keyPacketCount, limits); err != nil {
+				return nil, openpgp.Key{}, err
+			}
+
+			for _, key := range decryptionKeys {
 				priv := key.PrivateKey
 				if priv.Encrypted {
 					continue
 				}
+				// Wildcard key IDs of hidden recipients match any key of the
+				// same algorithm
+				if ek.KeyId != 0 && ek.KeyId != priv.KeyId ||
+					ek.KeyId == 0 && ek.Algo != priv.PubKeyAlgo {
+					continue
+				}
 
 				if decryptErr = ek.Decrypt(priv, nil); decryptErr == nil {
+					decryptionKey = key
 					break Loop
 				}
 			}
@@ -56,21 +83,25 @@ Loop:
 
 	if !hasPacket {
 		if err != nil {
-			return nil, errors.Wrap(err, "gopenpgp: couldn't find a session key packet")
+			return nil, openpgp.Key{}, errors.Wrap(err, "gopenpgp: couldn't find a session key packet")
 		} else {
-			return nil, errors.New("gopenpgp: couldn't find a session key packet")
+			return nil, openpgp.Key{}, errors.New("gopenpgp: couldn't find a session key packet")
 		}
 	}
 
 	if decryptErr != nil {
-		return nil, errors.Wrap(decryptErr, "gopenpgp: error in decrypting")
+		return nil, openpgp.Key{}, errors.Wrap(decryptErr, "gopenpgp: error in decrypting")
 	}
 
 	if ek == nil || ek.Key == nil {
-		return nil, errors.New("gopenpgp: unable to decrypt session key: no valid decryption key")
+		return nil, openpgp.Key{}, errors.New("gopenpgp: unable to decrypt session key: no valid decryption key")
 	}
 
-	return newSessionKeyFromEncrypted(ek)
+	sk, err := newSessionKeyFromEncrypted(ek)
+	if err != nil {
+		return nil, openpgp.Key{}, err
+	}
+	return sk, decryptionKey, nil
 }
 
 // EncryptSessionKey encrypts the session key with the unarmored
@@ -101,3 +132,33 @@ func (keyRing *KeyRing) EncryptSessionKey(sk *SessionKey) ([]byte, error) {
 	}
 	return outbuf.Bytes(), nil
 }
+
+// EncryptSessionKeyToHiddenRecipients encrypts the session key with the
+// unarmored publicKey like EncryptSessionKey, but hides the recipients: the
+// key packets have a wildcard (zero) key ID, and are decrypted by trying every
+// decryption key of the recipients.
+func (keyRing *KeyRing) EncryptSessionKeyToHiddenRecipients(sk *SessionKey) ([]byte, error) {
+	keyPacket, err := keyRing.EncryptSessionKey(sk)
+	if err != nil {
+		return nil, err
+	}
+
+	var hiddenKeyPacket bytes.Buffer
+	packets := packet.NewOpaqueReader(bytes.NewReader(keyPacket))
+	for {
+		p, err := packets.Next()
+		if goerrors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: unable to read key packet")
+		}
+		if _, ok := getPublicKeyEncryptedKeyID(p); ok {
+			copy(p.Contents[1:9], make([]byte, 8))
+		}
+		if err = p.Serialize(&hiddenKeyPacket); err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: cannot set key")
+		}
+	}
+	return hiddenKeyPacket.Bytes(), nil
+}
@@ -48,6 +48,8 @@ func (keyRing *KeyRing) EncryptStream(
 		signKeyRing,
 		false,
 		nil,
+		nil,
+		false,
 	)
 }
 
@@ -69,6 +71,8 @@ func (keyRing *KeyRing) EncryptStreamWithContext(
 		signKeyRing,
 		false,
 		signingContext,
+		nil,
+		false,
 	)
 }
 
@@ -89,6 +93,8 @@ func (keyRing *KeyRing) EncryptStreamWithCompression(
 		signKeyRing,
 		true,
 		nil,
+		nil,
+		false,
 	)
 }
 
@@ -111,6 +117,33 @@ func (keyRing *KeyRing) EncryptStreamWithContextAndCompression(
 		signKeyRing,
 		true,
 		signingContext,
+		nil,
+		false,
+	)
+}
+
+// EncryptStreamWithIntendedRecipients is used to encrypt data as a Writer.
+// It takes a writer for the encrypted data and returns a WriteCloser for the plaintext data.
+// The embedded signature of signKeyRing lists the fingerprints of the
+// recipients as intended recipients, see EncryptWithIntendedRecipients.
+func (keyRing *KeyRing) EncryptStreamWithIntendedRecipients(
+	pgpMessageWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	signKeyRing *KeyRing,
+) (plainMessageWriter WriteCloser, err error) {
+	if signKeyRing == nil {
+		return nil, errors.New("gopenpgp: no signing key provided")
+	}
+	return encryptStream(
+		keyRing,
+		pgpMessageWriter,
+		pgpMessageWriter,
+		plainMessageMetadata,
+		signKeyRing,
+		false,
+		nil,
+		nil,
+		true,
 	)
 }
 
@@ -122,6 +155,8 @@ func encryptStream(
 	signKeyRing *KeyRing,
 	compress bool,
 	signingContext *SigningContext,
+	padding *PaddingPolicy,
+	intendedRecipients bool,
 ) (plainMessageWriter WriteCloser, err error) {
 	if plainMessageMetadata == nil {
 		// Use sensible default metadata
@@ -138,7 +173,7 @@ func encryptStream(
 		ModTime:  time.Unix(plainMessageMetadata.ModTime, 0),
 	}
 
-	plainMessageWriter, err = asymmetricEncryptStream(hints, keyPacketWriter, dataPacketWriter, encryptionKeyRing, signKeyRing, compress, signingContext)
+	plainMessageWriter, err = asymmetricEncryptStream(hints, keyPacketWriter, dataPacketWriter, encryptionKeyRing, signKeyRing, compress, signingContext, padding, intendedRecipients)
 	if err != nil {
 		return nil, err
 	}
@@ -176,6 +211,33 @@ func (res *EncryptSplitResult) GetKeyPacket() (keyPacket []byte, err error) {
 	return res.keyPacket, nil
 }
 
+// EncryptStreamWithPadding is used to encrypt data as a Writer.
+// It takes a writer for the encrypted data and returns a WriteCloser for the plaintext data.
+// The encrypted data is padded as described by the padding policy, to hide
+// the length of the plaintext.
+// If signKeyRing is not nil, it is used to do an embedded signature.
+func (keyRing *KeyRing) EncryptStreamWithPadding(
+	pgpMessageWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	signKeyRing *KeyRing,
+	padding *PaddingPolicy,
+) (plainMessageWriter WriteCloser, err error) {
+	if padding == nil {
+		return nil, errors.New("gopenpgp: no padding policy provided")
+	}
+	return encryptStream(
+		keyRing,
+		pgpMessageWriter,
+		pgpMessageWriter,
+		plainMessageMetadata,
+		signKeyRing,
+		false,
+		nil,
+		padding,
+		false,
+	)
+}
+
 // EncryptSplitStream is used to encrypt data as a stream.
 // It takes a writer for the Symmetrically Encrypted Data Packet
 // (https://datatracker.ietf.org/doc/html/rfc4880#section-5.7)
@@ -193,6 +255,34 @@ func (keyRing *KeyRing) EncryptSplitStream(
 		signKeyRing,
 		false,
 		nil,
+		nil,
+	)
+}
+
+// EncryptSplitStreamWithPadding is used to encrypt data as a stream.
+// It takes a writer for the Symmetrically Encrypted Data Packet
+// (https://datatracker.ietf.org/doc/html/rfc4880#section-5.7)
+// and returns a writer for the plaintext data and the key packet.
+// The data packet is padded as described by the padding policy, to hide the
+// length of the plaintext.
+// If signKeyRing is not nil, it is used to do an embedded signature.
+func (keyRing *KeyRing) EncryptSplitStreamWithPadding(
+	dataPacketWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	signKeyRing *KeyRing,
+	padding *PaddingPolicy,
+) (*EncryptSplitResult, error) {
+	if padding == nil {
+		return nil, errors.New("gopenpgp: no padding policy provided")
+	}
+	return encryptSplitStream(
+		keyRing,
+		dataPacketWriter,
+		plainMessageMetadata,
+		signKeyRing,
+		false,
+		nil,
+		padding,
 	)
 }
 
@@ -215,6 +305,7 @@ func (keyRing *KeyRing) EncryptSplitStreamWithContext(
 		signKeyRing,
 		false,
 		signingContext,
+		nil,
 	)
 }
 
@@ -235,6 +326,7 @@ func (keyRing *KeyRing) EncryptSplitStreamWithCompression(
 		signKeyRing,
 		true,
 		nil,
+		nil,
 	)
 }
 
@@ -257,6 +349,7 @@ func (keyRing *KeyRing) EncryptSplitStreamWithContextAndCompression(
 		signKeyRing,
 		true,
 		signingContext,
+		nil,
 	)
 }
 
@@ -267,6 +360,7 @@ func encryptSplitStream(
 	signKeyRing *KeyRing,
 	compress bool,
 	signingContext *SigningContext,
+	padding *PaddingPolicy,
 ) (*EncryptSplitResult, error) {
 	var keyPacketBuf bytes.Buffer
 	plainMessageWriter, err := encryptStream(
@@ -277,6 +371,8 @@ func encryptSplitStream(
 		signKeyRing,
 		compress,
 		signingContext,
+		padding,
+		false,
 	)
 	if err != nil {
 		return nil, err
@@ -296,6 +392,7 @@ type PlainMessageReader struct {
 	verifyTime          int64
 	readAll             bool
 	verificationContext *VerificationContext
+	sessionKey          *SessionKey
 }
 
 // GetMetadata returns the metadata of the decrypted message.
@@ -317,6 +414,24 @@ func (msg *PlainMessageReader) Read(b []byte) (n int, err error) {
 	return
 }
 
+// GetSessionKey returns the session key of the decrypted message.
+func (msg *PlainMessageReader) GetSessionKey() (*SessionKey, error) {
+	if msg.sessionKey == nil {
+		return nil, errors.New("gopenpgp: the session key of the message is not available")
+	}
+	return msg.sessionKey, nil
+}
+
+// GetHexDecryptionKeyID returns the hex ID of the private key that decrypted
+// the session key of the message, or an empty string if it was decrypted with
+// a password or a session key.
+func (msg *PlainMessageReader) GetHexDecryptionKeyID() string {
+	if msg.details.DecryptedWith.PublicKey == nil {
+		return ""
+	}
+	return keyIDToHex(msg.details.DecryptedWith.PublicKey.KeyId)
+}
+
 // VerifySignature is used to verify that the signature is valid.
 // This method needs to be called once all the data has been read.
 // It will return an error if the signature is invalid
@@ -334,6 +449,18 @@ func (msg *PlainMessageReader) VerifySignature() (err error) {
 	return
 }
 
+// VerifySignatureAndIntendedRecipient is used to verify that the signature is
+// valid, like VerifySignature, and that the key that decrypted the message is
+// one of the intended recipients listed by the signature, if any.
+// A message forwarded by a recipient to a third party fails verification with
+// status constants.SIGNATURE_BAD_RECIPIENT.
+func (msg *PlainMessageReader) VerifySignatureAndIntendedRecipient() (err error) {
+	if err = msg.VerifySignature(); err != nil {
+		return err
+	}
+	return verifyIntendedRecipient(msg.details)
+}
+
 // DecryptStream is used to decrypt a pgp message as a Reader.
 // It takes a reader for the message data
 // and returns a PlainMessageReader for the plaintext data.
@@ -381,7 +508,7 @@ func decryptStream(
 	verifyTime int64,
 	verificationContext *VerificationContext,
 ) (plainMessage *PlainMessageReader, err error) {
-	messageDetails, err := asymmetricDecryptStream(
+	messageDetails, sk, err := asymmetricDecryptStream(
 		message,
 		decryptionKeyRing,
 		verifyKeyRing,
@@ -393,11 +520,11 @@ func decryptStream(
 	}
 
 	return &PlainMessageReader{
-		messageDetails,
-		verifyKeyRing,
-		verifyTime,
-		false,
-		verificationContext,
+		details:             messageDetails,
+		verifyKeyRing:       verifyKeyRing,
+		verifyTime:          verifyTime,
+		verificationContext: verificationContext,
+		sessionKey:          sk,
 	}, err
 }
 
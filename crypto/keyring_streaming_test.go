@@ -792,3 +792,64 @@ func TestKeyRing_VerifyDetachedEncryptedStreamCompatible(t *testing.T) {
 		t.Fatal("Expected no error while verifying the detached signature, got:", err)
 	}
 }
+
+func TestKeyRing_DecryptStreamGetSessionKey(t *testing.T) {
+	ciphertext, err := keyRingTestPublic.Encrypt(NewPlainMessageFromString("Hello World!"), nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting with key ring, got:", err)
+	}
+	split, err := ciphertext.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error while splitting the message, got:", err)
+	}
+	expectedSessionKey, err := keyRingTestPrivate.DecryptSessionKey(split.GetBinaryKeyPacket())
+	if err != nil {
+		t.Fatal("Expected no error while decrypting the session key, got:", err)
+	}
+
+	decryptedReader, err := keyRingTestPrivate.DecryptStream(ciphertext.NewReader(), nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error while calling decrypting stream with key ring, got:", err)
+	}
+	sessionKey, err := decryptedReader.GetSessionKey()
+	if err != nil {
+		t.Fatal("Expected no error while getting the session key, got:", err)
+	}
+	if !reflect.DeepEqual(expectedSessionKey, sessionKey) {
+		t.Fatalf("Expected the session key to be %v, got %v", expectedSessionKey, sessionKey)
+	}
+	keyIDs, _ := ciphertext.GetHexEncryptionKeyIDs()
+	if decryptedReader.GetHexDecryptionKeyID() != keyIDs[0] {
+		t.Fatalf("Expected the decryption key ID to be %s, got %s", keyIDs[0], decryptedReader.GetHexDecryptionKeyID())
+	}
+
+	decryptedBytes, err := ioutil.ReadAll(decryptedReader)
+	if err != nil {
+		t.Fatal("Expected no error while reading the decrypted data, got:", err)
+	}
+	if !bytes.Equal(decryptedBytes, []byte("Hello World!")) {
+		t.Fatalf("Expected the decrypted data to be %s got %s", "Hello World!", string(decryptedBytes))
+	}
+
+	// The session key is kept from the decryption, without the private key
+	key, err := GenerateKey("Session key", "session-key@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatal("Cannot generate key:", err)
+	}
+	keyRing, err := NewKeyRing(key)
+	if err != nil {
+		t.Fatal("Cannot create key ring:", err)
+	}
+	ciphertext, err = keyRing.Encrypt(NewPlainMessageFromString("Hello World!"), nil)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting with key ring, got:", err)
+	}
+	decryptedReader, err = keyRing.DecryptStream(ciphertext.NewReader(), nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error while calling decrypting stream with key ring, got:", err)
+	}
+	keyRing.ClearPrivateParams()
+	if _, err = decryptedReader.GetSessionKey(); err != nil {
+		t.Fatal("Expected no error while getting the session key, got:", err)
+	}
+}
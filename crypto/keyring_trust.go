@@ -0,0 +1,426 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"regexp"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/pkg/errors"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+// TrustModel computes the validity of user IDs from the certifications
+// issued by a set of trusted root keys, and by the introducers that these
+// roots designate with trust signatures.
+type TrustModel struct {
+	roots     []*trustRoot
+	keys      openpgp.EntityList
+	threshold int
+}
+
+type trustRoot struct {
+	entity *openpgp.Entity
+	depth  int
+	amount int
+}
+
+// TrustPath is a chain of certifications from a root key to an
+// authenticated user ID.
+type TrustPath struct {
+	// Amount is the amount of trust conveyed by the path.
+	Amount int
+
+	rootFingerprint string
+	certifications  []*Certification
+}
+
+// TrustEvaluation is the result of the authentication of a user ID.
+type TrustEvaluation struct {
+	// Authenticated is true if the paths convey at least the threshold
+	// amount of trust of the model.
+	Authenticated bool
+	// Amount is the total amount of trust conveyed by the paths.
+	Amount int
+
+	paths []*TrustPath
+}
+
+// trustEdge is a valid certification of a user ID of the key with
+// fingerprint to, made by the key with fingerprint from.
+type trustEdge struct {
+	from, to      string
+	userID        string
+	depth         int
+	amount        int
+	regex         *regexp.Regexp
+	certification *Certification
+}
+
+// trustSearch holds the state of a path search in the certification graph.
+type trustSearch struct {
+	edges    []*trustEdge
+	residual []int
+	target   string
+	userID   string
+
+	bestAmount int
+	bestEdges  []int
+	current    []int
+	visited    map[string]bool
+}
+
+// NewTrustModel creates an empty trust model, which authenticates user IDs
+// that are fully trusted, i.e. with a trust amount of at least
+// constants.TrustAmountFull.
+func NewTrustModel() *TrustModel {
+	return &TrustModel{threshold: constants.TrustAmountFull}
+}
+
+// AddRoot adds a trusted root key to the model.
+// The depth is the maximum number of introducers allowed between the root and
+// an authenticated key: with a depth of 0, only the keys directly certified by
+// the root are authenticated. The amount is the trust placed in the root,
+// e.g. constants.TrustAmountFull.
+func (model *TrustModel) AddRoot(root *Key, depth, amount int) error {
+	if depth < 0 || depth > 255 || amount < 0 || amount > 255 {
+		return errors.New("gopenpgp: invalid trust depth or amount")
+	}
+
+	model.roots = append(model.roots, &trustRoot{
+		entity: root.entity,
+		depth:  depth,
+		amount: amount,
+	})
+	return nil
+}
+
+// AddKeys adds the keys of the keyring to the model, so that they can act
+// as introducers between the roots and the authenticated keys.
+func (model *TrustModel) AddKeys(keyRing *KeyRing) {
+	model.keys = append(model.keys, keyRing.entities...)
+}
+
+// SetThreshold sets the amount of trust required to authenticate a user ID.
+func (model *TrustModel) SetThreshold(threshold int) error {
+	if threshold <= 0 {
+		return errors.New("gopenpgp: the trust threshold must be positive")
+	}
+	model.threshold = threshold
+	return nil
+}
+
+// Authenticate computes whether the given user ID of the target key is
+// authenticated at the unix time verifyTime, and returns the certification
+// paths that convey trust to it.
+// The trust amounts of disjoint paths add up, and the search stops as soon
+// as the threshold of the model is reached.
+// If verifyTime is 0, expiration checks are disabled.
+func (model *TrustModel) Authenticate(target *Key, userID string, verifyTime int64) (*TrustEvaluation, error) {
+	identity, ok := target.entity.Identities[userID]
+	if !ok {
+		return nil, errors.New("gopenpgp: user ID not found in target key")
+	}
+
+	evaluation := &TrustEvaluation{}
+	if !isEntityValid(target.entity, verifyTime) || identity.Revoked(getVerifyTime(verifyTime)) {
+		return evaluation, nil
+	}
+
+	targetFingerprint := hex.EncodeToString(target.entity.PrimaryKey.Fingerprint)
+	for _, root := range model.roots {
+		if hex.EncodeToString(root.entity.PrimaryKey.Fingerprint) == targetFingerprint &&
+			isEntityValid(root.entity, verifyTime) && root.amount > evaluation.Amount {
+			// The target is itself a root key
+			evaluation.Amount = root.amount
+			evaluation.paths = []*TrustPath{{Amount: root.amount, rootFingerprint: targetFingerprint}}
+		}
+	}
+
+	search := &trustSearch{
+		edges:  model.getTrustEdges(target.entity, verifyTime),
+		target: targetFingerprint,
+		userID: userID,
+	}
+	search.residual = make([]int, len(search.edges))
+	for i, edge := range search.edges {
+		search.residual[i] = edge.amount
+	}
+
+	rootResidual := make([]int, len(model.roots))
+	for i, root := range model.roots {
+		rootResidual[i] = root.amount
+	}
+
+	for evaluation.Amount < model.threshold {
+		bestRoot := -1
+		var bestAmount int
+		var bestEdges []int
+		for i, root := range model.roots {
+			if rootResidual[i] <= bestAmount || !isEntityValid(root.entity, verifyTime) {
+				continue
+			}
+			amount, edges := search.findWidestPath(
+				hex.EncodeToString(root.entity.PrimaryKey.Fingerprint),
+				root.depth,
+				rootResidual[i],
+			)
+			if amount > bestAmount {
+				bestRoot, bestAmount, bestEdges = i, amount, edges
+			}
+		}
+		if bestRoot < 0 {
+			break
+		}
+
+		path := &TrustPath{
+			Amount:          bestAmount,
+			rootFingerprint: hex.EncodeToString(model.roots[bestRoot].entity.PrimaryKey.Fingerprint),
+		}
+		rootResidual[bestRoot] -= bestAmount
+		for _, i := range bestEdges {
+			search.residual[i] -= bestAmount
+			path.certifications = append(path.certifications, search.edges[i].certification)
+		}
+
+		evaluation.Amount += bestAmount
+		evaluation.paths = append(evaluation.paths, path)
+	}
+
+	evaluation.Authenticated = evaluation.Amount >= model.threshold
+	return evaluation, nil
+}
+
+// Authenticate checks that every key of the keyring has at least one user ID
+// authenticated by the trust model at the unix time verifyTime, and returns
+// an error otherwise.
+// If verifyTime is 0, expiration checks are disabled.
+func (keyRing *KeyRing) Authenticate(model *TrustModel, verifyTime int64) error {
+	if len(keyRing.entities) == 0 {
+		return errors.New("gopenpgp: no key to authenticate")
+	}
+
+	for _, key := range keyRing.GetKeys() {
+		authenticated := false
+		for _, userID := range getSortedUserIDs(key.entity) {
+			evaluation, err := model.Authenticate(key, userID, verifyTime)
+			if err != nil {
+				return err
+			}
+			if evaluation.Authenticated {
+				authenticated = true
+				break
+			}
+		}
+
+		if !authenticated {
+			return errors.New("gopenpgp: key " + key.GetHexKeyID() + " is not authenticated")
+		}
+	}
+
+	return nil
+}
+
+// GetRootFingerprint returns the hex encoded fingerprint of the root key of
+// the path.
+func (path *TrustPath) GetRootFingerprint() string {
+	return path.rootFingerprint
+}
+
+// CountCertifications returns the number of certifications in the path.
+func (path *TrustPath) CountCertifications() int {
+	return len(path.certifications)
+}
+
+// GetCertification returns the n-th certification of the path, starting from
+// the certification issued by the root key.
+func (path *TrustPath) GetCertification(n int) (*Certification, error) {
+	if n < 0 || n >= len(path.certifications) {
+		return nil, errors.New("gopenpgp: out of bound when fetching certification")
+	}
+	return path.certifications[n], nil
+}
+
+// GetCertifications returns the certifications of the path, starting from
+// the certification issued by the root key.
+func (path *TrustPath) GetCertifications() []*Certification {
+	return path.certifications
+}
+
+// CountPaths returns the number of paths found during the evaluation.
+func (evaluation *TrustEvaluation) CountPaths() int {
+	return len(evaluation.paths)
+}
+
+// GetPath returns the n-th path found during the evaluation.
+func (evaluation *TrustEvaluation) GetPath(n int) (*TrustPath, error) {
+	if n < 0 || n >= len(evaluation.paths) {
+		return nil, errors.New("gopenpgp: out of bound when fetching trust path")
+	}
+	return evaluation.paths[n], nil
+}
+
+// GetPaths returns the paths found during the evaluation.
+func (evaluation *TrustEvaluation) GetPaths() []*TrustPath {
+	return evaluation.paths
+}
+
+// --- Internal methods
+
+// getTrustEdges returns the valid certifications between the keys of the
+// model and the target.
+func (model *TrustModel) getTrustEdges(target *openpgp.Entity, verifyTime int64) []*trustEdge {
+	var entities openpgp.EntityList
+	seen := make(map[string]bool)
+	for _, entity := range model.getEntities(target) {
+		fingerprint := hex.EncodeToString(entity.PrimaryKey.Fingerprint)
+		if !seen[fingerprint] && isEntityValid(entity, verifyTime) {
+			seen[fingerprint] = true
+			entities = append(entities, entity)
+		}
+	}
+
+	var edges []*trustEdge
+	for _, certified := range entities {
+		to := hex.EncodeToString(certified.PrimaryKey.Fingerprint)
+		for _, userID := range getSortedUserIDs(certified) {
+			identity := certified.Identities[userID]
+			for _, sig := range identity.Signatures {
+				if !isThirdPartyCertification(certified, sig) {
+					continue
+				}
+
+				signer := verifyCertificationSignature(entities, certified.PrimaryKey, userID, sig, verifyTime)
+				if signer == nil || isCertificationRevoked(signer, certified.PrimaryKey, identity, sig, verifyTime) {
+					continue
+				}
+
+				edge := &trustEdge{
+					from:          hex.EncodeToString(signer.Entity.PrimaryKey.Fingerprint),
+					to:            to,
+					userID:        userID,
+					amount:        constants.TrustAmountFull,
+					certification: newCertification(userID, sig),
+				}
+
+				if sig.TrustLevel > 0 {
+					edge.depth = int(sig.TrustLevel)
+					edge.amount = int(sig.TrustAmount)
+					if sig.TrustRegularExpression != nil {
+						regex, err := regexp.Compile(*sig.TrustRegularExpression)
+						if err != nil {
+							// A scope that cannot be evaluated does not delegate any trust
+							edge.depth = 0
+						}
+						edge.regex = regex
+					}
+				}
+
+				edges = append(edges, edge)
+			}
+		}
+	}
+
+	return edges
+}
+
+// getEntities returns the roots, the introducers and the target of the model.
+func (model *TrustModel) getEntities(target *openpgp.Entity) openpgp.EntityList {
+	entities := make(openpgp.EntityList, 0, len(model.roots)+len(model.keys)+1)
+	for _, root := range model.roots {
+		entities = append(entities, root.entity)
+	}
+	entities = append(entities, model.keys...)
+	return append(entities, target)
+}
+
+// findWidestPath returns the path from the node with the given fingerprint to
+// the target that conveys the largest amount of trust, given the residual
+// amounts of the edges, and the indices of its edges.
+func (search *trustSearch) findWidestPath(from string, depth, amount int) (int, []int) {
+	search.bestAmount = 0
+	search.bestEdges = nil
+	search.current = nil
+	search.visited = map[string]bool{from: true}
+	search.visit(from, depth, amount, nil)
+	return search.bestAmount, search.bestEdges
+}
+
+func (search *trustSearch) visit(node string, depth, amount int, scopes []*regexp.Regexp) {
+	for i, edge := range search.edges {
+		if edge.from != node || search.residual[i] <= 0 {
+			continue
+		}
+
+		pathAmount := amount
+		if search.residual[i] < pathAmount {
+			pathAmount = search.residual[i]
+		}
+		if pathAmount <= search.bestAmount || !matchesScopes(scopes, edge.userID) {
+			continue
+		}
+
+		if edge.to == search.target {
+			if edge.userID == search.userID {
+				search.bestAmount = pathAmount
+				search.bestEdges = append(append([]int{}, search.current...), i)
+			}
+			continue
+		}
+
+		if depth < 1 || edge.depth < 1 || search.visited[edge.to] {
+			continue
+		}
+
+		nextDepth := depth - 1
+		if edge.depth-1 < nextDepth {
+			nextDepth = edge.depth - 1
+		}
+
+		nextScopes := scopes
+		if edge.regex != nil {
+			nextScopes = append(append([]*regexp.Regexp{}, scopes...), edge.regex)
+		}
+
+		search.visited[edge.to] = true
+		search.current = append(search.current, i)
+		search.visit(edge.to, nextDepth, pathAmount, nextScopes)
+		search.current = search.current[:len(search.current)-1]
+		search.visited[edge.to] = false
+	}
+}
+
+func matchesScopes(scopes []*regexp.Regexp, userID string) bool {
+	for _, scope := range scopes {
+		if !scope.MatchString(userID) {
+			return false
+		}
+	}
+	return true
+}
+
+// isEntityValid checks that the entity is not revoked at the unix time
+// verifyTime, and not expired if verifyTime is not 0.
+func isEntityValid(entity *openpgp.Entity, verifyTime int64) bool {
+	now := getVerifyTime(verifyTime)
+	if entity.Revoked(now) {
+		return false
+	}
+	if verifyTime == 0 {
+		return true
+	}
+	// The expiry of version 6 keys is in their direct-key signature, as they
+	// may have no user ID
+	selfSignature, _ := entity.PrimarySelfSignature()
+	return selfSignature != nil && !entity.PrimaryKey.KeyExpired(selfSignature, now)
+}
+
+// getVerifyTime returns the time corresponding to verifyTime, or the current
+// time if verifyTime is 0.
+func getVerifyTime(verifyTime int64) time.Time {
+	if verifyTime == 0 {
+		return getNow()
+	}
+	return time.Unix(verifyTime, 0)
+}
@@ -0,0 +1,233 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+func generateTrustTestKey(t *testing.T, name, email string) (*KeyRing, *Key) {
+	key, err := GenerateKey(name, email, "x25519", 0)
+	if err != nil {
+		t.Fatal("Cannot generate key:", err)
+	}
+
+	keyRing, err := NewKeyRing(key)
+	if err != nil {
+		t.Fatal("Cannot create keyring:", err)
+	}
+
+	return keyRing, key
+}
+
+func certifyTrustTestKey(t *testing.T, certifier *KeyRing, target *Key, depth, amount int, regex string) *Key {
+	userID := getSortedUserIDs(target.entity)[0]
+	certified, err := certifier.CertifyKeyWithTrust(target, userID, constants.CertificationGeneric, 0, depth, amount, regex)
+	if err != nil {
+		t.Fatal("Expected no error while certifying key, got:", err)
+	}
+	return certified
+}
+
+func TestTrustModelDirectCertification(t *testing.T) {
+	rootKeyRing, root := generateTrustTestKey(t, "Root", "root@example.com")
+	_, target := generateTrustTestKey(t, "Target", "target@example.com")
+
+	model := NewTrustModel()
+	if err := model.AddRoot(root, 0, constants.TrustAmountFull); err != nil {
+		t.Fatal("Expected no error while adding root, got:", err)
+	}
+
+	evaluation, err := model.Authenticate(target, "Target <target@example.com>", GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error while authenticating, got:", err)
+	}
+	assert.False(t, evaluation.Authenticated)
+	assert.Exactly(t, 0, evaluation.CountPaths())
+
+	target = certifyTrustTestKey(t, rootKeyRing, target, 0, 0, "")
+
+	evaluation, err = model.Authenticate(target, "Target <target@example.com>", GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error while authenticating, got:", err)
+	}
+	assert.True(t, evaluation.Authenticated)
+	assert.Exactly(t, constants.TrustAmountFull, evaluation.Amount)
+	assert.Exactly(t, 1, evaluation.CountPaths())
+
+	path, err := evaluation.GetPath(0)
+	if err != nil {
+		t.Fatal("Expected no error while getting path, got:", err)
+	}
+	assert.Exactly(t, root.GetFingerprint(), path.GetRootFingerprint())
+	assert.Exactly(t, 1, path.CountCertifications())
+
+	_, err = evaluation.GetPath(1)
+	assert.Error(t, err)
+
+	evaluation, err = model.Authenticate(root, "Root <root@example.com>", GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error while authenticating root, got:", err)
+	}
+	assert.True(t, evaluation.Authenticated)
+
+	_, err = model.Authenticate(target, "Unknown <unknown@example.com>", GetUnixTime())
+	assert.Error(t, err)
+}
+
+func TestTrustModelIntroducer(t *testing.T) {
+	rootKeyRing, root := generateTrustTestKey(t, "Root", "root@example.com")
+	introducerKeyRing, introducer := generateTrustTestKey(t, "Introducer", "introducer@example.com")
+	_, target := generateTrustTestKey(t, "Target", "target@example.com")
+
+	introducer = certifyTrustTestKey(t, rootKeyRing, introducer, 1, constants.TrustAmountFull, "")
+	target = certifyTrustTestKey(t, introducerKeyRing, target, 0, 0, "")
+
+	introducerPublic, err := introducer.ToPublic()
+	if err != nil {
+		t.Fatal("Expected no error while extracting public key, got:", err)
+	}
+	introducers, err := NewKeyRing(introducerPublic)
+	if err != nil {
+		t.Fatal("Expected no error while creating keyring, got:", err)
+	}
+
+	shallowModel := NewTrustModel()
+	assert.Nil(t, shallowModel.AddRoot(root, 0, constants.TrustAmountFull))
+	shallowModel.AddKeys(introducers)
+
+	evaluation, err := shallowModel.Authenticate(target, "Target <target@example.com>", GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error while authenticating, got:", err)
+	}
+	assert.False(t, evaluation.Authenticated)
+
+	model := NewTrustModel()
+	assert.Nil(t, model.AddRoot(root, 1, constants.TrustAmountFull))
+	model.AddKeys(introducers)
+
+	evaluation, err = model.Authenticate(target, "Target <target@example.com>", GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error while authenticating, got:", err)
+	}
+	assert.True(t, evaluation.Authenticated)
+	assert.Exactly(t, 1, evaluation.CountPaths())
+
+	path := evaluation.GetPaths()[0]
+	assert.Exactly(t, 2, path.CountCertifications())
+	assert.Exactly(t, root.GetKeyID(), path.GetCertifications()[0].SignerKeyID)
+	assert.Exactly(t, 1, path.GetCertifications()[0].TrustDepth)
+	assert.Exactly(t, introducer.GetKeyID(), path.GetCertifications()[1].SignerKeyID)
+
+	targetKeyRing, err := NewKeyRing(target)
+	if err != nil {
+		t.Fatal("Expected no error while creating keyring, got:", err)
+	}
+	assert.Nil(t, targetKeyRing.Authenticate(model, GetUnixTime()))
+	assert.Error(t, targetKeyRing.Authenticate(shallowModel, GetUnixTime()))
+}
+
+func TestTrustModelPartialTrust(t *testing.T) {
+	rootKeyRing, root := generateTrustTestKey(t, "Root", "root@example.com")
+	firstKeyRing, first := generateTrustTestKey(t, "First", "first@example.com")
+	secondKeyRing, second := generateTrustTestKey(t, "Second", "second@example.com")
+	_, target := generateTrustTestKey(t, "Target", "target@example.com")
+
+	first = certifyTrustTestKey(t, rootKeyRing, first, 1, constants.TrustAmountPartial, "")
+	second = certifyTrustTestKey(t, rootKeyRing, second, 1, constants.TrustAmountPartial, "")
+
+	model := NewTrustModel()
+	assert.Nil(t, model.AddRoot(root, 1, constants.TrustAmountFull))
+	for _, key := range []*Key{first, second} {
+		keyRing, err := NewKeyRing(key)
+		if err != nil {
+			t.Fatal("Expected no error while creating keyring, got:", err)
+		}
+		model.AddKeys(keyRing)
+	}
+
+	target = certifyTrustTestKey(t, firstKeyRing, target, 0, 0, "")
+
+	evaluation, err := model.Authenticate(target, "Target <target@example.com>", GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error while authenticating, got:", err)
+	}
+	assert.False(t, evaluation.Authenticated)
+	assert.Exactly(t, constants.TrustAmountPartial, evaluation.Amount)
+
+	target = certifyTrustTestKey(t, secondKeyRing, target, 0, 0, "")
+
+	evaluation, err = model.Authenticate(target, "Target <target@example.com>", GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error while authenticating, got:", err)
+	}
+	assert.True(t, evaluation.Authenticated)
+	assert.Exactly(t, constants.TrustAmountFull, evaluation.Amount)
+	assert.Exactly(t, 2, evaluation.CountPaths())
+
+	assert.Nil(t, model.SetThreshold(2*constants.TrustAmountFull))
+	evaluation, err = model.Authenticate(target, "Target <target@example.com>", GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error while authenticating, got:", err)
+	}
+	assert.False(t, evaluation.Authenticated)
+	assert.Error(t, model.SetThreshold(0))
+}
+
+func TestTrustModelRegexScope(t *testing.T) {
+	rootKeyRing, root := generateTrustTestKey(t, "Root", "root@example.com")
+	introducerKeyRing, introducer := generateTrustTestKey(t, "Introducer", "introducer@example.com")
+	_, inside := generateTrustTestKey(t, "Inside", "inside@example.com")
+	_, outside := generateTrustTestKey(t, "Outside", "outside@example.org")
+
+	introducer = certifyTrustTestKey(t, rootKeyRing, introducer, 1, constants.TrustAmountFull, `<[^>]+[@.]example\.com>$`)
+	inside = certifyTrustTestKey(t, introducerKeyRing, inside, 0, 0, "")
+	outside = certifyTrustTestKey(t, introducerKeyRing, outside, 0, 0, "")
+
+	introducers, err := NewKeyRing(introducer)
+	if err != nil {
+		t.Fatal("Expected no error while creating keyring, got:", err)
+	}
+
+	model := NewTrustModel()
+	assert.Nil(t, model.AddRoot(root, 2, constants.TrustAmountFull))
+	model.AddKeys(introducers)
+
+	evaluation, err := model.Authenticate(inside, "Inside <inside@example.com>", GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error while authenticating, got:", err)
+	}
+	assert.True(t, evaluation.Authenticated)
+	assert.Exactly(t, `<[^>]+[@.]example\.com>$`, evaluation.GetPaths()[0].GetCertifications()[0].TrustRegex)
+
+	evaluation, err = model.Authenticate(outside, "Outside <outside@example.org>", GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error while authenticating, got:", err)
+	}
+	assert.False(t, evaluation.Authenticated)
+
+	_, err = rootKeyRing.CertifyKeyWithTrust(inside, "Inside <inside@example.com>", constants.CertificationGeneric, 0, 1, constants.TrustAmountFull, "(")
+	assert.Error(t, err)
+}
+
+func TestTrustModelCertifierWithoutUserIDs(t *testing.T) {
+	root := generateTestV6KeyWithoutUserIDs(t)
+	rootKeyRing, err := NewKeyRing(root)
+	if err != nil {
+		t.Fatal("Cannot create keyring:", err)
+	}
+	_, target := generateTrustTestKey(t, "Target", "target@example.com")
+	target = certifyTrustTestKey(t, rootKeyRing, target, 0, 0, "")
+
+	model := NewTrustModel()
+	if err = model.AddRoot(root, 0, constants.TrustAmountFull); err != nil {
+		t.Fatal("Expected no error while adding root, got:", err)
+	}
+	evaluation, err := model.Authenticate(target, "Target <target@example.com>", GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error while authenticating, got:", err)
+	}
+	assert.True(t, evaluation.Authenticated)
+}
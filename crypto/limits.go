@@ -0,0 +1,257 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+const (
+	packetTagSignature        = 2
+	packetTagOnePassSignature = 4
+	packetTagCompressed       = 8
+
+	// compressionRatioMinimumSize is the decompressed size under which the
+	// compression ratio is not checked, so that small messages are accepted
+	// whatever their ratio.
+	compressionRatioMinimumSize = 1 << 20
+)
+
+// DecryptionLimits bounds the resources used to decrypt and verify untrusted
+// messages. A zero field means no limit.
+type DecryptionLimits struct {
+	// MaxDecompressedSize is the maximum size of the decrypted data, in bytes.
+	MaxDecompressedSize int64
+	// MaxCompressionRatio is the maximum ratio of the size of the decrypted
+	// data to the size of the message, checked past 1 MiB of decrypted data.
+	MaxCompressionRatio int64
+	// MaxNestingDepth is the maximum number of nested compressed packets.
+	MaxNestingDepth int
+	// MaxKeyPackets is the maximum number of public-key encrypted session key
+	// packets tried to decrypt a message.
+	MaxKeyPackets int
+	// MaxSignatures is the maximum number of signature packets of a detached
+	// signature.
+	MaxSignatures int
+}
+
+// NewDecryptionLimits returns decryption limits without any limit, to be set
+// field by field.
+func NewDecryptionLimits() *DecryptionLimits {
+	return &DecryptionLimits{}
+}
+
+// SetDecryptionLimits sets the limits of all the following decryption and
+// verification operations. Operations exceeding them fail with a
+// DecryptionLimitError. A nil limits removes all the limits.
+func SetDecryptionLimits(limits *DecryptionLimits) {
+	pgp.lock.Lock()
+	defer pgp.lock.Unlock()
+
+	if limits == nil {
+		pgp.decryptionLimits = DecryptionLimits{}
+		return
+	}
+	pgp.decryptionLimits = *limits
+}
+
+// GetDecryptionLimits returns a copy of the current decryption limits.
+func GetDecryptionLimits() *DecryptionLimits {
+	limits := getDecryptionLimits()
+	return &limits
+}
+
+// DecryptionLimitError is returned from decryption and verification functions
+// when a message exceeds one of the decryption limits.
+type DecryptionLimitError struct {
+	Limit   int
+	Message string
+}
+
+// Error is the base method for all errors.
+func (e DecryptionLimitError) Error() string {
+	return fmt.Sprintf("Decryption Limit Error: %v", e.Message)
+}
+
+// IsDecryptionLimitError returns whether the error, or one of the errors it
+// wraps, is a DecryptionLimitError.
+func IsDecryptionLimitError(err error) bool {
+	return errors.As(err, &DecryptionLimitError{})
+}
+
+// ------------------
+// Internal functions
+// ------------------
+
+func getDecryptionLimits() DecryptionLimits {
+	pgp.lock.RLock()
+	defer pgp.lock.RUnlock()
+
+	return pgp.decryptionLimits
+}
+
+func newDecryptionLimitError(limit int, message string) DecryptionLimitError {
+	return DecryptionLimitError{
+		Limit:   limit,
+		Message: message,
+	}
+}
+
+// countingReader counts the bytes read from the message, for the compression
+// ratio.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(b []byte) (n int, err error) {
+	n, err = r.reader.Read(b)
+	r.count += int64(n)
+	return n, err
+}
+
+// limitedReader enforces the limits on the size and compression ratio of the
+// decrypted data.
+type limitedReader struct {
+	reader  io.Reader
+	message *countingReader
+	limits  DecryptionLimits
+	read    int64
+}
+
+func newLimitedReader(reader io.Reader, message *countingReader, limits DecryptionLimits) io.Reader {
+	if limits.MaxDecompressedSize <= 0 && limits.MaxCompressionRatio <= 0 {
+		return reader
+	}
+	return &limitedReader{reader: reader, message: message, limits: limits}
+}
+
+func (r *limitedReader) Read(b []byte) (n int, err error) {
+	n, err = r.reader.Read(b)
+	r.read += int64(n)
+
+	if r.limits.MaxDecompressedSize > 0 && r.read > r.limits.MaxDecompressedSize {
+		return n, newDecryptionLimitError(
+			constants.DECRYPTION_LIMIT_DECOMPRESSED_SIZE,
+			"decrypted data exceeds the maximum size",
+		)
+	}
+	if r.limits.MaxCompressionRatio > 0 && r.message != nil && r.read > compressionRatioMinimumSize &&
+		r.read > r.limits.MaxCompressionRatio*r.message.count {
+		return n, newDecryptionLimitError(
+			constants.DECRYPTION_LIMIT_COMPRESSION_RATIO,
+			"decrypted data exceeds the maximum compression ratio",
+		)
+	}
+	return n, err
+}
+
+// readCompressedLayers decompresses the compressed packets of the decrypted
+// packets, up to the literal data packet, enforcing the maximum nesting
+// depth, and returns the reader of the decompressed packets. The one-pass
+// signature packets in front of a compressed packet are kept, as well as the
+// packets following it, such as the signature packets.
+func readCompressedLayers(decrypted io.Reader, limits DecryptionLimits) (io.Reader, error) {
+	if limits.MaxNestingDepth <= 0 {
+		return decrypted, nil
+	}
+
+	var onePassSignatures bytes.Buffer
+	var enclosingReaders []io.Reader
+	reader := bufio.NewReader(decrypted)
+	for depth := 1; ; {
+		header, err := reader.Peek(1)
+		if err != nil {
+			break // go-crypto reports the error when reading the message
+		}
+
+		tag := getPacketTag(header[0])
+		if tag == packetTagOnePassSignature {
+			if _, err = packet.NewOpaqueReader(io.TeeReader(reader, &onePassSignatures)).Next(); err != nil {
+				return nil, errors.Wrap(err, "gopenpgp: error in reading one-pass signature packet")
+			}
+			continue
+		}
+		if tag != packetTagCompressed {
+			break
+		}
+		if depth > limits.MaxNestingDepth {
+			return nil, newDecryptionLimitError(
+				constants.DECRYPTION_LIMIT_NESTING_DEPTH,
+				"message exceeds the maximum nesting depth",
+			)
+		}
+		depth++
+
+		p, err := packet.Read(reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in reading compressed packet")
+		}
+		compressed, ok := p.(*packet.Compressed)
+		if !ok {
+			return nil, errors.New("gopenpgp: error in reading compressed packet")
+		}
+		enclosingReaders = append(enclosingReaders, reader)
+		reader = bufio.NewReader(compressed.Body)
+	}
+
+	readers := []io.Reader{&onePassSignatures, reader}
+	for i := len(enclosingReaders) - 1; i >= 0; i-- {
+		readers = append(readers, enclosingReaders[i])
+	}
+	return io.MultiReader(readers...), nil
+}
+
+// checkKeyPacketCount returns an error if one more public-key encrypted
+// session key packet than count can't be tried.
+func checkKeyPacketCount(count int, limits DecryptionLimits) error {
+	if limits.MaxKeyPackets > 0 && count > limits.MaxKeyPackets {
+		return newDecryptionLimitError(
+			constants.DECRYPTION_LIMIT_KEY_PACKETS,
+			"message exceeds the maximum number of key packets",
+		)
+	}
+	return nil
+}
+
+// checkSignatureCount returns an error if the detached signature has more
+// signature packets than the limit.
+func checkSignatureCount(signature []byte, limits DecryptionLimits) error {
+	if limits.MaxSignatures <= 0 {
+		return nil
+	}
+
+	count := 0
+	packets := packet.NewOpaqueReader(bytes.NewReader(signature))
+	for {
+		p, err := packets.Next()
+		if err != nil {
+			return nil //nolint:nilerr // go-crypto reports the error when verifying
+		}
+		if p.Tag != packetTagSignature {
+			continue
+		}
+		if count++; count > limits.MaxSignatures {
+			return newDecryptionLimitError(
+				constants.DECRYPTION_LIMIT_SIGNATURES,
+				"signature exceeds the maximum number of signature packets",
+			)
+		}
+	}
+}
+
+// getPacketTag returns the tag of the packet from the first byte of its
+// header.
+func getPacketTag(header byte) byte {
+	if header&0x40 == 0 {
+		// Old format packet
+		return (header & 0x3f) >> 2
+	}
+	return header & 0x3f
+}
@@ -0,0 +1,344 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+func assertDecryptionLimitError(t *testing.T, err error, limit int) {
+	var limitErr DecryptionLimitError
+	if !assert.ErrorAs(t, err, &limitErr) {
+		return
+	}
+	assert.True(t, IsDecryptionLimitError(err))
+	assert.Exactly(t, limit, limitErr.Limit)
+}
+
+// encryptNestedDataPacket returns a data packet encrypted with the session key,
+// with the literal data nested in depth compressed packets.
+func encryptNestedDataPacket(t *testing.T, sk *SessionKey, depth int, data []byte) []byte {
+	cipherFunc, err := sk.GetCipherFunc()
+	if err != nil {
+		t.Fatal("Expected no error when getting cipher function, got:", err)
+	}
+
+	var dataPacket bytes.Buffer
+	writer, err := packet.SerializeSymmetricallyEncrypted(&dataPacket, cipherFunc, false, packet.CipherSuite{}, sk.Key, nil)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting data packet, got:", err)
+	}
+	for i := 0; i < depth; i++ {
+		if writer, err = packet.SerializeCompressed(writer, packet.CompressionZLIB, nil); err != nil {
+			t.Fatal("Expected no error when compressing data packet, got:", err)
+		}
+	}
+	literalWriter, err := packet.SerializeLiteral(writer, true, "", 0)
+	if err != nil {
+		t.Fatal("Expected no error when writing literal packet, got:", err)
+	}
+	if _, err = literalWriter.Write(data); err != nil {
+		t.Fatal("Expected no error when writing data, got:", err)
+	}
+	if err = literalWriter.Close(); err != nil {
+		t.Fatal("Expected no error when closing data packet, got:", err)
+	}
+	return dataPacket.Bytes()
+}
+
+func TestDecryptionLimitsDecompressedSize(t *testing.T) {
+	defer SetDecryptionLimits(nil)
+
+	data := make([]byte, 4096)
+	ciphertext, err := keyRingTestPublic.EncryptWithCompression(NewPlainMessage(data), nil)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	limits := NewDecryptionLimits()
+	limits.MaxDecompressedSize = 4096
+	SetDecryptionLimits(limits)
+	decrypted, err := keyRingTestPrivate.Decrypt(ciphertext, nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting within the limits, got:", err)
+	}
+	assert.Exactly(t, data, decrypted.GetBinary())
+
+	limits.MaxDecompressedSize = 1024
+	SetDecryptionLimits(limits)
+	assert.Exactly(t, int64(1024), GetDecryptionLimits().MaxDecompressedSize)
+	_, err = keyRingTestPrivate.Decrypt(ciphertext, nil, 0)
+	assertDecryptionLimitError(t, err, constants.DECRYPTION_LIMIT_DECOMPRESSED_SIZE)
+
+	reader, err := keyRingTestPrivate.DecryptStream(bytes.NewReader(ciphertext.GetBinary()), nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error when starting to decrypt stream, got:", err)
+	}
+	_, err = ioutil.ReadAll(reader)
+	assertDecryptionLimitError(t, err, constants.DECRYPTION_LIMIT_DECOMPRESSED_SIZE)
+
+	split, err := ciphertext.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error when splitting message, got:", err)
+	}
+	_, err = keyRingTestPrivate.DecryptAttachment(split)
+	assertDecryptionLimitError(t, err, constants.DECRYPTION_LIMIT_DECOMPRESSED_SIZE)
+
+	SetDecryptionLimits(nil)
+	assert.Exactly(t, int64(0), GetDecryptionLimits().MaxDecompressedSize)
+	_, err = keyRingTestPrivate.Decrypt(ciphertext, nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting without limits, got:", err)
+	}
+}
+
+func TestDecryptionLimitsCompressionRatio(t *testing.T) {
+	defer SetDecryptionLimits(nil)
+
+	data := make([]byte, 4<<20)
+	ciphertext, err := keyRingTestPublic.EncryptWithCompression(NewPlainMessage(data), nil)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	limits := NewDecryptionLimits()
+	limits.MaxCompressionRatio = 10
+	SetDecryptionLimits(limits)
+	_, err = keyRingTestPrivate.Decrypt(ciphertext, nil, 0)
+	assertDecryptionLimitError(t, err, constants.DECRYPTION_LIMIT_COMPRESSION_RATIO)
+
+	// Small messages are accepted whatever their compression ratio
+	ciphertext, err = keyRingTestPublic.EncryptWithCompression(NewPlainMessage(make([]byte, 1<<16)), nil)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	if _, err = keyRingTestPrivate.Decrypt(ciphertext, nil, 0); err != nil {
+		t.Fatal("Expected no error when decrypting small message, got:", err)
+	}
+}
+
+func TestDecryptionLimitsNestingDepth(t *testing.T) {
+	defer SetDecryptionLimits(nil)
+
+	limits := NewDecryptionLimits()
+	limits.MaxNestingDepth = 2
+	SetDecryptionLimits(limits)
+
+	dataPacket := encryptNestedDataPacket(t, testSessionKey, 2, []byte("nested"))
+	decrypted, err := testSessionKey.Decrypt(dataPacket)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting within the nesting depth, got:", err)
+	}
+	assert.Exactly(t, "nested", decrypted.GetString())
+
+	dataPacket = encryptNestedDataPacket(t, testSessionKey, 3, []byte("nested"))
+	_, err = testSessionKey.Decrypt(dataPacket)
+	assertDecryptionLimitError(t, err, constants.DECRYPTION_LIMIT_NESTING_DEPTH)
+
+	keyPacket, err := keyRingTestPublic.EncryptSessionKey(testSessionKey)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting session key, got:", err)
+	}
+	_, err = keyRingTestPrivate.Decrypt(NewPGPSplitMessage(keyPacket, dataPacket).GetPGPMessage(), nil, 0)
+	assertDecryptionLimitError(t, err, constants.DECRYPTION_LIMIT_NESTING_DEPTH)
+}
+
+func TestDecryptionLimitsNestingDepthAfterOnePassSignature(t *testing.T) {
+	defer SetDecryptionLimits(nil)
+
+	signEntity, err := keyRingTestPrivate.getSigningEntity()
+	if err != nil {
+		t.Fatal("Expected no error when getting signing entity, got:", err)
+	}
+	var signed bytes.Buffer
+	signWriter, err := openpgp.Sign(&signed, signEntity, &openpgp.FileHints{IsBinary: true}, &packet.Config{Time: getTimeGenerator()})
+	if err != nil {
+		t.Fatal("Expected no error when signing, got:", err)
+	}
+	if _, err = signWriter.Write([]byte("nested")); err != nil {
+		t.Fatal("Expected no error when writing data, got:", err)
+	}
+	if err = signWriter.Close(); err != nil {
+		t.Fatal("Expected no error when closing signature, got:", err)
+	}
+
+	// The one-pass signature packet is followed by the literal data packet
+	// nested in three compressed packets, and the signature packet
+	var plaintext bytes.Buffer
+	packets := packet.NewOpaqueReader(&signed)
+	for i := 0; i < 3; i++ {
+		p, err := packets.Next()
+		if err != nil {
+			t.Fatal("Expected no error when reading signed packets, got:", err)
+		}
+		if i != 1 {
+			if err = p.Serialize(&plaintext); err != nil {
+				t.Fatal("Expected no error when writing packet, got:", err)
+			}
+			continue
+		}
+		var writer io.WriteCloser = &nopWriteCloser{&plaintext}
+		for depth := 0; depth < 3; depth++ {
+			if writer, err = packet.SerializeCompressed(writer, packet.CompressionZLIB, nil); err != nil {
+				t.Fatal("Expected no error when compressing packet, got:", err)
+			}
+		}
+		if err = p.Serialize(writer); err != nil {
+			t.Fatal("Expected no error when writing packet, got:", err)
+		}
+		if err = writer.Close(); err != nil {
+			t.Fatal("Expected no error when closing compressed packet, got:", err)
+		}
+	}
+
+	cipherFunc, err := testSessionKey.GetCipherFunc()
+	if err != nil {
+		t.Fatal("Expected no error when getting cipher function, got:", err)
+	}
+	var dataPacket bytes.Buffer
+	writer, err := packet.SerializeSymmetricallyEncrypted(&dataPacket, cipherFunc, false, packet.CipherSuite{}, testSessionKey.Key, nil)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting data packet, got:", err)
+	}
+	if _, err = writer.Write(plaintext.Bytes()); err != nil {
+		t.Fatal("Expected no error when writing data packet, got:", err)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal("Expected no error when closing data packet, got:", err)
+	}
+
+	limits := NewDecryptionLimits()
+	limits.MaxNestingDepth = 2
+	SetDecryptionLimits(limits)
+	_, err = testSessionKey.DecryptAndVerify(dataPacket.Bytes(), keyRingTestPublic, GetUnixTime())
+	assertDecryptionLimitError(t, err, constants.DECRYPTION_LIMIT_NESTING_DEPTH)
+
+	limits.MaxNestingDepth = 3
+	SetDecryptionLimits(limits)
+	decrypted, err := testSessionKey.DecryptAndVerify(dataPacket.Bytes(), keyRingTestPublic, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting within the nesting depth, got:", err)
+	}
+	assert.Exactly(t, "nested", decrypted.GetString())
+}
+
+func TestDecryptionLimitsPassword(t *testing.T) {
+	defer SetDecryptionLimits(nil)
+
+	password := []byte("password")
+	keyPacket, err := EncryptSessionKeyWithPassword(testSessionKey, password)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting session key, got:", err)
+	}
+	data := make([]byte, 4096)
+	dataPacket := encryptNestedDataPacket(t, testSessionKey, 3, data)
+	message := NewPGPSplitMessage(keyPacket, dataPacket).GetPGPMessage()
+
+	limits := NewDecryptionLimits()
+	limits.MaxNestingDepth = 2
+	SetDecryptionLimits(limits)
+	_, err = DecryptMessageWithPassword(message, password)
+	assertDecryptionLimitError(t, err, constants.DECRYPTION_LIMIT_NESTING_DEPTH)
+	_, err = DecryptStreamWithPassword(bytes.NewReader(message.GetBinary()), password)
+	assertDecryptionLimitError(t, err, constants.DECRYPTION_LIMIT_NESTING_DEPTH)
+
+	limits.MaxNestingDepth = 0
+	limits.MaxDecompressedSize = 1024
+	SetDecryptionLimits(limits)
+	_, err = DecryptMessageWithPassword(message, password)
+	assertDecryptionLimitError(t, err, constants.DECRYPTION_LIMIT_DECOMPRESSED_SIZE)
+	reader, err := DecryptStreamWithPassword(bytes.NewReader(message.GetBinary()), password)
+	if err != nil {
+		t.Fatal("Expected no error when starting to decrypt stream, got:", err)
+	}
+	_, err = ioutil.ReadAll(reader)
+	assertDecryptionLimitError(t, err, constants.DECRYPTION_LIMIT_DECOMPRESSED_SIZE)
+
+	SetDecryptionLimits(nil)
+	decrypted, err := DecryptMessageWithPassword(message, password)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting without limits, got:", err)
+	}
+	assert.Exactly(t, data, decrypted.GetBinary())
+}
+
+func TestDecryptionLimitsKeyPackets(t *testing.T) {
+	defer SetDecryptionLimits(nil)
+
+	firstKey, err := GenerateKey("first", "first@proton.me", "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error when generating key, got:", err)
+	}
+	secondKey, err := GenerateKey("second", "second@proton.me", "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error when generating key, got:", err)
+	}
+	recipients, err := NewKeyRing(firstKey)
+	if err != nil {
+		t.Fatal("Expected no error when building keyring, got:", err)
+	}
+	if err = recipients.AddKey(secondKey); err != nil {
+		t.Fatal("Expected no error when adding key, got:", err)
+	}
+	secondKeyRing, err := NewKeyRing(secondKey)
+	if err != nil {
+		t.Fatal("Expected no error when building keyring, got:", err)
+	}
+
+	ciphertext, err := recipients.Encrypt(NewPlainMessageFromString("to both"), nil)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	limits := NewDecryptionLimits()
+	limits.MaxKeyPackets = 1
+	SetDecryptionLimits(limits)
+	_, err = secondKeyRing.Decrypt(ciphertext, nil, 0)
+	assertDecryptionLimitError(t, err, constants.DECRYPTION_LIMIT_KEY_PACKETS)
+
+	split, err := ciphertext.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error when splitting message, got:", err)
+	}
+	_, err = secondKeyRing.DecryptSessionKey(split.GetBinaryKeyPacket())
+	assertDecryptionLimitError(t, err, constants.DECRYPTION_LIMIT_KEY_PACKETS)
+
+	limits.MaxKeyPackets = 2
+	SetDecryptionLimits(limits)
+	decrypted, err := secondKeyRing.Decrypt(ciphertext, nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting within the limits, got:", err)
+	}
+	assert.Exactly(t, "to both", decrypted.GetString())
+}
+
+func TestDecryptionLimitsSignatures(t *testing.T) {
+	defer SetDecryptionLimits(nil)
+
+	message := NewPlainMessageFromString("signed twice")
+	signature, err := keyRingTestPrivate.SignDetached(message)
+	if err != nil {
+		t.Fatal("Expected no error when signing, got:", err)
+	}
+	signatures := NewPGPSignature(append(signature.GetBinary(), signature.GetBinary()...))
+
+	limits := NewDecryptionLimits()
+	limits.MaxSignatures = 2
+	SetDecryptionLimits(limits)
+	if err = keyRingTestPublic.VerifyDetached(message, signatures, GetUnixTime()); err != nil {
+		t.Fatal("Expected no error when verifying within the limits, got:", err)
+	}
+
+	limits.MaxSignatures = 1
+	SetDecryptionLimits(limits)
+	err = keyRingTestPublic.VerifyDetached(message, signatures, GetUnixTime())
+	assertDecryptionLimitError(t, err, constants.DECRYPTION_LIMIT_SIGNATURES)
+	assert.NoError(t, keyRingTestPublic.VerifyDetached(message, signature, GetUnixTime()))
+}
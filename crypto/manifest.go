@@ -0,0 +1,346 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	manifestVersion       = 1
+	manifestTypeFile      = "file"
+	manifestTypeDirectory = "directory"
+)
+
+// Manifest lists the blocks of a file split into blocks, or the entries of a
+// directory, so that a signature of the manifest proves that the blocks
+// haven't been modified, reordered or truncated.
+// A file manifest lists the size, the SHA-256 hash and the SHA-256 hash of the
+// encrypted block of each block. A directory manifest lists the name and the
+// SHA-256 hash of the manifest of each entry, which can be a file or a
+// directory, so that the signature of the root manifest covers the whole tree.
+// The manifest of a file encrypted by SessionKey.EncryptChunked is a file
+// manifest, see ChunkedManifest.
+type Manifest struct {
+	data manifestData
+	// binary is the encoding of the manifest, kept as read so that its
+	// signature can be verified.
+	binary []byte
+}
+
+type manifestData struct {
+	Version int              `json:"version"`
+	Type    string           `json:"type"`
+	Name    string           `json:"name"`
+	Blocks  []*manifestBlock `json:"blocks,omitempty"`
+	Entries []*manifestEntry `json:"entries,omitempty"`
+	Chunked *manifestChunked `json:"chunked,omitempty"`
+}
+
+type manifestBlock struct {
+	Size          int64  `json:"size"`
+	Hash          []byte `json:"hash"`
+	EncryptedHash []byte `json:"encryptedHash"`
+}
+
+type manifestEntry struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	ManifestHash []byte `json:"manifestHash"`
+}
+
+// NewFileManifest returns an empty manifest for the blocks of a file.
+func NewFileManifest(name string) *Manifest {
+	return &Manifest{data: manifestData{Version: manifestVersion, Type: manifestTypeFile, Name: name}}
+}
+
+// NewDirectoryManifest returns an empty manifest for the entries of a
+// directory.
+func NewDirectoryManifest(name string) *Manifest {
+	return &Manifest{data: manifestData{Version: manifestVersion, Type: manifestTypeDirectory, Name: name}}
+}
+
+// NewManifest reads a manifest from its encoding, as returned by GetBinary.
+func NewManifest(data []byte) (*Manifest, error) {
+	manifest := &Manifest{binary: clone(data)}
+	if err := json.Unmarshal(data, &manifest.data); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in reading manifest")
+	}
+	if err := manifest.data.validate(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// NewManifestFromEncrypted decrypts a manifest encrypted by Manifest.Encrypt
+// with the session key.
+func NewManifestFromEncrypted(dataPacket []byte, sk *SessionKey) (*Manifest, error) {
+	decrypted, err := sk.Decrypt(dataPacket)
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in decrypting manifest")
+	}
+	return NewManifest(decrypted.GetBinary())
+}
+
+// GetName returns the name of the file or directory.
+func (manifest *Manifest) GetName() string {
+	return manifest.data.Name
+}
+
+// IsDirectory returns whether the manifest lists the entries of a directory.
+func (manifest *Manifest) IsDirectory() bool {
+	return manifest.data.Type == manifestTypeDirectory
+}
+
+// GetBlockCount returns the number of blocks of a file manifest.
+func (manifest *Manifest) GetBlockCount() int {
+	return len(manifest.data.Blocks)
+}
+
+// GetBlockSize returns the size of the block of the given index.
+func (manifest *Manifest) GetBlockSize(index int) (int64, error) {
+	if index < 0 || index >= len(manifest.data.Blocks) {
+		return 0, errors.New("gopenpgp: manifest block index out of range")
+	}
+	return manifest.data.Blocks[index].Size, nil
+}
+
+// GetSize returns the size of the file, the sum of the sizes of its blocks.
+func (manifest *Manifest) GetSize() int64 {
+	var size int64
+	for _, block := range manifest.data.Blocks {
+		size += block.Size
+	}
+	return size
+}
+
+// GetEntryCount returns the number of entries of a directory manifest.
+func (manifest *Manifest) GetEntryCount() int {
+	return len(manifest.data.Entries)
+}
+
+// GetEntryName returns the name of the entry of the given index.
+func (manifest *Manifest) GetEntryName(index int) (string, error) {
+	if index < 0 || index >= len(manifest.data.Entries) {
+		return "", errors.New("gopenpgp: manifest entry index out of range")
+	}
+	return manifest.data.Entries[index].Name, nil
+}
+
+// AddBlock adds the next block of a file to the manifest, with its plaintext
+// and its encrypted data.
+func (manifest *Manifest) AddBlock(plaintext, encrypted []byte) error {
+	if manifest.IsDirectory() {
+		return errors.New("gopenpgp: blocks can't be added to a directory manifest")
+	}
+	if manifest.data.Chunked != nil {
+		return errors.New("gopenpgp: blocks can't be added to a chunked file manifest")
+	}
+	manifest.data.Blocks = append(manifest.data.Blocks, newManifestBlock(plaintext, encrypted))
+	manifest.binary = nil
+	return nil
+}
+
+// AddEntry adds the manifest of a file or directory to a directory manifest.
+// The entry must be complete, as it is listed by the hash of its encoding.
+func (manifest *Manifest) AddEntry(entry *Manifest) error {
+	if !manifest.IsDirectory() {
+		return errors.New("gopenpgp: entries can't be added to a file manifest")
+	}
+	for _, existing := range manifest.data.Entries {
+		if existing.Name == entry.GetName() {
+			return errors.New("gopenpgp: the directory manifest already has an entry " + entry.GetName())
+		}
+	}
+	hash, err := entry.getHash()
+	if err != nil {
+		return err
+	}
+	manifest.data.Entries = append(manifest.data.Entries, &manifestEntry{
+		Name:         entry.GetName(),
+		Type:         entry.data.Type,
+		ManifestHash: hash,
+	})
+	manifest.binary = nil
+	return nil
+}
+
+// GetBinary returns the encoding of the manifest.
+func (manifest *Manifest) GetBinary() ([]byte, error) {
+	if manifest.binary == nil {
+		binary, err := json.Marshal(manifest.data)
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in encoding manifest")
+		}
+		manifest.binary = binary
+	}
+	return clone(manifest.binary), nil
+}
+
+// Encrypt encrypts the encoding of the manifest with the session key, and
+// returns the data packet.
+func (manifest *Manifest) Encrypt(sk *SessionKey) ([]byte, error) {
+	binary, err := manifest.GetBinary()
+	if err != nil {
+		return nil, err
+	}
+	return sk.Encrypt(NewPlainMessage(binary))
+}
+
+// Sign returns a detached signature of the manifest with the signing context,
+// see KeyRing.SignDetachedWithContext.
+func (manifest *Manifest) Sign(signKeyRing *KeyRing, signingContext *SigningContext) (*PGPSignature, error) {
+	binary, err := manifest.GetBinary()
+	if err != nil {
+		return nil, err
+	}
+	return signKeyRing.SignDetachedWithContext(NewPlainMessage(binary), signingContext)
+}
+
+// Verify verifies the detached signature of the manifest with the
+// verification context, see KeyRing.VerifyDetachedWithContext.
+func (manifest *Manifest) Verify(
+	verifyKeyRing *KeyRing,
+	signature *PGPSignature,
+	verifyTime int64,
+	verificationContext *VerificationContext,
+) error {
+	binary, err := manifest.GetBinary()
+	if err != nil {
+		return err
+	}
+	return verifyKeyRing.VerifyDetachedWithContext(NewPlainMessage(binary), signature, verifyTime, verificationContext)
+}
+
+// VerifyEntry verifies that the manifest of a file or directory is an entry
+// of the directory manifest, so that the entries of a verified directory
+// manifest are verified down the tree.
+func (manifest *Manifest) VerifyEntry(entry *Manifest) error {
+	hash, err := entry.getHash()
+	if err != nil {
+		return err
+	}
+	for _, existing := range manifest.data.Entries {
+		if existing.Name == entry.GetName() {
+			if existing.Type != entry.data.Type || !bytes.Equal(existing.ManifestHash, hash) {
+				return errors.New("gopenpgp: entry " + entry.GetName() + " doesn't match the directory manifest")
+			}
+			return nil
+		}
+	}
+	return errors.New("gopenpgp: entry " + entry.GetName() + " is not in the directory manifest")
+}
+
+// ManifestBlockVerifier verifies a sequence of blocks against a file
+// manifest, see Manifest.NewBlockVerifier.
+type ManifestBlockVerifier struct {
+	manifest  *Manifest
+	encrypted bool
+	index     int
+}
+
+// NewBlockVerifier returns a verifier of the sequence of plaintext blocks of
+// the file, in order.
+func (manifest *Manifest) NewBlockVerifier() *ManifestBlockVerifier {
+	return &ManifestBlockVerifier{manifest: manifest}
+}
+
+// NewEncryptedBlockVerifier returns a verifier of the sequence of encrypted
+// blocks of the file, in order.
+func (manifest *Manifest) NewEncryptedBlockVerifier() *ManifestBlockVerifier {
+	return &ManifestBlockVerifier{manifest: manifest, encrypted: true}
+}
+
+// VerifyNext verifies that the block is the next block of the manifest.
+func (verifier *ManifestBlockVerifier) VerifyNext(block []byte) error {
+	blocks := verifier.manifest.data.Blocks
+	if verifier.index >= len(blocks) {
+		return errors.New("gopenpgp: more blocks than in the manifest")
+	}
+	expected := blocks[verifier.index]
+	hash := sha256.Sum256(block)
+
+	var matches bool
+	if verifier.encrypted {
+		matches = bytes.Equal(hash[:], expected.EncryptedHash)
+	} else {
+		matches = int64(len(block)) == expected.Size && bytes.Equal(hash[:], expected.Hash)
+	}
+	if !matches {
+		return errors.New("gopenpgp: block " + strconv.Itoa(verifier.index) + " doesn't match the manifest")
+	}
+	verifier.index++
+	return nil
+}
+
+// Finish verifies that all the blocks of the manifest have been verified, so
+// that the sequence isn't truncated.
+func (verifier *ManifestBlockVerifier) Finish() error {
+	if verifier.index != len(verifier.manifest.data.Blocks) {
+		return errors.New("gopenpgp: fewer blocks than in the manifest")
+	}
+	return nil
+}
+
+// getHash returns the SHA-256 hash of the encoding of the manifest.
+func (manifest *Manifest) getHash() ([]byte, error) {
+	binary, err := manifest.GetBinary()
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(binary)
+	return hash[:], nil
+}
+
+func newManifestBlock(plaintext, encrypted []byte) *manifestBlock {
+	hash := sha256.Sum256(plaintext)
+	encryptedHash := sha256.Sum256(encrypted)
+	return &manifestBlock{
+		Size:          int64(len(plaintext)),
+		Hash:          hash[:],
+		EncryptedHash: encryptedHash[:],
+	}
+}
+
+func (data *manifestData) validate() error {
+	if data.Version != manifestVersion {
+		return errors.New("gopenpgp: unsupported manifest version " + strconv.Itoa(data.Version))
+	}
+	switch data.Type {
+	case manifestTypeFile:
+		if len(data.Entries) != 0 {
+			return errors.New("gopenpgp: invalid manifest, a file manifest has no entries")
+		}
+		for _, block := range data.Blocks {
+			if block == nil || block.Size < 0 || len(block.Hash) != sha256.Size || len(block.EncryptedHash) != sha256.Size {
+				return errors.New("gopenpgp: invalid manifest block")
+			}
+		}
+		if data.Chunked != nil {
+			return data.Chunked.validate(data.Blocks)
+		}
+	case manifestTypeDirectory:
+		if len(data.Blocks) != 0 || data.Chunked != nil {
+			return errors.New("gopenpgp: invalid manifest, a directory manifest has no blocks")
+		}
+		// Entries are looked up by name, a duplicate could be verified in
+		// place of the other one
+		names := make(map[string]bool, len(data.Entries))
+		for _, entry := range data.Entries {
+			if entry == nil || entry.Type != manifestTypeFile && entry.Type != manifestTypeDirectory ||
+				len(entry.ManifestHash) != sha256.Size {
+				return errors.New("gopenpgp: invalid manifest entry")
+			}
+			if names[entry.Name] {
+				return errors.New("gopenpgp: invalid manifest, duplicate entry " + entry.Name)
+			}
+			names[entry.Name] = true
+		}
+	default:
+		return errors.New("gopenpgp: invalid manifest type")
+	}
+	return nil
+}
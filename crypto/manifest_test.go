@@ -0,0 +1,180 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testManifestContext = "gopenpgp-test-manifest"
+
+// newTestFileManifest returns the manifest of a file of the given blocks,
+// encrypted with the test session key, and the encrypted blocks.
+func newTestFileManifest(t *testing.T, name string, blocks ...string) (*Manifest, [][]byte) {
+	manifest := NewFileManifest(name)
+	var encryptedBlocks [][]byte
+	for _, block := range blocks {
+		encrypted, err := testSessionKey.Encrypt(NewPlainMessageFromString(block))
+		if err != nil {
+			t.Fatal("Expected no error when encrypting block, got:", err)
+		}
+		if err = manifest.AddBlock([]byte(block), encrypted); err != nil {
+			t.Fatal("Expected no error when adding block, got:", err)
+		}
+		encryptedBlocks = append(encryptedBlocks, encrypted)
+	}
+	return manifest, encryptedBlocks
+}
+
+func TestManifestSignAndVerify(t *testing.T) {
+	manifest, _ := newTestFileManifest(t, "file.txt", "first block", "second block")
+	assert.Exactly(t, 2, manifest.GetBlockCount())
+	assert.Exactly(t, int64(len("first block")+len("second block")), manifest.GetSize())
+
+	signature, err := manifest.Sign(keyRingTestPrivate, NewSigningContext(testManifestContext, true))
+	if err != nil {
+		t.Fatal("Expected no error when signing manifest, got:", err)
+	}
+
+	// The manifest is optionally encrypted for transport
+	encrypted, err := manifest.Encrypt(testSessionKey)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting manifest, got:", err)
+	}
+	decrypted, err := NewManifestFromEncrypted(encrypted, testSessionKey)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting manifest, got:", err)
+	}
+	assert.Exactly(t, "file.txt", decrypted.GetName())
+	assert.False(t, decrypted.IsDirectory())
+	size, err := decrypted.GetBlockSize(1)
+	if err != nil {
+		t.Fatal("Expected no error when getting block size, got:", err)
+	}
+	assert.Exactly(t, int64(len("second block")), size)
+
+	err = decrypted.Verify(keyRingTestPublic, signature, GetUnixTime(), NewVerificationContext(testManifestContext, true, 0))
+	assert.NoError(t, err)
+
+	// The signature is bound to its context
+	err = decrypted.Verify(keyRingTestPublic, signature, GetUnixTime(), NewVerificationContext("other context", true, 0))
+	assert.Error(t, err)
+
+	// The signature covers the block list
+	if err = decrypted.AddBlock([]byte("third block"), nil); err != nil {
+		t.Fatal("Expected no error when adding block, got:", err)
+	}
+	err = decrypted.Verify(keyRingTestPublic, signature, GetUnixTime(), NewVerificationContext(testManifestContext, true, 0))
+	assert.Error(t, err)
+}
+
+func TestManifestBlockVerifier(t *testing.T) {
+	blocks := []string{"first block", "second block", "third block"}
+	manifest, encryptedBlocks := newTestFileManifest(t, "file.txt", blocks...)
+
+	verifier := manifest.NewBlockVerifier()
+	for _, block := range blocks {
+		assert.NoError(t, verifier.VerifyNext([]byte(block)))
+	}
+	assert.NoError(t, verifier.Finish())
+	assert.Error(t, verifier.VerifyNext([]byte("extra block")))
+
+	encryptedVerifier := manifest.NewEncryptedBlockVerifier()
+	for _, block := range encryptedBlocks {
+		assert.NoError(t, encryptedVerifier.VerifyNext(block))
+	}
+	assert.NoError(t, encryptedVerifier.Finish())
+
+	// Reordered blocks
+	verifier = manifest.NewBlockVerifier()
+	assert.Error(t, verifier.VerifyNext([]byte(blocks[1])))
+
+	// Truncated sequence
+	verifier = manifest.NewEncryptedBlockVerifier()
+	assert.NoError(t, verifier.VerifyNext(encryptedBlocks[0]))
+	assert.NoError(t, verifier.VerifyNext(encryptedBlocks[1]))
+	assert.Error(t, verifier.Finish())
+}
+
+func TestDirectoryManifest(t *testing.T) {
+	file, _ := newTestFileManifest(t, "file.txt", "file contents")
+	nestedFile, _ := newTestFileManifest(t, "nested.txt", "nested contents")
+	subdirectory := NewDirectoryManifest("subdirectory")
+	if err := subdirectory.AddEntry(nestedFile); err != nil {
+		t.Fatal("Expected no error when adding entry, got:", err)
+	}
+	root := NewDirectoryManifest("root")
+	if err := root.AddEntry(file); err != nil {
+		t.Fatal("Expected no error when adding entry, got:", err)
+	}
+	if err := root.AddEntry(subdirectory); err != nil {
+		t.Fatal("Expected no error when adding entry, got:", err)
+	}
+	assert.Error(t, root.AddEntry(file))
+	assert.Error(t, root.AddBlock([]byte("block"), nil))
+	assert.Error(t, file.AddEntry(subdirectory))
+
+	assert.Exactly(t, 2, root.GetEntryCount())
+	name, err := root.GetEntryName(1)
+	if err != nil {
+		t.Fatal("Expected no error when getting entry name, got:", err)
+	}
+	assert.Exactly(t, "subdirectory", name)
+
+	// Only the root manifest is signed, the entries are verified down the tree
+	signature, err := root.Sign(keyRingTestPrivate, NewSigningContext(testManifestContext, true))
+	if err != nil {
+		t.Fatal("Expected no error when signing manifest, got:", err)
+	}
+	readManifest := func(manifest *Manifest) *Manifest {
+		binary, err := manifest.GetBinary()
+		if err != nil {
+			t.Fatal("Expected no error when encoding manifest, got:", err)
+		}
+		read, err := NewManifest(binary)
+		if err != nil {
+			t.Fatal("Expected no error when reading manifest, got:", err)
+		}
+		return read
+	}
+	readRoot := readManifest(root)
+	assert.True(t, readRoot.IsDirectory())
+	err = readRoot.Verify(keyRingTestPublic, signature, GetUnixTime(), NewVerificationContext(testManifestContext, true, 0))
+	assert.NoError(t, err)
+	readSubdirectory := readManifest(subdirectory)
+	assert.NoError(t, readRoot.VerifyEntry(readManifest(file)))
+	assert.NoError(t, readRoot.VerifyEntry(readSubdirectory))
+	assert.NoError(t, readSubdirectory.VerifyEntry(readManifest(nestedFile)))
+
+	// Modified and unknown entries
+	modifiedFile, _ := newTestFileManifest(t, "file.txt", "modified contents")
+	assert.Error(t, readRoot.VerifyEntry(modifiedFile))
+	assert.Error(t, readRoot.VerifyEntry(nestedFile))
+}
+
+func TestManifestErrors(t *testing.T) {
+	for _, data := range []string{
+		`not a manifest`,
+		`{"version":2,"type":"file","name":"file.txt"}`,
+		`{"version":1,"type":"link","name":"file.txt"}`,
+		`{"version":1,"type":"file","name":"file.txt","blocks":[null]}`,
+		`{"version":1,"type":"file","name":"file.txt","blocks":[{"size":1,"hash":"AAAA","encryptedHash":"AAAA"}]}`,
+		`{"version":1,"type":"directory","name":"dir","blocks":[{"size":1}]}`,
+	} {
+		_, err := NewManifest([]byte(data))
+		assert.Error(t, err, data)
+	}
+
+	// Entries are verified by name, there can't be two with the same name
+	entry := `{"name":"file.txt","type":"file","manifestHash":"` + strings.Repeat("A", 43) + `="}`
+	_, err := NewManifest([]byte(`{"version":1,"type":"directory","name":"dir","entries":[` + entry + `]}`))
+	assert.NoError(t, err)
+	_, err = NewManifest([]byte(`{"version":1,"type":"directory","name":"dir","entries":[` + entry + `,` + entry + `]}`))
+	assert.Error(t, err)
+
+	_, err = NewFileManifest("file.txt").GetBlockSize(0)
+	assert.Error(t, err)
+	_, err = NewDirectoryManifest("dir").GetEntryName(0)
+	assert.Error(t, err)
+}
@@ -58,6 +58,20 @@ type ClearTextMessage struct {
 	Signature []byte
 }
 
+// DecryptionResult stores a decrypted message with its session key, and with
+// what decrypted the session key.
+type DecryptionResult struct {
+	// The decrypted message
+	Message *PlainMessage
+	// The session key of the message
+	SessionKey *SessionKey
+	// The ID of the private key that decrypted the session key, 0 if a
+	// password did
+	KeyID uint64
+	// If the session key was decrypted with a password
+	IsPasswordDecrypted bool
+}
+
 // ---- GENERATORS -----
 
 // NewPlainMessage generates a new binary PlainMessage ready for encryption,
@@ -254,6 +268,7 @@ func (msg *PGPMessage) GetArmoredWithCustomHeaders(comment, version string) (str
 }
 
 // GetEncryptionKeyIDs Returns the key IDs of the keys to which the session key is encrypted.
+// Hidden recipients have a wildcard key ID of 0, see HasHiddenRecipients.
 func (msg *PGPMessage) GetEncryptionKeyIDs() ([]uint64, bool) {
 	packets := packet.NewReader(bytes.NewReader(msg.Data))
 	var err error
@@ -282,6 +297,18 @@ Loop:
 	return ids, false
 }
 
+// HasHiddenRecipients returns whether the session key is encrypted to hidden
+// recipients, whose key packets have a wildcard key ID.
+func (msg *PGPMessage) HasHiddenRecipients() bool {
+	ids, _ := msg.GetEncryptionKeyIDs()
+	for _, id := range ids {
+		if id == 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // GetHexEncryptionKeyIDs Returns the key IDs of the keys to which the session key is encrypted.
 func (msg *PGPMessage) GetHexEncryptionKeyIDs() ([]string, bool) {
 	return getHexKeyIDs(msg.GetEncryptionKeyIDs())
@@ -328,7 +355,8 @@ func (msg *PGPSplitMessage) GetPGPMessage() *PGPMessage {
 // Parameters are for backwards compatibility and are unused.
 func (msg *PGPMessage) SplitMessage() (*PGPSplitMessage, error) {
 	bytesReader := bytes.NewReader(msg.Data)
-	packets := packet.NewReader(bytesReader)
+	// Read opaque packets, as the packet reader skips the key packets it cannot parse
+	packets := packet.NewOpaqueReader(bytesReader)
 	splitPoint := int64(0)
 Loop:
 	for {
@@ -339,10 +367,10 @@ Loop:
 		if err != nil {
 			return nil, err
 		}
-		switch p.(type) {
-		case *packet.SymmetricKeyEncrypted, *packet.EncryptedKey:
+		switch p.Tag {
+		case packetTagPublicKeyEncrypted, packetTagSymmetricKeyEncrypted:
 			splitPoint = bytesReader.Size() - int64(bytesReader.Len())
-		case *packet.SymmetricallyEncrypted, *packet.AEADEncrypted:
+		case packetTagSymmetricallyEncrypted, packetTagSymmetricallyEncryptedMDC, packetTagAEADEncrypted:
 			break Loop
 		}
 	}
@@ -410,6 +438,15 @@ func (msg *ClearTextMessage) GetArmored() (string, error) {
 	return str, nil
 }
 
+// GetHexKeyID returns the hex ID of the private key that decrypted the
+// session key, or an empty string if it was decrypted with a password.
+func (result *DecryptionResult) GetHexKeyID() string {
+	if result.IsPasswordDecrypted {
+		return ""
+	}
+	return keyIDToHex(result.KeyID)
+}
+
 // ---- UTILS -----
 
 // IsPGPMessage checks if data if has armored PGP message format.
@@ -0,0 +1,179 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+)
+
+const (
+	publicKeyEncryptedVersion3     = 3
+	symmetricallyEncryptedVersion2 = 2
+)
+
+// ReshareOptions describes how the key packet of a split message is changed by
+// PGPSplitMessage.Reshare: the recipients and passwords to add, the key IDs to
+// remove, and whether the existing key packets are kept.
+type ReshareOptions struct {
+	recipients    []*KeyRing
+	passwords     [][]byte
+	removedKeyIDs map[uint64]bool
+	replace       bool
+}
+
+// NewReshareOptions returns empty reshare options, which keep the existing
+// key packets.
+func NewReshareOptions() *ReshareOptions {
+	return &ReshareOptions{
+		removedKeyIDs: make(map[uint64]bool),
+	}
+}
+
+// AddRecipients adds the keys of the keyring to the recipients of the message.
+func (options *ReshareOptions) AddRecipients(keyRing *KeyRing) {
+	options.recipients = append(options.recipients, keyRing)
+}
+
+// AddPassword adds a password which decrypts the message.
+func (options *ReshareOptions) AddPassword(password []byte) {
+	options.passwords = append(options.passwords, clone(password))
+}
+
+// RemoveKeyID removes the key packet encrypted to the key with the given ID,
+// as returned by PGPMessage.GetEncryptionKeyIDs.
+func (options *ReshareOptions) RemoveKeyID(keyID uint64) {
+	options.removedKeyIDs[keyID] = true
+}
+
+// RemoveHexKeyID removes the key packet encrypted to the key with the given
+// hex ID.
+func (options *ReshareOptions) RemoveHexKeyID(hexKeyID string) error {
+	keyID, err := strconv.ParseUint(hexKeyID, 16, 64)
+	if err != nil {
+		return errors.Wrap(err, "gopenpgp: invalid key ID")
+	}
+	options.RemoveKeyID(keyID)
+	return nil
+}
+
+// SetReplace sets whether all the existing key packets are dropped, so that
+// only the added recipients and passwords can decrypt the message.
+func (options *ReshareOptions) SetReplace(replace bool) {
+	options.replace = replace
+}
+
+// Reshare returns a split message whose key packet is changed as described by
+// the options, sharing the session key decrypted with decryptionKeyRing.
+// Existing key packets encrypted to a recipient that is added again are
+// replaced. The data packet is left byte-identical.
+func (msg *PGPSplitMessage) Reshare(decryptionKeyRing *KeyRing, options *ReshareOptions) (*PGPSplitMessage, error) {
+	if options == nil {
+		return nil, errors.New("gopenpgp: no reshare options provided")
+	}
+
+	sk, err := decryptionKeyRing.DecryptSessionKey(msg.KeyPacket)
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to decrypt the session key to reshare")
+	}
+	defer sk.Clear()
+
+	var newKeyPackets bytes.Buffer
+	replacedKeyIDs := make(map[uint64]bool)
+	for keyID := range options.removedKeyIDs {
+		replacedKeyIDs[keyID] = true
+	}
+	for _, keyRing := range options.recipients {
+		for _, e := range keyRing.entities {
+			if encryptionKey, ok := e.EncryptionKey(getNow()); ok {
+				replacedKeyIDs[encryptionKey.PublicKey.KeyId] = true
+			}
+		}
+	}
+
+	if !options.replace {
+		packets := packet.NewOpaqueReader(bytes.NewReader(msg.KeyPacket))
+		for {
+			p, err := packets.Next()
+			if err != nil {
+				break
+			}
+			if keyID, ok := getPublicKeyEncryptedKeyID(p); ok && replacedKeyIDs[keyID] {
+				continue
+			}
+			if err = p.Serialize(&newKeyPackets); err != nil {
+				return nil, errors.Wrap(err, "gopenpgp: error in writing key packet")
+			}
+		}
+	}
+
+	for _, keyRing := range options.recipients {
+		keyPacket, err := keyRing.EncryptSessionKey(sk)
+		if err != nil {
+			return nil, err
+		}
+		newKeyPackets.Write(keyPacket)
+	}
+
+	// Version 2 data packets are preceded by version 6 symmetric key
+	// encrypted session key packets, with the same AEAD mode
+	mode, isAEAD := getSymmetricallyEncryptedV2Mode(msg.DataPacket)
+	for _, password := range options.passwords {
+		if !isAEAD {
+			keyPacket, err := EncryptSessionKeyWithPassword(sk, password)
+			if err != nil {
+				return nil, err
+			}
+			newKeyPackets.Write(keyPacket)
+			continue
+		}
+		if len(password) == 0 {
+			return nil, errors.New("gopenpgp: password can't be empty")
+		}
+		cf, err := sk.GetCipherFunc()
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: unable to encrypt session key with password")
+		}
+		config := &packet.Config{
+			DefaultCipher: cf,
+			AEADConfig:    &packet.AEADConfig{DefaultMode: mode},
+		}
+		err = packet.SerializeSymmetricKeyEncryptedAEADReuseKey(&newKeyPackets, sk.Key, password, true, config)
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: unable to encrypt session key with password")
+		}
+	}
+
+	if newKeyPackets.Len() == 0 {
+		return nil, errors.New("gopenpgp: no recipient left for the message")
+	}
+
+	return NewPGPSplitMessage(newKeyPackets.Bytes(), msg.DataPacket), nil
+}
+
+// getPublicKeyEncryptedKeyID returns the key ID of a version 3 public-key
+// encrypted session key packet.
+func getPublicKeyEncryptedKeyID(p *packet.OpaquePacket) (uint64, bool) {
+	if p.Tag != packetTagPublicKeyEncrypted || len(p.Contents) < 9 ||
+		p.Contents[0] != publicKeyEncryptedVersion3 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(p.Contents[1:9]), true
+}
+
+// getSymmetricallyEncryptedV2Mode returns the AEAD mode of a version 2
+// symmetrically encrypted integrity protected data packet. Only the packet
+// header is parsed, as the data packet may be large.
+func getSymmetricallyEncryptedV2Mode(dataPacket []byte) (packet.AEADMode, bool) {
+	p, err := packet.Read(bytes.NewReader(dataPacket))
+	if err != nil {
+		return 0, false
+	}
+	se, ok := p.(*packet.SymmetricallyEncrypted)
+	if !ok || se.Version != symmetricallyEncryptedVersion2 {
+		return 0, false
+	}
+	return se.Mode, true
+}
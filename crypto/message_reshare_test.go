@@ -0,0 +1,137 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+func TestPGPSplitMessageReshare(t *testing.T) {
+	var message = NewPlainMessageFromString("The secret code is... 1, 2, 3, 4, 5")
+
+	ciphertext, err := keyRingTestPublic.Encrypt(message, nil)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	split, err := ciphertext.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error when splitting, got:", err)
+	}
+
+	newKeyRing, err := NewKeyRing(keyTestEC)
+	if err != nil {
+		t.Fatal("Expected no error when building the keyring, got:", err)
+	}
+	oldKeyIDs, _ := split.GetPGPMessage().GetEncryptionKeyIDs()
+
+	// Add a recipient and a password
+	options := NewReshareOptions()
+	options.AddRecipients(newKeyRing)
+	options.AddPassword(testSymmetricKey)
+	reshared, err := split.Reshare(keyRingTestPrivate, options)
+	if err != nil {
+		t.Fatal("Expected no error when resharing, got:", err)
+	}
+	assert.Exactly(t, split.GetBinaryDataPacket(), reshared.GetBinaryDataPacket())
+
+	for _, keyRing := range []*KeyRing{keyRingTestPrivate, newKeyRing} {
+		decrypted, err := keyRing.Decrypt(reshared.GetPGPMessage(), nil, 0)
+		if err != nil {
+			t.Fatal("Expected no error when decrypting, got:", err)
+		}
+		assert.Exactly(t, message.GetString(), decrypted.GetString())
+	}
+	decrypted, err := DecryptMessageWithPassword(reshared.GetPGPMessage(), testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting with the password, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+
+	// Resharing to the same recipient replaces its key packet
+	reshared, err = reshared.Reshare(newKeyRing, options)
+	if err != nil {
+		t.Fatal("Expected no error when resharing, got:", err)
+	}
+	keyIDs, _ := reshared.GetPGPMessage().GetEncryptionKeyIDs()
+	assert.Len(t, keyIDs, 2)
+
+	// Remove the original recipient
+	options = NewReshareOptions()
+	options.RemoveKeyID(oldKeyIDs[0])
+	removed, err := reshared.Reshare(newKeyRing, options)
+	if err != nil {
+		t.Fatal("Expected no error when resharing, got:", err)
+	}
+	_, err = keyRingTestPrivate.Decrypt(removed.GetPGPMessage(), nil, 0)
+	assert.NotNil(t, err)
+	_, err = newKeyRing.Decrypt(removed.GetPGPMessage(), nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+
+	// Replace all the recipients
+	options = NewReshareOptions()
+	options.SetReplace(true)
+	options.AddRecipients(keyRingTestPublic)
+	replaced, err := reshared.Reshare(newKeyRing, options)
+	if err != nil {
+		t.Fatal("Expected no error when resharing, got:", err)
+	}
+	keyIDs, _ = replaced.GetPGPMessage().GetEncryptionKeyIDs()
+	assert.Exactly(t, oldKeyIDs, keyIDs)
+	_, err = DecryptMessageWithPassword(replaced.GetPGPMessage(), testSymmetricKey)
+	assert.NotNil(t, err)
+	assert.Exactly(t, split.GetBinaryDataPacket(), replaced.GetBinaryDataPacket())
+
+	// Remove every recipient
+	options = NewReshareOptions()
+	options.SetReplace(true)
+	_, err = reshared.Reshare(newKeyRing, options)
+	assert.NotNil(t, err)
+}
+
+func TestPGPSplitMessageReshareAEAD(t *testing.T) {
+	encrypted, err := EncryptMessageWithPasswordAndOptions(
+		NewPlainMessageFromString("Hello"),
+		testSymmetricKey,
+		NewPasswordEncryptionOptions(nil, constants.AEADOCB),
+	)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	split, err := encrypted.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error when splitting, got:", err)
+	}
+	mode, ok := getSymmetricallyEncryptedV2Mode(split.GetBinaryDataPacket())
+	assert.True(t, ok)
+	assert.EqualValues(t, 2, mode)
+
+	// Share the message with a key first, to reshare it with a password
+	sk, err := DecryptSessionKeyWithPassword(split.GetBinaryKeyPacket(), testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting the session key, got:", err)
+	}
+	keyPacket, err := keyRingTestPublic.EncryptSessionKey(sk)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting the session key, got:", err)
+	}
+	split = NewPGPSplitMessage(keyPacket, split.GetBinaryDataPacket())
+
+	options := NewReshareOptions()
+	options.AddPassword([]byte("new password"))
+	reshared, err := split.Reshare(keyRingTestPrivate, options)
+	if err != nil {
+		t.Fatal("Expected no error when resharing, got:", err)
+	}
+	decrypted, err := DecryptMessageWithPassword(reshared.GetPGPMessage(), []byte("new password"))
+	if err != nil {
+		t.Fatal("Expected no error when decrypting with the password, got:", err)
+	}
+	assert.Exactly(t, "Hello", decrypted.GetString())
+
+	_, ok = getSymmetricallyEncryptedV2Mode([]byte{0xd2, 0x05, 0x01, 0x00, 0x00})
+	assert.False(t, ok)
+}
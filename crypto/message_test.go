@@ -11,6 +11,8 @@ import (
 
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
 )
 
 func TestTextMessageEncryptionWithPassword(t *testing.T) {
@@ -92,6 +94,95 @@ func TestTextMixedMessageDecryptionWithPassword(t *testing.T) {
 	assert.Exactly(t, expected, decrypted.GetBinary())
 }
 
+func TestMessageEncryptionWithPasswordAndOptions(t *testing.T) {
+	var message = NewPlainMessageFromString("The secret code is... 1, 2, 3, 4, 5")
+
+	for _, aead := range []string{"", constants.AEADOCB, constants.AEADEAX, constants.AEADGCM} {
+		options := NewPasswordEncryptionOptions(getTestArgon2S2KParams(), aead)
+		encrypted, err := EncryptMessageWithPasswordAndOptions(message, testSymmetricKey, options)
+		if err != nil {
+			t.Fatal("Expected no error when encrypting, got:", err)
+		}
+
+		packets := packet.NewOpaqueReader(bytes.NewReader(encrypted.GetBinary()))
+		keyPacket, err := packets.Next()
+		if err != nil {
+			t.Fatal("Expected no error when reading key packet, got:", err)
+		}
+		dataPacket, err := packets.Next()
+		if err != nil {
+			t.Fatal("Expected no error when reading data packet, got:", err)
+		}
+		assert.Exactly(t, uint8(3), keyPacket.Tag)
+		assert.Exactly(t, uint8(18), dataPacket.Tag)
+		if aead == "" {
+			assert.Exactly(t, byte(4), keyPacket.Contents[0])
+			assert.Exactly(t, byte(1), dataPacket.Contents[0])
+		} else {
+			assert.Exactly(t, byte(6), keyPacket.Contents[0])
+			assert.Exactly(t, byte(2), dataPacket.Contents[0])
+		}
+
+		_, err = DecryptMessageWithPassword(encrypted, []byte("Wrong password"))
+		assert.NotNil(t, err)
+
+		decrypted, err := DecryptMessageWithPassword(encrypted, testSymmetricKey)
+		if err != nil {
+			t.Fatal("Expected no error when decrypting, got:", err)
+		}
+		assert.Exactly(t, message.GetString(), decrypted.GetString())
+	}
+
+	_, err := EncryptMessageWithPasswordAndOptions(message, testSymmetricKey, NewPasswordEncryptionOptions(nil, "cfb"))
+	assert.Error(t, err)
+
+	_, err = EncryptMessageWithPasswordAndOptions(message, testSymmetricKey, NewPasswordEncryptionOptions(NewIteratedS2KParams(1024), ""))
+	assert.Error(t, err)
+}
+
+func TestSplitMessageWithPasswordAndAEAD(t *testing.T) {
+	var message = NewPlainMessageFromString("The secret code is... 1, 2, 3, 4, 5")
+
+	encrypted, err := EncryptMessageWithPasswordAndOptions(
+		message,
+		testSymmetricKey,
+		NewPasswordEncryptionOptions(getTestArgon2S2KParams(), constants.AEADOCB),
+	)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	split, err := encrypted.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error when splitting, got:", err)
+	}
+	assert.Exactly(t, byte(0xc3), split.GetBinaryKeyPacket()[0])
+	assert.Exactly(t, byte(0xd2), split.GetBinaryDataPacket()[0])
+
+	sk, err := DecryptSessionKeyWithPassword(split.GetBinaryKeyPacket(), testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting session key, got:", err)
+	}
+	decrypted, err := sk.Decrypt(split.GetBinaryDataPacket())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), decrypted.GetString())
+}
+
+func TestMessageDecryptionWithArgon2(t *testing.T) {
+	encrypted, err := NewPGPMessageFromArmored(readTestFile("message_argon2", false))
+	if err != nil {
+		t.Fatal("Expected no error when unarmoring, got:", err)
+	}
+
+	decrypted, err := DecryptMessageWithPassword(encrypted, []byte("password"))
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, "Hello, world!", decrypted.GetString())
+}
+
 func TestTextMessageEncryption(t *testing.T) {
 	var message = NewPlainMessageFromString(
 		"The secret code is... 1, 2, 3, 4, 5. I repeat: the secret code is... 1, 2, 3, 4, 5",
@@ -0,0 +1,196 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	mnemonicSeedIterations = 2048
+	mnemonicSeedSize       = 64
+	mnemonicBitsPerWord    = 11
+	mnemonicKeyInfo        = "gopenpgp mnemonic key "
+)
+
+// GenerateMnemonic generates a random BIP-39 mnemonic recovery phrase of the
+// given number of words: 12, 15, 18, 21 or 24.
+func GenerateMnemonic(words int) (string, error) {
+	if words < 12 || words > 24 || words%3 != 0 {
+		return "", errors.New("gopenpgp: invalid number of mnemonic words")
+	}
+
+	entropy := make([]byte, words/3*4)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", errors.Wrap(err, "gopenpgp: error in generating mnemonic")
+	}
+
+	return newMnemonicFromEntropy(entropy), nil
+}
+
+// ValidateMnemonic checks that the mnemonic recovery phrase is made of words
+// of the BIP-39 English wordlist, and that its checksum is valid.
+func ValidateMnemonic(mnemonic string) error {
+	_, err := getMnemonicEntropy(mnemonic)
+	return err
+}
+
+// GenerateKeyFromMnemonic deterministically generates a key of the given
+// keyType ("rsa" or "x25519") from a mnemonic recovery phrase, with the given
+// creation time. Generating a key again with the same mnemonic, keyType,
+// bits and creationTime gives a key with the same fingerprint, whatever the
+// name and email. If keyType is "rsa", bits is the RSA bitsize of the key.
+// If keyType is "x25519" bits is unused.
+func GenerateKeyFromMnemonic(
+	name, email string,
+	keyType string,
+	bits int,
+	mnemonic string,
+	creationTime int64,
+) (*Key, error) {
+	if _, err := getMnemonicEntropy(mnemonic); err != nil {
+		return nil, err
+	}
+
+	seed := getMnemonicSeed(mnemonic, "")
+	defer clearMem(seed)
+
+	random := hkdf.New(sha512.New, seed, nil, []byte(mnemonicKeyInfo+keyType))
+
+	cfg := getKeyGenerationConfig(keyType, bits)
+	cfg.Rand = random
+	cfg.Time = func() time.Time {
+		return time.Unix(creationTime, 0)
+	}
+
+	if keyType == "rsa" {
+		// Generate the primes of the primary key and of the subkey
+		cfg.RSAPrimes = make([]*big.Int, 4)
+		for i := range cfg.RSAPrimes {
+			prime, err := getDeterministicPrime(random, bits/2)
+			if err != nil {
+				return nil, err
+			}
+			cfg.RSAPrimes[i] = prime
+		}
+	}
+
+	return generateKeyWithConfig(name, email, cfg)
+}
+
+// --- Internal methods
+
+// normalizeMnemonic returns the words of the mnemonic, in lower case.
+func normalizeMnemonic(mnemonic string) []string {
+	return strings.Fields(strings.ToLower(mnemonic))
+}
+
+// newMnemonicFromEntropy encodes entropy, followed by the first bits of its
+// SHA-256 as checksum, into words of 11 bits each.
+func newMnemonicFromEntropy(entropy []byte) string {
+	checksum := sha256.Sum256(entropy)
+	data := append(clone(entropy), checksum[0])
+
+	words := make([]string, len(entropy)*8/32*3)
+	for i := range words {
+		index := 0
+		for bit := i * mnemonicBitsPerWord; bit < (i+1)*mnemonicBitsPerWord; bit++ {
+			index = index<<1 | int(data[bit/8]>>(7-bit%8)&1)
+		}
+		words[i] = mnemonicWordlist[index]
+	}
+
+	return strings.Join(words, " ")
+}
+
+// getMnemonicEntropy decodes the entropy of the mnemonic, checking its
+// checksum.
+func getMnemonicEntropy(mnemonic string) ([]byte, error) {
+	words := normalizeMnemonic(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, errors.New("gopenpgp: invalid number of mnemonic words")
+	}
+
+	data := make([]byte, (len(words)*mnemonicBitsPerWord+7)/8)
+	for i, word := range words {
+		index := sort.SearchStrings(mnemonicWordlist, word)
+		if index == len(mnemonicWordlist) || mnemonicWordlist[index] != word {
+			return nil, errors.New("gopenpgp: unknown mnemonic word: " + word)
+		}
+
+		for bit := 0; bit < mnemonicBitsPerWord; bit++ {
+			if index>>(mnemonicBitsPerWord-1-bit)&1 == 1 {
+				position := i*mnemonicBitsPerWord + bit
+				data[position/8] |= 0x80 >> (position % 8)
+			}
+		}
+	}
+
+	entropy := data[:len(words)/3*4]
+	checksumBits := uint(len(words) / 3)
+	checksum := sha256.Sum256(entropy)
+	if checksum[0]>>(8-checksumBits) != data[len(entropy)]>>(8-checksumBits) {
+		return nil, errors.New("gopenpgp: invalid mnemonic checksum")
+	}
+
+	return entropy, nil
+}
+
+// getMnemonicSeed derives the BIP-39 seed of the mnemonic.
+func getMnemonicSeed(mnemonic, passphrase string) []byte {
+	normalized := strings.Join(normalizeMnemonic(mnemonic), " ")
+	return pbkdf2.Key(
+		[]byte(normalized),
+		[]byte("mnemonic"+passphrase),
+		mnemonicSeedIterations,
+		mnemonicSeedSize,
+		sha512.New,
+	)
+}
+
+// getDeterministicPrime reads a candidate from random, and returns the first
+// prime after it that is suitable for RSA with the public exponent 65537.
+func getDeterministicPrime(random io.Reader, bits int) (*big.Int, error) {
+	if bits < 64 {
+		return nil, errors.New("gopenpgp: invalid RSA key size")
+	}
+
+	candidate := make([]byte, (bits+7)/8)
+	if _, err := io.ReadFull(random, candidate); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in generating prime")
+	}
+
+	// Set the two most significant bits, so that the product of two primes
+	// has exactly twice their size, and make the candidate odd.
+	candidate[0] &= byte(0xff >> (uint(len(candidate)*8 - bits)))
+	prime := new(big.Int).SetBytes(candidate)
+	prime.SetBit(prime, bits-1, 1)
+	prime.SetBit(prime, bits-2, 1)
+	prime.SetBit(prime, 0, 1)
+
+	e := big.NewInt(65537)
+	one := big.NewInt(1)
+	two := big.NewInt(2)
+	pMinus1 := new(big.Int)
+	for {
+		if prime.ProbablyPrime(20) && pMinus1.Mod(pMinus1.Sub(prime, one), e).Sign() != 0 {
+			break
+		}
+		prime.Add(prime, two)
+	}
+
+	if prime.BitLen() != bits {
+		return nil, errors.New("gopenpgp: error in generating prime")
+	}
+
+	return prime, nil
+}
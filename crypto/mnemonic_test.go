@@ -0,0 +1,154 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const mnemonicTestCreationTime = int64(1500000000)
+
+func TestMnemonicVectors(t *testing.T) {
+	// Test vectors of BIP-39, with passphrase "TREZOR"
+	vectors := []struct {
+		entropy, mnemonic, seed string
+	}{
+		{
+			"00000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+		},
+		{
+			"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			"legal winner thank year wave sausage worth useful legal winner thank yellow",
+			"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+		},
+	}
+
+	for _, vector := range vectors {
+		entropy, _ := hex.DecodeString(vector.entropy)
+		assert.Exactly(t, vector.mnemonic, newMnemonicFromEntropy(entropy))
+
+		decoded, err := getMnemonicEntropy(vector.mnemonic)
+		if err != nil {
+			t.Fatal("Expected no error while decoding mnemonic, got:", err)
+		}
+		assert.Exactly(t, entropy, decoded)
+
+		assert.Exactly(t, vector.seed, hex.EncodeToString(getMnemonicSeed(vector.mnemonic, "TREZOR")))
+	}
+}
+
+func TestGenerateAndValidateMnemonic(t *testing.T) {
+	for _, words := range []int{12, 15, 18, 21, 24} {
+		mnemonic, err := GenerateMnemonic(words)
+		if err != nil {
+			t.Fatal("Expected no error while generating mnemonic, got:", err)
+		}
+		assert.Len(t, strings.Fields(mnemonic), words)
+		assert.NoError(t, ValidateMnemonic(mnemonic))
+		assert.NoError(t, ValidateMnemonic(" "+strings.ToUpper(mnemonic)+"\n"))
+	}
+
+	_, err := GenerateMnemonic(13)
+	assert.Error(t, err)
+
+	// Invalid checksum
+	assert.Error(t, ValidateMnemonic(strings.Repeat("abandon ", 12)))
+	// Unknown word
+	assert.Error(t, ValidateMnemonic(strings.Repeat("abandon ", 11)+"gopenpgp"))
+	// Invalid length
+	assert.Error(t, ValidateMnemonic(strings.Repeat("abandon ", 8)+"about"))
+}
+
+func TestGenerateKeyFromMnemonicKnownAnswer(t *testing.T) {
+	// Any change of the derivation would make the keys of existing recovery
+	// phrases unrecoverable
+	mnemonic := strings.Repeat("abandon ", 11) + "about"
+	vectors := []struct {
+		keyType     string
+		bits        int
+		fingerprint string
+	}{
+		{"x25519", 0, "54486088f3dd793dd2ffe0afeda655fd32b865d0"},
+		{"rsa", 2048, "24c62bc11071d3cba0891a6a341312957d41181a"},
+	}
+
+	for _, vector := range vectors {
+		key, err := GenerateKeyFromMnemonic(keyTestName, keyTestDomain, vector.keyType, vector.bits, mnemonic, 1600000000)
+		if err != nil {
+			t.Fatal("Expected no error while generating key from mnemonic, got:", err)
+		}
+		assert.Exactly(t, vector.fingerprint, key.GetFingerprint(), vector.keyType)
+	}
+}
+
+func TestGenerateKeyFromMnemonic(t *testing.T) {
+	mnemonic, err := GenerateMnemonic(24)
+	if err != nil {
+		t.Fatal("Expected no error while generating mnemonic, got:", err)
+	}
+
+	for _, keyType := range []string{"x25519", "rsa"} {
+		key, err := GenerateKeyFromMnemonic(keyTestName, keyTestDomain, keyType, 1024, mnemonic, mnemonicTestCreationTime)
+		if err != nil {
+			t.Fatal("Expected no error while generating key from mnemonic, got:", err)
+		}
+		assert.Exactly(t, mnemonicTestCreationTime, key.entity.PrimaryKey.CreationTime.Unix())
+
+		regenerated, err := GenerateKeyFromMnemonic("Other", "other@example.com", keyType, 1024, mnemonic, mnemonicTestCreationTime)
+		if err != nil {
+			t.Fatal("Expected no error while generating key from mnemonic, got:", err)
+		}
+		assert.Exactly(t, key.GetFingerprint(), regenerated.GetFingerprint())
+		assert.Exactly(t, key.entity.Subkeys[0].PublicKey.Fingerprint, regenerated.entity.Subkeys[0].PublicKey.Fingerprint)
+
+		later, err := GenerateKeyFromMnemonic(keyTestName, keyTestDomain, keyType, 1024, mnemonic, mnemonicTestCreationTime+1)
+		if err != nil {
+			t.Fatal("Expected no error while generating key from mnemonic, got:", err)
+		}
+		assert.NotEqual(t, key.GetFingerprint(), later.GetFingerprint())
+
+		keyRing, err := NewKeyRing(key)
+		if err != nil {
+			t.Fatal("Expected no error while building keyring, got:", err)
+		}
+		regeneratedKeyRing, err := NewKeyRing(regenerated)
+		if err != nil {
+			t.Fatal("Expected no error while building keyring, got:", err)
+		}
+
+		message := NewPlainMessageFromString("recovered")
+		encrypted, err := keyRing.Encrypt(message, nil)
+		if err != nil {
+			t.Fatal("Expected no error while encrypting, got:", err)
+		}
+		decrypted, err := regeneratedKeyRing.Decrypt(encrypted, nil, 0)
+		if err != nil {
+			t.Fatal("Expected no error while decrypting with regenerated key, got:", err)
+		}
+		assert.Exactly(t, "recovered", decrypted.GetString())
+	}
+
+	_, err = GenerateKeyFromMnemonic(keyTestName, keyTestDomain, "x25519", 0, "abandon about", mnemonicTestCreationTime)
+	assert.Error(t, err)
+}
+
+func TestDeterministicPrime(t *testing.T) {
+	seed := bytes.Repeat([]byte{1}, 64)
+	prime, err := getDeterministicPrime(bytes.NewReader(seed), 512)
+	if err != nil {
+		t.Fatal("Expected no error while generating prime, got:", err)
+	}
+	assert.Exactly(t, 512, prime.BitLen())
+	assert.True(t, prime.ProbablyPrime(20))
+
+	again, err := getDeterministicPrime(bytes.NewReader(seed), 512)
+	if err != nil {
+		t.Fatal("Expected no error while generating prime, got:", err)
+	}
+	assert.Exactly(t, 0, prime.Cmp(again))
+}
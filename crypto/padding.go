@@ -0,0 +1,189 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"io"
+	"strconv"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/pkg/errors"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+const packetTagPadding = 21
+
+// Padding modes.
+const (
+	paddingPowerOfTwo = iota
+	paddingFixedBlock
+)
+
+// PaddingPolicy describes the size to which encrypted data is padded with a
+// padding packet (https://www.rfc-editor.org/rfc/rfc9580#section-5.14),
+// so that the ciphertext size doesn't reveal the exact plaintext length.
+// The padding packet is encrypted along with the data, after the literal data,
+// signature and compressed packets, and is ignored on decryption.
+type PaddingPolicy struct {
+	mode      int
+	blockSize int
+}
+
+// NewPowerOfTwoPaddingPolicy returns a padding policy padding the encrypted
+// data to the next power of two.
+func NewPowerOfTwoPaddingPolicy() *PaddingPolicy {
+	return &PaddingPolicy{mode: paddingPowerOfTwo}
+}
+
+// NewFixedBlockPaddingPolicy returns a padding policy padding the encrypted
+// data to the next multiple of blockSize bytes.
+func NewFixedBlockPaddingPolicy(blockSize int) (*PaddingPolicy, error) {
+	if blockSize <= 0 {
+		return nil, errors.New("gopenpgp: invalid padding block size")
+	}
+	return &PaddingPolicy{mode: paddingFixedBlock, blockSize: blockSize}, nil
+}
+
+// getPaddedLength returns the length to which length bytes of data and their
+// padding packet are padded, leaving room for the smallest padding packet.
+// The framing of the encrypted data packet, which depends on how the data is
+// written, is not included and can vary by a few bytes.
+func (policy *PaddingPolicy) getPaddedLength(length int64) int64 {
+	minLength := length + 2
+	switch policy.mode {
+	case paddingFixedBlock:
+		blockSize := int64(policy.blockSize)
+		return (minLength + blockSize - 1) / blockSize * blockSize
+	default:
+		paddedLength := int64(1)
+		for paddedLength < minLength {
+			paddedLength <<= 1
+		}
+		return paddedLength
+	}
+}
+
+// paddingWriteCloser counts the data written to the encrypted data packet, and
+// writes the padding packet before closing it.
+type paddingWriteCloser struct {
+	writer  io.WriteCloser
+	policy  *PaddingPolicy
+	written int64
+}
+
+func newPaddingWriteCloser(writer io.WriteCloser, policy *PaddingPolicy) *paddingWriteCloser {
+	return &paddingWriteCloser{writer: writer, policy: policy}
+}
+
+func (w *paddingWriteCloser) Write(b []byte) (n int, err error) {
+	n, err = w.writer.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *paddingWriteCloser) Close() error {
+	paddingLength := w.policy.getPaddedLength(w.written) - w.written
+	if err := serializePaddingPacket(w.writer, paddingLength); err != nil {
+		return err
+	}
+	return w.writer.Close()
+}
+
+// encryptSplitWithSessionKey works like openpgp.EncryptSplit, writing the key
+// packets of the recipients to keyPacketWriter and returning a writer for the
+// plaintext data, with the data packet padded as described by the policy if
+// any. If intendedRecipients is set, the signature lists the recipients as its
+// intended recipients.
+func encryptSplitWithSessionKey(
+	hints *openpgp.FileHints,
+	keyPacketWriter, dataPacketWriter io.Writer,
+	to openpgp.EntityList,
+	signEntity *openpgp.Entity,
+	config *packet.Config,
+	padding *PaddingPolicy,
+	intendedRecipients bool,
+) (io.WriteCloser, error) {
+	sk, err := GenerateSessionKeyAlgo(constants.AES256)
+	if err != nil {
+		return nil, err
+	}
+	defer sk.Clear()
+
+	for _, entity := range to {
+		encryptionKey, ok := entity.EncryptionKey(config.Now())
+		if !ok {
+			return nil, errors.New(
+				"gopenpgp: cannot encrypt a message to key id " +
+					strconv.FormatUint(entity.PrimaryKey.KeyId, 16) +
+					" because it has no valid encryption keys",
+			)
+		}
+		err = packet.SerializeEncryptedKey(keyPacketWriter, encryptionKey.PublicKey, packet.CipherAES256, sk.Key, config)
+		if err != nil {
+			return nil, errors.Wrap(err, "gopenpgp: error in encrypting asymmetrically")
+		}
+	}
+
+	var recipients []*packet.Recipient
+	if intendedRecipients {
+		recipients = getIntendedRecipients(to)
+	}
+
+	encryptWriter, signWriter, err := encryptStreamWithSessionKeyAndConfig(
+		hints.IsBinary,
+		hints.FileName,
+		uint32(hints.ModTime.Unix()),
+		dataPacketWriter,
+		sk,
+		signEntity,
+		config,
+		padding,
+		recipients,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if signWriter != nil {
+		return &signAndEncryptWriteCloser{signWriter, encryptWriter}, nil
+	}
+	return encryptWriter, nil
+}
+
+// serializePaddingPacket writes a padding packet of packetLength bytes,
+// header included, with random contents. The five-octet length is used when
+// the shorter ones can't give the exact packet length.
+func serializePaddingPacket(w io.Writer, packetLength int64) error {
+	var header []byte
+	var contentsLength int64
+	switch {
+	case packetLength-2 < 192:
+		contentsLength = packetLength - 2
+		header = []byte{0xc0 | packetTagPadding, byte(contentsLength)}
+	case packetLength-3 >= 192 && packetLength-3 < 8384:
+		contentsLength = packetLength - 3
+		header = []byte{
+			0xc0 | packetTagPadding,
+			byte((contentsLength-192)>>8) + 192,
+			byte(contentsLength - 192),
+		}
+	default:
+		contentsLength = packetLength - 6
+		header = []byte{
+			0xc0 | packetTagPadding,
+			255,
+			byte(contentsLength >> 24),
+			byte(contentsLength >> 16),
+			byte(contentsLength >> 8),
+			byte(contentsLength),
+		}
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return errors.Wrap(err, "gopenpgp: error in writing padding packet")
+	}
+	if _, err := io.CopyN(w, rand.Reader, contentsLength); err != nil {
+		return errors.Wrap(err, "gopenpgp: error in writing padding packet")
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaddingPolicyPaddedLength(t *testing.T) {
+	powerOfTwo := NewPowerOfTwoPaddingPolicy()
+	assert.Exactly(t, int64(2), powerOfTwo.getPaddedLength(0))
+	assert.Exactly(t, int64(128), powerOfTwo.getPaddedLength(100))
+	assert.Exactly(t, int64(256), powerOfTwo.getPaddedLength(127))
+
+	fixedBlock, err := NewFixedBlockPaddingPolicy(1000)
+	if err != nil {
+		t.Fatal("Expected no error when creating padding policy, got:", err)
+	}
+	assert.Exactly(t, int64(1000), fixedBlock.getPaddedLength(0))
+	assert.Exactly(t, int64(1000), fixedBlock.getPaddedLength(998))
+	assert.Exactly(t, int64(2000), fixedBlock.getPaddedLength(999))
+
+	_, err = NewFixedBlockPaddingPolicy(0)
+	assert.Error(t, err)
+}
+
+func TestSerializePaddingPacket(t *testing.T) {
+	for _, packetLength := range []int64{2, 193, 194, 195, 8386, 8387, 8388, 100000} {
+		var buf bytes.Buffer
+		if err := serializePaddingPacket(&buf, packetLength); err != nil {
+			t.Fatal("Expected no error when writing padding packet, got:", err)
+		}
+		assert.Exactly(t, packetLength, int64(buf.Len()))
+
+		p, err := packet.NewOpaqueReader(&buf).Next()
+		if err != nil {
+			t.Fatal("Expected no error when reading padding packet, got:", err)
+		}
+		assert.Exactly(t, uint8(packetTagPadding), p.Tag)
+		assert.Exactly(t, 0, buf.Len())
+	}
+}
+
+func TestEncryptWithPadding(t *testing.T) {
+	padding := NewPowerOfTwoPaddingPolicy()
+
+	short, err := keyRingTestPublic.EncryptWithPadding(NewPlainMessageFromString("short"), keyRingTestPrivate, padding)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting with padding, got:", err)
+	}
+	long, err := keyRingTestPublic.EncryptWithPadding(NewPlainMessageFromString("a somewhat longer message"), keyRingTestPrivate, padding)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting with padding, got:", err)
+	}
+	// The key packet, signature and data packet framing vary by a few bytes
+	assert.InDelta(t, len(short.GetBinary()), len(long.GetBinary()), 8)
+
+	decrypted, err := keyRingTestPrivate.Decrypt(long, keyRingTestPublic, GetUnixTime())
+	if err != nil {
+		t.Fatal("Expected no error when decrypting padded message, got:", err)
+	}
+	assert.Exactly(t, "a somewhat longer message", decrypted.GetString())
+
+	_, err = keyRingTestPublic.EncryptWithPadding(NewPlainMessageFromString("short"), nil, nil)
+	assert.Error(t, err)
+}
+
+func TestEncryptStreamWithPadding(t *testing.T) {
+	padding, err := NewFixedBlockPaddingPolicy(4096)
+	if err != nil {
+		t.Fatal("Expected no error when creating padding policy, got:", err)
+	}
+	metadata := NewPlainMessageMetadata(true, "test.txt", testTime)
+
+	encrypt := func(data []byte) []byte {
+		var ciphertext bytes.Buffer
+		messageWriter, err := keyRingTestPublic.EncryptStreamWithPadding(&ciphertext, metadata, nil, padding)
+		if err != nil {
+			t.Fatal("Expected no error when encrypting stream with padding, got:", err)
+		}
+		if _, err = messageWriter.Write(data); err != nil {
+			t.Fatal("Expected no error when writing plaintext, got:", err)
+		}
+		if err = messageWriter.Close(); err != nil {
+			t.Fatal("Expected no error when closing plaintext writer, got:", err)
+		}
+		return ciphertext.Bytes()
+	}
+
+	data := make([]byte, 3000)
+	short := encrypt(data[:10])
+	long := encrypt(data)
+	assert.InDelta(t, len(short), len(long), 8)
+
+	reader, err := keyRingTestPrivate.DecryptStream(bytes.NewReader(long), nil, 0)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting padded stream, got:", err)
+	}
+	decrypted, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal("Expected no error when reading padded stream, got:", err)
+	}
+	assert.Exactly(t, data, decrypted)
+}
+
+func TestEncryptSplitStreamWithPadding(t *testing.T) {
+	var dataPacket bytes.Buffer
+	messageWriter, err := keyRingTestPublic.EncryptSplitStreamWithPadding(&dataPacket, nil, keyRingTestPrivate, NewPowerOfTwoPaddingPolicy())
+	if err != nil {
+		t.Fatal("Expected no error when encrypting split stream with padding, got:", err)
+	}
+	if _, err = io.WriteString(messageWriter, "hello padding"); err != nil {
+		t.Fatal("Expected no error when writing plaintext, got:", err)
+	}
+	if err = messageWriter.Close(); err != nil {
+		t.Fatal("Expected no error when closing plaintext writer, got:", err)
+	}
+	keyPacket, err := messageWriter.GetKeyPacket()
+	if err != nil {
+		t.Fatal("Expected no error when getting key packet, got:", err)
+	}
+
+	decrypted, err := keyRingTestPrivate.Decrypt(
+		NewPGPSplitMessage(keyPacket, dataPacket.Bytes()).GetPGPMessage(),
+		keyRingTestPublic,
+		GetUnixTime(),
+	)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting padded message, got:", err)
+	}
+	assert.Exactly(t, "hello padding", decrypted.GetString())
+}
+
+func TestSessionKeyEncryptWithPadding(t *testing.T) {
+	padding, err := NewFixedBlockPaddingPolicy(256)
+	if err != nil {
+		t.Fatal("Expected no error when creating padding policy, got:", err)
+	}
+
+	short, err := testSessionKey.EncryptWithPadding(NewPlainMessageFromString("short"), padding)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting with padding, got:", err)
+	}
+	long, err := testSessionKey.EncryptWithPadding(NewPlainMessageFromString("a somewhat longer message"), padding)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting with padding, got:", err)
+	}
+	assert.Exactly(t, len(short), len(long))
+
+	decrypted, err := testSessionKey.Decrypt(long)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting padded data packet, got:", err)
+	}
+	assert.Exactly(t, "a somewhat longer message", decrypted.GetString())
+}
+
+func TestAttachmentProcessorWithPadding(t *testing.T) {
+	padding, err := NewFixedBlockPaddingPolicy(1 << 16)
+	if err != nil {
+		t.Fatal("Expected no error when creating padding policy, got:", err)
+	}
+	data := []byte("attachment contents")
+
+	ap, err := keyRingTestPublic.NewLowMemoryAttachmentProcessorWithPadding(len(data), "file.txt", padding)
+	if err != nil {
+		t.Fatal("Expected no error when creating attachment processor, got:", err)
+	}
+	ap.Process(data)
+	split, err := ap.Finish()
+	if err != nil {
+		t.Fatal("Expected no error when finishing attachment, got:", err)
+	}
+	assert.Greater(t, len(split.GetBinaryDataPacket()), 1<<16)
+
+	decrypted, err := keyRingTestPrivate.DecryptAttachment(split)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting padded attachment, got:", err)
+	}
+	assert.Exactly(t, data, decrypted.GetBinary())
+
+	dataBuffer := make([]byte, 1<<17)
+	manual, err := keyRingTestPublic.NewManualAttachmentProcessorWithPadding(len(data), "file.txt", dataBuffer, padding)
+	if err != nil {
+		t.Fatal("Expected no error when creating manual attachment processor, got:", err)
+	}
+	if err = manual.Process(data); err != nil {
+		t.Fatal("Expected no error when processing attachment, got:", err)
+	}
+	if err = manual.Finish(); err != nil {
+		t.Fatal("Expected no error when finishing attachment, got:", err)
+	}
+	split = NewPGPSplitMessage(manual.GetKeyPacket(), dataBuffer[:manual.GetDataLength()])
+	decrypted, err = keyRingTestPrivate.DecryptAttachment(split)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting padded attachment, got:", err)
+	}
+	assert.Exactly(t, data, decrypted.GetBinary())
+}
@@ -1,8 +1,11 @@
 package crypto
 
 import (
+	"bufio"
 	"bytes"
 	"io"
+	"io/ioutil"
+	"time"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	pgpErrors "github.com/ProtonMail/go-crypto/openpgp/errors"
@@ -10,13 +13,58 @@ import (
 	"github.com/pkg/errors"
 )
 
+const (
+	packetTagPublicKeyEncrypted        = 1
+	packetTagSymmetricKeyEncrypted     = 3
+	packetTagSymmetricallyEncrypted    = 9
+	packetTagSymmetricallyEncryptedMDC = 18
+	packetTagAEADEncrypted             = 20
+	symmetricKeyEncryptedVersion6      = 6
+)
+
+// PasswordEncryptionOptions are the options to encrypt messages with a
+// password.
+type PasswordEncryptionOptions struct {
+	// S2K are the parameters of the key derivation from the password. If nil,
+	// iterated and salted S2K is used with default parameters.
+	S2K *S2KParams
+	// AEAD is the AEAD mode of the encrypted data (constants.AEADOCB,
+	// constants.AEADEAX or constants.AEADGCM), or empty to use an integrity
+	// protected data packet with MDC. With AEAD, the session key is encrypted
+	// in a version 6 symmetric key encrypted session key packet.
+	AEAD string
+}
+
+// NewPasswordEncryptionOptions returns password encryption options with the
+// given S2K parameters and AEAD mode.
+func NewPasswordEncryptionOptions(s2kParams *S2KParams, aead string) *PasswordEncryptionOptions {
+	return &PasswordEncryptionOptions{
+		S2K:  s2kParams,
+		AEAD: aead,
+	}
+}
+
 // EncryptMessageWithPassword encrypts a PlainMessage to PGPMessage with a
 // SymmetricKey.
 // * message : The plain data as a PlainMessage.
 // * password: A password that will be derived into an encryption key.
 // * output  : The encrypted data as PGPMessage.
 func EncryptMessageWithPassword(message *PlainMessage, password []byte) (*PGPMessage, error) {
-	encrypted, err := passwordEncrypt(message, password)
+	return EncryptMessageWithPasswordAndOptions(message, password, nil)
+}
+
+// EncryptMessageWithPasswordAndOptions encrypts a PlainMessage to PGPMessage
+// with a password, using the given S2K parameters and AEAD mode.
+// * message : The plain data as a PlainMessage.
+// * password: A password that will be derived into an encryption key.
+// * options : The S2K parameters and AEAD mode, nil for the defaults.
+// * output  : The encrypted data as PGPMessage.
+func EncryptMessageWithPasswordAndOptions(
+	message *PlainMessage,
+	password []byte,
+	options *PasswordEncryptionOptions,
+) (*PGPMessage, error) {
+	encrypted, err := passwordEncrypt(message, password, options)
 	if err != nil {
 		return nil, err
 	}
@@ -29,53 +77,49 @@ func EncryptMessageWithPassword(message *PlainMessage, password []byte) (*PGPMes
 // * password: A password that will be derived into an encryption key.
 // * output: The decrypted data as PlainMessage.
 func DecryptMessageWithPassword(message *PGPMessage, password []byte) (*PlainMessage, error) {
-	return passwordDecrypt(message.NewReader(), password)
+	plainMessage, _, err := passwordDecrypt(message.NewReader(), password)
+	return plainMessage, err
 }
 
-// DecryptSessionKeyWithPassword decrypts the binary symmetrically encrypted
-// session key packet and returns the session key.
-func DecryptSessionKeyWithPassword(keyPacket, password []byte) (*SessionKey, error) {
-	keyReader := bytes.NewReader(keyPacket)
-	packets := packet.NewReader(keyReader)
-
-	var symKeys []*packet.SymmetricKeyEncrypted
-	for {
-		var p packet.Packet
-		var err error
-		if p, err = packets.Next(); err != nil {
-			break
-		}
-
-		if p, ok := p.(*packet.SymmetricKeyEncrypted); ok {
-			symKeys = append(symKeys, p)
-		}
+// DecryptMessageWithPasswordAndGetSessionKey decrypts password protected pgp
+// binary messages, and returns the decrypted message with its session key.
+// * encrypted: The encrypted data as PGPMessage.
+// * password: A password that will be derived into an encryption key.
+// * output: The decrypted data and session key as DecryptionResult.
+func DecryptMessageWithPasswordAndGetSessionKey(message *PGPMessage, password []byte) (*DecryptionResult, error) {
+	plainMessage, sk, err := passwordDecrypt(message.NewReader(), password)
+	if err != nil {
+		return nil, err
 	}
 
-	// Try the symmetric passphrase first
-	if len(symKeys) != 0 && password != nil {
-		for _, s := range symKeys {
-			key, cipherFunc, err := s.Decrypt(password)
-			if err == nil {
-				sk := &SessionKey{
-					Key:  key,
-					Algo: getAlgo(cipherFunc),
-				}
-
-				if err = sk.checkSize(); err != nil {
-					return nil, errors.Wrap(err, "gopenpgp: unable to decrypt session key with password")
-				}
+	return &DecryptionResult{
+		Message:             plainMessage,
+		SessionKey:          sk,
+		IsPasswordDecrypted: true,
+	}, nil
+}
 
-				return sk, nil
-			}
-		}
+// DecryptSessionKeyWithPassword decrypts the binary symmetrically encrypted
+// session key packet and returns the session key.
+func DecryptSessionKeyWithPassword(keyPacket, password []byte) (*SessionKey, error) {
+	sessionKeys, _, err := decryptSessionKeysWithPassword(keyPacket, password)
+	if err != nil {
+		return nil, err
 	}
-
-	return nil, errors.New("gopenpgp: unable to decrypt any packet")
+	return sessionKeys[0], nil
 }
 
 // EncryptSessionKeyWithPassword encrypts the session key with the password and
 // returns a binary symmetrically encrypted session key packet.
 func EncryptSessionKeyWithPassword(sk *SessionKey, password []byte) ([]byte, error) {
+	return EncryptSessionKeyWithPasswordAndS2K(sk, password, nil)
+}
+
+// EncryptSessionKeyWithPasswordAndS2K encrypts the session key with the
+// password, derived with the given S2K parameters, and returns a binary
+// symmetrically encrypted session key packet. Nil parameters use iterated and
+// salted S2K with default parameters.
+func EncryptSessionKeyWithPasswordAndS2K(sk *SessionKey, password []byte, s2kParams *S2KParams) ([]byte, error) {
 	outbuf := &bytes.Buffer{}
 
 	cf, err := sk.GetCipherFunc()
@@ -91,8 +135,14 @@ func EncryptSessionKeyWithPassword(sk *SessionKey, password []byte) ([]byte, err
 		return nil, errors.Wrap(err, "gopenpgp: unable to encrypt session key with password")
 	}
 
+	s2kConfig, err := s2kParams.getConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	config := &packet.Config{
 		DefaultCipher: cf,
+		S2KConfig:     s2kConfig,
 	}
 
 	err = packet.SerializeSymmetricKeyEncryptedReuseKey(outbuf, sk.Key, password, config)
@@ -104,76 +154,305 @@ func EncryptSessionKeyWithPassword(sk *SessionKey, password []byte) ([]byte, err
 
 // ----- INTERNAL FUNCTIONS ------
 
-func passwordEncrypt(message *PlainMessage, password []byte) ([]byte, error) {
+func passwordEncrypt(message *PlainMessage, password []byte, options *PasswordEncryptionOptions) ([]byte, error) {
 	var outBuf bytes.Buffer
 
+	encryptWriter, err := passwordEncryptStream(
+		&outBuf,
+		NewPlainMessageMetadata(message.IsBinary(), message.Filename, int64(message.Time)),
+		password,
+		options,
+	)
+	if err != nil {
+		return nil, err
+	}
+	_, err = encryptWriter.Write(message.GetBinary())
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in writing data to message")
+	}
+
+	err = encryptWriter.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in closing writer")
+	}
+
+	return outBuf.Bytes(), nil
+}
+
+func passwordEncryptStream(
+	pgpMessageWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	password []byte,
+	options *PasswordEncryptionOptions,
+) (WriteCloser, error) {
+	if options == nil {
+		options = &PasswordEncryptionOptions{}
+	}
+	s2kConfig, err := options.S2K.getConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if plainMessageMetadata == nil {
+		// Use sensible default metadata
+		plainMessageMetadata = &PlainMessageMetadata{
+			IsBinary: true,
+			Filename: "",
+			ModTime:  GetUnixTime(),
+		}
+	}
+
 	config := &packet.Config{
 		DefaultCipher: packet.CipherAES256,
 		Time:          getTimeGenerator(),
+		S2KConfig:     s2kConfig,
+	}
+
+	if options.AEAD != "" {
+		mode, ok := aeadModes[options.AEAD]
+		if !ok {
+			return nil, errors.New("gopenpgp: unknown AEAD mode " + options.AEAD)
+		}
+		// The session key is encrypted in a version 6 symmetric key encrypted
+		// session key packet, followed by a version 2 data packet
+		config.AEADConfig = &packet.AEADConfig{DefaultMode: mode}
 	}
 
 	hints := &openpgp.FileHints{
-		IsBinary: message.IsBinary(),
-		FileName: message.Filename,
-		ModTime:  message.getFormattedTime(),
+		IsBinary: plainMessageMetadata.IsBinary,
+		FileName: plainMessageMetadata.Filename,
+		ModTime:  time.Unix(plainMessageMetadata.ModTime, 0),
 	}
 
-	encryptWriter, err := openpgp.SymmetricallyEncrypt(&outBuf, password, hints, config)
+	encryptWriter, err := openpgp.SymmetricallyEncrypt(pgpMessageWriter, password, hints, config)
 	if err != nil {
 		return nil, errors.Wrap(err, "gopenpgp: error in encrypting message symmetrically")
 	}
-	_, err = encryptWriter.Write(message.GetBinary())
+	return encryptWriter, nil
+}
+
+func passwordDecrypt(encryptedIO io.Reader, password []byte) (*PlainMessage, *SessionKey, error) {
+	keyPackets, encryptedIO := readKeyPackets(encryptedIO)
+	sessionKeys, authenticated, err := decryptSessionKeysWithPassword(keyPackets, password)
 	if err != nil {
-		return nil, errors.Wrap(err, "gopenpgp: error in writing data to message")
+		// Parsing errors when reading the message are most likely caused by incorrect password, but we cannot know for sure
+		return nil, nil, errors.New("gopenpgp: error in reading password protected message: wrong password or malformed message")
+	}
+	dataPacket, err := ioutil.ReadAll(encryptedIO)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "gopenpgp: error in reading password protected message")
 	}
 
-	err = encryptWriter.Close()
+	// The data packet is decrypted with each candidate session key, until
+	// one is correct
+	for _, sk := range sessionKeys {
+		var md *openpgp.MessageDetails
+		md, err = passwordDecryptWithSessionKey(sk, bytes.NewReader(dataPacket), authenticated)
+		if IsDecryptionLimitError(err) {
+			return nil, nil, err
+		}
+		if err != nil {
+			continue
+		}
+
+		messageBuf := bytes.NewBuffer(nil)
+		if _, err = io.Copy(messageBuf, md.UnverifiedBody); IsDecryptionLimitError(err) {
+			return nil, nil, err
+		}
+		if err != nil {
+			continue
+		}
+
+		return &PlainMessage{
+			Data:     messageBuf.Bytes(),
+			TextType: !md.LiteralData.IsBinary,
+			Filename: md.LiteralData.FileName,
+			Time:     md.LiteralData.Time,
+		}, sk, nil
+	}
+	return nil, nil, err
+}
+
+// passwordDecryptStream decrypts the password protected message as a stream,
+// with the candidate session key selected by selectStreamSessionKey.
+func passwordDecryptStream(encryptedIO io.Reader, password []byte) (*openpgp.MessageDetails, *SessionKey, error) {
+	keyPackets, encryptedIO := readKeyPackets(encryptedIO)
+	sessionKeys, authenticated, err := decryptSessionKeysWithPassword(keyPackets, password)
 	if err != nil {
-		return nil, errors.Wrap(err, "gopenpgp: error in closing writer")
+		// Parsing errors when reading the message are most likely caused by incorrect password, but we cannot know for sure
+		return nil, nil, errors.New("gopenpgp: error in reading password protected message: wrong password or malformed message")
 	}
 
-	return outBuf.Bytes(), nil
+	sk, encryptedIO, err := selectStreamSessionKey(sessionKeys, encryptedIO, func(sk *SessionKey, dataPacketReader io.Reader) (io.Reader, error) {
+		md, err := passwordDecryptWithSessionKey(sk, dataPacketReader, authenticated)
+		if err != nil {
+			return nil, err
+		}
+		return md.UnverifiedBody, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	md, err := passwordDecryptWithSessionKey(sk, encryptedIO, authenticated)
+	if err != nil {
+		return nil, nil, err
+	}
+	return md, sk, nil
 }
 
-func passwordDecrypt(encryptedIO io.Reader, password []byte) (*PlainMessage, error) {
-	firstTimeCalled := true
-	var prompt = func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
-		if firstTimeCalled {
-			firstTimeCalled = false
-			return password, nil
+// selectStreamSessionKey returns the candidate session key decrypting the data
+// packet, and the reader of the data packet to decrypt with it.
+// A wrong session key may decrypt the start of the data packet to a valid
+// packet header, and only fail the integrity check at its end. So if there are
+// several candidates, the data packet is buffered, and decrypted entirely with
+// each one until the integrity check succeeds. Decryption limit errors are
+// returned without trying the next session keys.
+func selectStreamSessionKey(
+	sessionKeys []*SessionKey,
+	dataPacketReader io.Reader,
+	decrypt func(sk *SessionKey, dataPacketReader io.Reader) (io.Reader, error),
+) (*SessionKey, io.Reader, error) {
+	if len(sessionKeys) == 1 {
+		return sessionKeys[0], dataPacketReader, nil
+	}
+
+	dataPacket, err := ioutil.ReadAll(dataPacketReader)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "gopenpgp: error in reading data packet")
+	}
+	for _, sk := range sessionKeys {
+		var plaintext io.Reader
+		if plaintext, err = decrypt(sk, bytes.NewReader(dataPacket)); err == nil {
+			_, err = io.Copy(ioutil.Discard, plaintext)
+		}
+		if err == nil {
+			return sk, bytes.NewReader(dataPacket), nil
+		}
+		if IsDecryptionLimitError(err) {
+			return nil, nil, err
 		}
-		// Re-prompt still occurs if SKESK pasrsing fails (i.e. when decrypted cipher algo is invalid).
-		// For most (but not all) cases, inputting a wrong passwords is expected to trigger this error.
-		return nil, errors.New("gopenpgp: wrong password in symmetric decryption")
 	}
+	return nil, nil, err
+}
 
-	config := &packet.Config{
-		Time: getTimeGenerator(),
+// passwordDecryptWithSessionKey decrypts the data packet of a password
+// protected message with the session key, replacing the errors with clear
+// ones.
+func passwordDecryptWithSessionKey(sk *SessionKey, dataPacketReader io.Reader, authenticated bool) (*openpgp.MessageDetails, error) {
+	// Parsing errors after decryption, triggered before parsing the MDC packet, are usually the result of wrong password
+	errorMessage := "gopenpgp: error in reading password protected message: wrong password or malformed message"
+	if authenticated {
+		// The session key packet is authenticated, errors come from the data
+		errorMessage = "gopenpgp: error in reading password protected message: corrupted message"
 	}
 
-	var emptyKeyRing openpgp.EntityList
-	md, err := openpgp.ReadMessage(encryptedIO, emptyKeyRing, prompt, config)
+	md, err := decryptStreamWithSessionKey(sk, dataPacketReader, nil, nil)
+	if IsDecryptionLimitError(err) {
+		return nil, err
+	}
 	if err != nil {
-		// Parsing errors when reading the message are most likely caused by incorrect password, but we cannot know for sure
-		return nil, errors.New("gopenpgp: error in reading password protected message: wrong password or malformed message")
+		return nil, errors.New(errorMessage)
 	}
 
-	messageBuf := bytes.NewBuffer(nil)
-	_, err = io.Copy(messageBuf, md.UnverifiedBody)
-	if errors.Is(err, pgpErrors.ErrMDCHashMismatch) {
+	md.UnverifiedBody = passwordDecryptReader{
+		md.UnverifiedBody,
+		errorMessage,
+	}
+	return md, nil
+}
+
+// passwordDecryptReader replaces the errors of reading the data of a password
+// protected message with clear errors.
+type passwordDecryptReader struct {
+	reader       io.Reader
+	errorMessage string
+}
+
+func (r passwordDecryptReader) Read(b []byte) (n int, err error) {
+	n, err = r.reader.Read(b)
+	switch {
+	case err == nil || errors.Is(err, io.EOF) || IsDecryptionLimitError(err):
+		return n, err
+	case errors.Is(err, pgpErrors.ErrMDCHashMismatch):
 		// This MDC error may also be triggered if the password is correct, but the encrypted data was corrupted.
 		// To avoid confusion, we do not inform the user about the second possibility.
-		return nil, errors.New("gopenpgp: wrong password in symmetric decryption")
+		return n, errors.New("gopenpgp: wrong password in symmetric decryption")
+	default:
+		return n, errors.New(r.errorMessage)
 	}
-	if err != nil {
-		// Parsing errors after decryption, triggered before parsing the MDC packet, are also usually the result of wrong password
-		return nil, errors.New("gopenpgp: error in reading password protected message: wrong password or malformed message")
+}
+
+// readKeyPackets reads the public-key and symmetric-key encrypted session key
+// packets at the start of the message. It returns them with the rest of the
+// message, which follows the key packets.
+func readKeyPackets(messageReader io.Reader) ([]byte, io.Reader) {
+	bufferedReader := bufio.NewReader(messageReader)
+	var keyPackets bytes.Buffer
+
+	for {
+		header, err := bufferedReader.Peek(1)
+		if err != nil || header[0]&0x80 == 0 {
+			break
+		}
+		if tag := getPacketTag(header[0]); tag != packetTagPublicKeyEncrypted && tag != packetTagSymmetricKeyEncrypted {
+			break
+		}
+
+		if _, err = packet.NewOpaqueReader(io.TeeReader(bufferedReader, &keyPackets)).Next(); err != nil {
+			break
+		}
 	}
 
-	return &PlainMessage{
-		Data:     messageBuf.Bytes(),
-		TextType: !md.LiteralData.IsBinary,
-		Filename: md.LiteralData.FileName,
-		Time:     md.LiteralData.Time,
-	}, nil
+	return keyPackets.Bytes(), bufferedReader
+}
+
+// decryptSessionKeysWithPassword decrypts with the password the session keys
+// of the symmetric key encrypted session key packets. Only version 6 packets
+// are authenticated: with a wrong password, other packets may decrypt to a
+// wrong session key, so the session keys of all of them are returned, to be
+// tried in turn. authenticated is true if the session key comes from a
+// version 6 packet, which is then the only one returned.
+func decryptSessionKeysWithPassword(keyPacket, password []byte) (sessionKeys []*SessionKey, authenticated bool, err error) {
+	packets := packet.NewReader(bytes.NewReader(keyPacket))
+
+	var symKeys []*packet.SymmetricKeyEncrypted
+	for {
+		var p packet.Packet
+		if p, err = packets.Next(); err != nil {
+			break
+		}
+
+		if p, ok := p.(*packet.SymmetricKeyEncrypted); ok {
+			symKeys = append(symKeys, p)
+		}
+	}
+
+	if password != nil {
+		for _, s := range symKeys {
+			key, cipherFunc, err := s.Decrypt(password)
+			if err != nil {
+				continue
+			}
+			if cipherFunc == 0 {
+				// Version 5 and 6 packets encrypt the session key with its cipher
+				cipherFunc = s.CipherFunc
+			}
+			sk := &SessionKey{
+				Key:  key,
+				Algo: getAlgo(cipherFunc),
+			}
+			if sk.checkSize() != nil {
+				continue
+			}
+			if s.Version == symmetricKeyEncryptedVersion6 {
+				return []*SessionKey{sk}, true, nil
+			}
+			sessionKeys = append(sessionKeys, sk)
+		}
+	}
+
+	if len(sessionKeys) == 0 {
+		return nil, false, errors.New("gopenpgp: unable to decrypt any packet")
+	}
+	return sessionKeys, false, nil
 }
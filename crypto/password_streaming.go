@@ -0,0 +1,49 @@
+package crypto
+
+// EncryptStreamWithPassword is used to encrypt data with a password as a Writer.
+// It takes a writer for the encrypted data and returns a WriteCloser for the plaintext data.
+// The encrypted message is complete once the WriteCloser is closed.
+func EncryptStreamWithPassword(
+	pgpMessageWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	password []byte,
+) (plainMessageWriter WriteCloser, err error) {
+	return passwordEncryptStream(pgpMessageWriter, plainMessageMetadata, password, nil)
+}
+
+// EncryptStreamWithPasswordAndOptions is used to encrypt data with a password as a Writer,
+// using the given S2K parameters and AEAD mode.
+// It takes a writer for the encrypted data and returns a WriteCloser for the plaintext data.
+// The encrypted message is complete once the WriteCloser is closed.
+func EncryptStreamWithPasswordAndOptions(
+	pgpMessageWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	password []byte,
+	options *PasswordEncryptionOptions,
+) (plainMessageWriter WriteCloser, err error) {
+	return passwordEncryptStream(pgpMessageWriter, plainMessageMetadata, password, options)
+}
+
+// DecryptStreamWithPassword is used to decrypt a password protected pgp message as a Reader.
+// It takes a reader for the message data
+// and returns a PlainMessageReader for the plaintext data.
+// A wrong password is reported either by DecryptStreamWithPassword, or by
+// PlainMessageReader.Read once the end of the message is reached: the data
+// must not be trusted until the reader has been read entirely.
+// If the password decrypts several symmetric key encrypted session key
+// packets, the data is buffered in memory, to check each of their session keys
+// against the whole data before streaming it.
+func DecryptStreamWithPassword(
+	message Reader,
+	password []byte,
+) (plainMessage *PlainMessageReader, err error) {
+	messageDetails, sk, err := passwordDecryptStream(message, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PlainMessageReader{
+		details:    messageDetails,
+		sessionKey: sk,
+	}, nil
+}
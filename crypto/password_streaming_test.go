@@ -0,0 +1,116 @@
+package crypto
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+func TestEncryptDecryptStreamWithPassword(t *testing.T) {
+	messageBytes := []byte("Hello World!")
+
+	for _, options := range []*PasswordEncryptionOptions{
+		nil,
+		NewPasswordEncryptionOptions(getTestArgon2S2KParams(), constants.AEADOCB),
+	} {
+		var ciphertextBuf bytes.Buffer
+		messageWriter, err := EncryptStreamWithPasswordAndOptions(&ciphertextBuf, testMeta, testSymmetricKey, options)
+		if err != nil {
+			t.Fatal("Expected no error while encrypting stream with password, got:", err)
+		}
+		for i := range messageBytes {
+			if _, err = messageWriter.Write(messageBytes[i : i+1]); err != nil {
+				t.Fatal("Expected no error while writing data, got:", err)
+			}
+		}
+		if err = messageWriter.Close(); err != nil {
+			t.Fatal("Expected no error while closing plaintext writer, got:", err)
+		}
+
+		decrypted, err := DecryptMessageWithPassword(NewPGPMessage(ciphertextBuf.Bytes()), testSymmetricKey)
+		if err != nil {
+			t.Fatal("Expected no error while decrypting message, got:", err)
+		}
+		assert.Exactly(t, messageBytes, decrypted.GetBinary())
+
+		decryptedReader, err := DecryptStreamWithPassword(bytes.NewReader(ciphertextBuf.Bytes()), testSymmetricKey)
+		if err != nil {
+			t.Fatal("Expected no error while decrypting stream with password, got:", err)
+		}
+		assert.Exactly(t, testMeta, decryptedReader.GetMetadata())
+		decryptedBytes, err := ioutil.ReadAll(decryptedReader)
+		if err != nil {
+			t.Fatal("Expected no error while reading the decrypted data, got:", err)
+		}
+		assert.Exactly(t, messageBytes, decryptedBytes)
+
+		_, err = DecryptStreamWithPassword(bytes.NewReader(ciphertextBuf.Bytes()), []byte("Wrong password"))
+		assert.Error(t, err)
+	}
+}
+
+func TestDecryptStreamWithPasswordCorrupted(t *testing.T) {
+	var ciphertextBuf bytes.Buffer
+	messageWriter, err := EncryptStreamWithPassword(&ciphertextBuf, testMeta, testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting stream with password, got:", err)
+	}
+	if _, err = messageWriter.Write([]byte("Hello World!")); err != nil {
+		t.Fatal("Expected no error while writing data, got:", err)
+	}
+	if err = messageWriter.Close(); err != nil {
+		t.Fatal("Expected no error while closing plaintext writer, got:", err)
+	}
+
+	// Corrupt the modification detection code
+	ciphertext := ciphertextBuf.Bytes()
+	ciphertext[len(ciphertext)-1] ^= 1
+
+	decryptedReader, err := DecryptStreamWithPassword(bytes.NewReader(ciphertext), testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting stream with password, got:", err)
+	}
+	_, err = ioutil.ReadAll(decryptedReader)
+	assert.EqualError(t, err, "gopenpgp: wrong password in symmetric decryption")
+}
+
+func TestDecryptStreamWithPasswordGetSessionKey(t *testing.T) {
+	var message = NewPlainMessageFromString("The secret code is... 1, 2, 3, 4, 5")
+
+	encrypted, err := EncryptMessageWithPassword(message, testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	split, err := encrypted.SplitMessage()
+	if err != nil {
+		t.Fatal("Expected no error when splitting, got:", err)
+	}
+	expectedSessionKey, err := DecryptSessionKeyWithPassword(split.GetBinaryKeyPacket(), testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting the session key, got:", err)
+	}
+
+	reader, err := DecryptStreamWithPassword(encrypted.NewReader(), testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	sk, err := reader.GetSessionKey()
+	if err != nil {
+		t.Fatal("Expected no error when getting the session key, got:", err)
+	}
+	assert.Exactly(t, expectedSessionKey, sk)
+	assert.Exactly(t, "", reader.GetHexDecryptionKeyID())
+
+	result, err := DecryptMessageWithPasswordAndGetSessionKey(encrypted, testSymmetricKey)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, message.GetString(), result.Message.GetString())
+	assert.Exactly(t, expectedSessionKey, result.SessionKey)
+	assert.True(t, result.IsPasswordDecrypted)
+	assert.Exactly(t, "", result.GetHexKeyID())
+}
@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"crypto"
+
+	"github.com/ProtonMail/go-crypto/openpgp/s2k"
+	"github.com/pkg/errors"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+// S2KParams are the parameters of the string-to-key function that derives
+// keys from passphrases.
+type S2KParams struct {
+	// Mode is constants.S2KIterated or constants.S2KArgon2.
+	Mode string
+	// Count is the number of hashed bytes of iterated and salted S2K, between
+	// 65536 and 65011712. It is rounded up to the next encodable value.
+	Count int
+	// Passes is the number of Argon2 passes.
+	Passes int
+	// Parallelism is the degree of parallelism of Argon2.
+	Parallelism int
+	// Memory is the Argon2 memory cost in KiB. It is rounded up to the next
+	// power of 2.
+	Memory int
+}
+
+// NewIteratedS2KParams returns parameters for iterated and salted S2K with
+// SHA-256, hashing count bytes.
+func NewIteratedS2KParams(count int) *S2KParams {
+	return &S2KParams{
+		Mode:  constants.S2KIterated,
+		Count: count,
+	}
+}
+
+// NewArgon2S2KParams returns parameters for Argon2id S2K, with the given
+// number of passes, degree of parallelism and memory in KiB.
+func NewArgon2S2KParams(passes, parallelism, memory int) *S2KParams {
+	return &S2KParams{
+		Mode:        constants.S2KArgon2,
+		Passes:      passes,
+		Parallelism: parallelism,
+		Memory:      memory,
+	}
+}
+
+// --- Internal methods
+
+// getConfig returns the go-crypto S2K configuration of the parameters. Nil
+// parameters give a nil configuration, for the default S2K.
+func (params *S2KParams) getConfig() (*s2k.Config, error) {
+	if params == nil {
+		return nil, nil
+	}
+
+	switch params.Mode {
+	case constants.S2KIterated:
+		if params.Count < 65536 || params.Count > 65011712 {
+			return nil, errors.New("gopenpgp: invalid S2K count")
+		}
+		return &s2k.Config{
+			S2KMode:  s2k.IteratedSaltedS2K,
+			Hash:     crypto.SHA256,
+			S2KCount: params.Count,
+		}, nil
+	case constants.S2KArgon2:
+		if params.Passes < 1 || params.Passes > 255 ||
+			params.Parallelism < 1 || params.Parallelism > 255 ||
+			params.Memory < 8*params.Parallelism || uint64(params.Memory) > 1<<31 {
+			return nil, errors.New("gopenpgp: invalid Argon2 parameters")
+		}
+		return &s2k.Config{
+			S2KMode: s2k.Argon2S2K,
+			Argon2Config: &s2k.Argon2Config{
+				NumberOfPasses:      uint8(params.Passes),
+				DegreeOfParallelism: uint8(params.Parallelism),
+				Memory:              uint32(params.Memory),
+			},
+		}, nil
+	default:
+		return nil, errors.New("gopenpgp: unknown S2K mode")
+	}
+}
+
+// parseS2KParams reads the parameters of a serialized S2K specifier, and
+// returns nil for modes other than iterated and salted, and Argon2.
+func parseS2KParams(specifier []byte) *S2KParams {
+	switch {
+	case len(specifier) >= 11 && specifier[0] == byte(s2k.IteratedSaltedS2K):
+		c := int(specifier[10])
+		return NewIteratedS2KParams((16 + (c & 15)) << (uint(c>>4) + 6))
+	case len(specifier) >= 20 && specifier[0] == byte(s2k.Argon2S2K):
+		return NewArgon2S2KParams(int(specifier[17]), int(specifier[18]), 1<<specifier[19])
+	default:
+		return nil
+	}
+}
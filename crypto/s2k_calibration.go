@@ -0,0 +1,100 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/s2k"
+	"github.com/pkg/errors"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+// Bounds of the calibrated S2K parameters.
+const (
+	calibrationMinIteratedCount   = 1 << 20
+	calibrationMaxIteratedCount   = 65011712
+	calibrationArgon2Parallel     = 4
+	calibrationMinArgon2MemoryExp = 13
+	calibrationMinArgon2Memory    = 1 << calibrationMinArgon2MemoryExp // 8 MiB
+	calibrationMaxArgon2Memory    = 1 << 21                            // 2 GiB
+	calibrationMaxArgon2Passes    = 16
+	calibrationMinDuration        = 20 * time.Millisecond
+)
+
+// CalibrateS2KParams benchmarks the S2K function of the given mode
+// (constants.S2KIterated or constants.S2KArgon2) on the current machine, and
+// returns the parameters that derive a key from a passphrase in about
+// targetMillis milliseconds. Argon2 uses at most maxMemory KiB of memory,
+// while maxMemory is unused for iterated S2K.
+// The parameters are kept between sane floors and ceilings: deriving a key can
+// take longer than targetMillis on slow machines. They can be used with
+// LockWithOptions and EncryptMessageWithPasswordAndOptions.
+func CalibrateS2KParams(mode string, targetMillis, maxMemory int) (*S2KParams, error) {
+	if targetMillis <= 0 {
+		return nil, errors.New("gopenpgp: invalid calibration target duration")
+	}
+	target := time.Duration(targetMillis) * time.Millisecond
+
+	salt := make([]byte, 16)
+	out := make([]byte, 32)
+	password := []byte("gopenpgp s2k calibration")
+
+	switch mode {
+	case constants.S2KIterated:
+		elapsed := measureS2K(func() {
+			s2k.Iterated(out, sha256.New(), password, salt, calibrationMinIteratedCount)
+		})
+		count := int(float64(calibrationMinIteratedCount) * float64(target) / float64(elapsed))
+		if count < calibrationMinIteratedCount {
+			count = calibrationMinIteratedCount
+		}
+		if count > calibrationMaxIteratedCount {
+			count = calibrationMaxIteratedCount
+		}
+		return NewIteratedS2KParams(count), nil
+	case constants.S2KArgon2:
+		if maxMemory < calibrationMinArgon2Memory {
+			return nil, errors.New("gopenpgp: memory budget is too low for Argon2")
+		}
+		elapsed := measureS2K(func() {
+			s2k.Argon2(out, password, salt, 1, calibrationArgon2Parallel, calibrationMinArgon2MemoryExp)
+		})
+
+		// The duration of Argon2 is linear in the memory and in the passes:
+		// double the memory first, then add passes.
+		memory := calibrationMinArgon2Memory
+		for memory*2 <= maxMemory && memory*2 <= calibrationMaxArgon2Memory &&
+			elapsed*2 <= target {
+			memory *= 2
+			elapsed *= 2
+		}
+		passes := int(target / elapsed)
+		if passes < 1 {
+			passes = 1
+		}
+		if passes > calibrationMaxArgon2Passes {
+			passes = calibrationMaxArgon2Passes
+		}
+		return NewArgon2S2KParams(passes, calibrationArgon2Parallel, memory), nil
+	default:
+		return nil, errors.New("gopenpgp: unknown S2K mode")
+	}
+}
+
+// --- Internal methods
+
+// measureS2K returns the average duration of derive, running it for at least
+// calibrationMinDuration.
+func measureS2K(derive func()) time.Duration {
+	runs := 0
+	start := time.Now()
+	for time.Since(start) < calibrationMinDuration {
+		derive()
+		runs++
+	}
+	if average := time.Since(start) / time.Duration(runs); average > 0 {
+		return average
+	}
+	return 1
+}
@@ -0,0 +1,52 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+func TestCalibrateS2KParams(t *testing.T) {
+	iterated, err := CalibrateS2KParams(constants.S2KIterated, 10, 0)
+	if err != nil {
+		t.Fatal("Expected no error while calibrating S2K, got:", err)
+	}
+	assert.Exactly(t, constants.S2KIterated, iterated.Mode)
+	assert.GreaterOrEqual(t, iterated.Count, calibrationMinIteratedCount)
+	assert.LessOrEqual(t, iterated.Count, calibrationMaxIteratedCount)
+
+	argon2, err := CalibrateS2KParams(constants.S2KArgon2, 10, 1<<14)
+	if err != nil {
+		t.Fatal("Expected no error while calibrating S2K, got:", err)
+	}
+	assert.Exactly(t, constants.S2KArgon2, argon2.Mode)
+	assert.GreaterOrEqual(t, argon2.Memory, calibrationMinArgon2Memory)
+	assert.LessOrEqual(t, argon2.Memory, 1<<14)
+	assert.GreaterOrEqual(t, argon2.Passes, 1)
+
+	locked, err := keyTestEC.LockWithOptions(keyTestPassphrase, NewKeyLockOptions(argon2, constants.AEADOCB))
+	if err != nil {
+		t.Fatal("Expected no error while locking key with calibrated parameters, got:", err)
+	}
+	options, err := locked.GetLockOptions()
+	if err != nil {
+		t.Fatal("Expected no error while reading lock options, got:", err)
+	}
+	assert.Exactly(t, argon2, options.S2K)
+
+	_, err = EncryptMessageWithPasswordAndOptions(
+		NewPlainMessageFromString("calibrated"),
+		testSymmetricKey,
+		NewPasswordEncryptionOptions(iterated, ""),
+	)
+	assert.NoError(t, err)
+
+	_, err = CalibrateS2KParams(constants.S2KArgon2, 10, 1024)
+	assert.Error(t, err)
+	_, err = CalibrateS2KParams(constants.S2KIterated, 0, 0)
+	assert.Error(t, err)
+	_, err = CalibrateS2KParams("scrypt", 10, 1<<14)
+	assert.Error(t, err)
+}
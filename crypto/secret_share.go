@@ -0,0 +1,341 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/ProtonMail/gopenpgp/v2/armor"
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+	"github.com/ProtonMail/gopenpgp/v2/internal"
+)
+
+const maxSecretShares = 255
+
+// SecretShare is one share of a secret split with Shamir's secret sharing:
+// any Threshold shares of the same secret are enough to recover it.
+type SecretShare struct {
+	// The number of shares needed to recover the secret.
+	Threshold int
+	// The index of this share, between 1 and the number of shares.
+	Index int
+	// The kind of secret, constants.SecretShareKey or
+	// constants.SecretShareSessionKey.
+	Kind string
+	// The fingerprint of the shared key, for key shares.
+	Fingerprint string
+	// The symmetric algorithm of the shared session key, for session key
+	// shares.
+	Algo string
+	// The checksum of the shared session key, for session key shares.
+	Checksum string
+	// The share data.
+	Data []byte
+}
+
+// SplitSecret splits the serialized private key into shares, so that any
+// threshold shares are needed to recover it. The key is shared as is: it
+// should be locked beforehand to require its passphrase on top of the shares.
+func (key *Key) SplitSecret(threshold, shares int) ([]*SecretShare, error) {
+	if !key.IsPrivate() {
+		return nil, errors.New("gopenpgp: key is not private")
+	}
+
+	serialized, err := key.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	secretShares, err := splitSecret(serialized, threshold, shares)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, share := range secretShares {
+		share.Kind = constants.SecretShareKey
+		share.Fingerprint = key.GetFingerprint()
+	}
+
+	return secretShares, nil
+}
+
+// Split splits the session key into shares, so that any threshold shares are
+// needed to recover it.
+func (sk *SessionKey) Split(threshold, shares int) ([]*SecretShare, error) {
+	if err := sk.checkSize(); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to split session key")
+	}
+
+	secretShares, err := splitSecret(sk.Key, threshold, shares)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum := getSecretShareChecksum(sk.Key)
+	for _, share := range secretShares {
+		share.Kind = constants.SecretShareSessionKey
+		share.Algo = sk.Algo
+		share.Checksum = checksum
+	}
+
+	return secretShares, nil
+}
+
+// CombineKeyShares recovers a private key from at least threshold of its
+// shares, and checks that it matches publicKey.
+func CombineKeyShares(publicKey *Key, shares []*SecretShare) (*Key, error) {
+	if err := checkSecretShares(shares, constants.SecretShareKey); err != nil {
+		return nil, err
+	}
+
+	if shares[0].Fingerprint != publicKey.GetFingerprint() {
+		return nil, errors.New("gopenpgp: secret shares do not match the fingerprint of the key")
+	}
+
+	key, err := NewKey(combineSecret(shares))
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to parse recovered key")
+	}
+
+	if key.GetFingerprint() != publicKey.GetFingerprint() || !key.IsPrivate() {
+		return nil, errors.New("gopenpgp: recovered key does not match the fingerprint of the key")
+	}
+
+	return key, nil
+}
+
+// CombineSessionKeyShares recovers a session key from at least threshold of
+// its shares.
+func CombineSessionKeyShares(shares []*SecretShare) (*SessionKey, error) {
+	if err := checkSecretShares(shares, constants.SecretShareSessionKey); err != nil {
+		return nil, err
+	}
+
+	token := combineSecret(shares)
+	checksum := getSecretShareChecksum(token)
+	if subtle.ConstantTimeCompare([]byte(checksum), []byte(shares[0].Checksum)) != 1 {
+		return nil, errors.New("gopenpgp: recovered session key checksum mismatch")
+	}
+
+	sk := NewSessionKeyFromToken(token, shares[0].Algo)
+	if err := sk.checkSize(); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: invalid recovered session key")
+	}
+
+	return sk, nil
+}
+
+// NewSecretShareFromArmored parses an armored secret share.
+func NewSecretShareFromArmored(armored string) (*SecretShare, error) {
+	block, err := internal.Unarmor(armored)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type != constants.SecretShareHeader {
+		return nil, errors.New("gopenpgp: armored data is not a secret share")
+	}
+
+	share := &SecretShare{
+		Kind:        block.Header["Kind"],
+		Fingerprint: block.Header["Fingerprint"],
+		Algo:        block.Header["Algorithm"],
+		Checksum:    block.Header["Checksum"],
+	}
+
+	if share.Threshold, err = strconv.Atoi(block.Header["Threshold"]); err != nil {
+		return nil, errors.New("gopenpgp: invalid secret share threshold")
+	}
+	if share.Index, err = strconv.Atoi(block.Header["Index"]); err != nil {
+		return nil, errors.New("gopenpgp: invalid secret share index")
+	}
+
+	if share.Data, err = ioutil.ReadAll(block.Body); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to read secret share")
+	}
+
+	return share, nil
+}
+
+// GetArmored returns the armored secret share, with its metadata in the armor
+// headers.
+func (share *SecretShare) GetArmored() (string, error) {
+	headers := map[string]string{
+		"Threshold": strconv.Itoa(share.Threshold),
+		"Index":     strconv.Itoa(share.Index),
+		"Kind":      share.Kind,
+	}
+	if share.Fingerprint != "" {
+		headers["Fingerprint"] = share.Fingerprint
+	}
+	if share.Algo != "" {
+		headers["Algorithm"] = share.Algo
+	}
+	if share.Checksum != "" {
+		headers["Checksum"] = share.Checksum
+	}
+
+	return armor.ArmorWithTypeAndHeaders(share.Data, constants.SecretShareHeader, headers)
+}
+
+// Encrypt encrypts the armored secret share to the trustee keyring.
+func (share *SecretShare) Encrypt(trustee *KeyRing) (*PGPMessage, error) {
+	armored, err := share.GetArmored()
+	if err != nil {
+		return nil, err
+	}
+
+	return trustee.Encrypt(NewPlainMessage([]byte(armored)), nil)
+}
+
+// DecryptSecretShare decrypts a secret share encrypted to the keyring with
+// SecretShare.Encrypt.
+func (keyRing *KeyRing) DecryptSecretShare(message *PGPMessage) (*SecretShare, error) {
+	decrypted, err := keyRing.Decrypt(message, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSecretShareFromArmored(decrypted.GetString())
+}
+
+// --- Internal methods
+
+// splitSecret splits secret with Shamir's secret sharing over GF(2^8): each
+// byte of the secret is the constant term of a random polynomial of degree
+// threshold - 1, evaluated at the index of each share.
+func splitSecret(secret []byte, threshold, shares int) ([]*SecretShare, error) {
+	if threshold < 1 || threshold > shares || shares > maxSecretShares {
+		return nil, errors.New("gopenpgp: invalid secret sharing threshold or number of shares")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("gopenpgp: empty secret")
+	}
+
+	coefficients := make([]byte, len(secret)*(threshold-1))
+	if _, err := rand.Read(coefficients); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: error in generating secret shares")
+	}
+	defer clearMem(coefficients)
+
+	secretShares := make([]*SecretShare, shares)
+	for i := range secretShares {
+		x := byte(i + 1)
+		data := make([]byte, len(secret))
+		for j := range secret {
+			// Horner's method, from the highest degree coefficient
+			var y byte
+			for k := threshold - 2; k >= 0; k-- {
+				y = gf256Mul(y, x) ^ coefficients[j*(threshold-1)+k]
+			}
+			data[j] = gf256Mul(y, x) ^ secret[j]
+		}
+
+		secretShares[i] = &SecretShare{
+			Threshold: threshold,
+			Index:     i + 1,
+			Data:      data,
+		}
+	}
+
+	return secretShares, nil
+}
+
+// combineSecret recovers the secret from the shares with Lagrange
+// interpolation at 0.
+func combineSecret(shares []*SecretShare) []byte {
+	secret := make([]byte, len(shares[0].Data))
+	for i, share := range shares {
+		xi := byte(share.Index)
+
+		// Lagrange basis polynomial of share i, evaluated at 0
+		basis := byte(1)
+		for j, other := range shares {
+			if i == j {
+				continue
+			}
+			xj := byte(other.Index)
+			basis = gf256Mul(basis, gf256Mul(xj, gf256Inverse(xi^xj)))
+		}
+
+		for k := range secret {
+			secret[k] ^= gf256Mul(share.Data[k], basis)
+		}
+	}
+
+	return secret
+}
+
+// checkSecretShares checks that shares are enough consistent shares of the
+// same secret of the given kind.
+func checkSecretShares(shares []*SecretShare, kind string) error {
+	if len(shares) == 0 {
+		return errors.New("gopenpgp: no secret shares")
+	}
+
+	first := shares[0]
+	if first.Kind != kind {
+		return errors.New("gopenpgp: unexpected kind of secret share")
+	}
+	if first.Threshold < 1 || first.Threshold > maxSecretShares {
+		return errors.New("gopenpgp: invalid secret sharing threshold")
+	}
+	if len(shares) < first.Threshold {
+		return errors.New("gopenpgp: not enough secret shares, " + strconv.Itoa(first.Threshold) + " are needed")
+	}
+
+	indexes := make(map[int]bool)
+	for _, share := range shares {
+		if share.Kind != first.Kind ||
+			share.Threshold != first.Threshold ||
+			share.Fingerprint != first.Fingerprint ||
+			share.Algo != first.Algo ||
+			share.Checksum != first.Checksum ||
+			len(share.Data) != len(first.Data) {
+			return errors.New("gopenpgp: secret shares do not belong to the same secret")
+		}
+		if share.Index < 1 || share.Index > maxSecretShares {
+			return errors.New("gopenpgp: invalid secret share index")
+		}
+		if indexes[share.Index] {
+			return errors.New("gopenpgp: duplicate secret share index")
+		}
+		indexes[share.Index] = true
+	}
+
+	return nil
+}
+
+// getSecretShareChecksum returns a hex encoded checksum of the secret.
+func getSecretShareChecksum(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:8])
+}
+
+// gf256Mul multiplies a and b in GF(2^8) modulo x^8 + x^4 + x^3 + x + 1, in
+// constant time.
+func gf256Mul(a, b byte) byte {
+	var product byte
+	for i := 0; i < 8; i++ {
+		product ^= -(b & 1) & a
+		b >>= 1
+		a = (a << 1) ^ (-(a >> 7) & 0x1b)
+	}
+	return product
+}
+
+// gf256Inverse returns the multiplicative inverse of a non-zero a in GF(2^8),
+// as a^254.
+func gf256Inverse(a byte) byte {
+	result := byte(1)
+	for i := 0; i < 7; i++ {
+		a = gf256Mul(a, a)
+		result = gf256Mul(result, a)
+	}
+	return result
+}
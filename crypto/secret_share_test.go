@@ -0,0 +1,141 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+)
+
+func TestKeySecretShares(t *testing.T) {
+	locked, err := keyTestEC.Lock(keyTestPassphrase)
+	if err != nil {
+		t.Fatal("Cannot lock key:", err)
+	}
+
+	shares, err := locked.SplitSecret(3, 5)
+	if err != nil {
+		t.Fatal("Expected no error while splitting key, got:", err)
+	}
+	assert.Len(t, shares, 5)
+
+	public, err := keyTestEC.ToPublic()
+	if err != nil {
+		t.Fatal("Cannot extract public key:", err)
+	}
+
+	var parsed []*SecretShare
+	for _, share := range []*SecretShare{shares[4], shares[1], shares[2]} {
+		armored, err := share.GetArmored()
+		if err != nil {
+			t.Fatal("Expected no error while armoring share, got:", err)
+		}
+		assert.Contains(t, armored, constants.SecretShareHeader)
+
+		share, err = NewSecretShareFromArmored(armored)
+		if err != nil {
+			t.Fatal("Expected no error while parsing share, got:", err)
+		}
+		assert.Exactly(t, 3, share.Threshold)
+		assert.Exactly(t, constants.SecretShareKey, share.Kind)
+		assert.Exactly(t, keyTestEC.GetFingerprint(), share.Fingerprint)
+		parsed = append(parsed, share)
+	}
+
+	recovered, err := CombineKeyShares(public, parsed)
+	if err != nil {
+		t.Fatal("Expected no error while combining shares, got:", err)
+	}
+	assertSameSerializedKey(t, locked, recovered)
+
+	_, err = CombineKeyShares(public, parsed[:2])
+	assert.Error(t, err)
+
+	_, err = CombineKeyShares(keyTestRSA, parsed)
+	assert.Error(t, err)
+
+	_, err = CombineKeyShares(public, []*SecretShare{parsed[0], parsed[1], parsed[1]})
+	assert.Error(t, err)
+
+	parsed[0].Data[0] ^= 1
+	_, err = CombineKeyShares(public, parsed)
+	assert.Error(t, err)
+
+	_, err = public.SplitSecret(2, 3)
+	assert.Error(t, err)
+}
+
+func TestSessionKeySecretShares(t *testing.T) {
+	sk, err := GenerateSessionKey()
+	if err != nil {
+		t.Fatal("Cannot generate session key:", err)
+	}
+
+	shares, err := sk.Split(2, 2)
+	if err != nil {
+		t.Fatal("Expected no error while splitting session key, got:", err)
+	}
+	assert.NotEqual(t, sk.Key, shares[0].Data)
+
+	recovered, err := CombineSessionKeyShares(shares)
+	if err != nil {
+		t.Fatal("Expected no error while combining shares, got:", err)
+	}
+	assert.Exactly(t, sk, recovered)
+
+	for _, threshold := range []int{0, 256} {
+		invalid := []*SecretShare{{}, {}}
+		for i := range invalid {
+			*invalid[i] = *shares[i]
+			invalid[i].Threshold = threshold
+		}
+		_, err = CombineSessionKeyShares(invalid)
+		assert.Error(t, err)
+	}
+
+	shares[1].Data[0] ^= 1
+	_, err = CombineSessionKeyShares(shares)
+	assert.Error(t, err)
+
+	_, err = CombineKeyShares(keyTestEC, shares)
+	assert.Error(t, err)
+
+	_, err = sk.Split(3, 2)
+	assert.Error(t, err)
+	_, err = sk.Split(2, 256)
+	assert.Error(t, err)
+}
+
+func TestSecretSharesEncryptedToTrustees(t *testing.T) {
+	sk, err := GenerateSessionKey()
+	if err != nil {
+		t.Fatal("Cannot generate session key:", err)
+	}
+
+	shares, err := sk.Split(2, 2)
+	if err != nil {
+		t.Fatal("Expected no error while splitting session key, got:", err)
+	}
+
+	trustees := []*KeyRing{keyRingTestPrivate, keyRingTestMultiple}
+	var decrypted []*SecretShare
+	for i, trustee := range trustees {
+		encrypted, err := shares[i].Encrypt(trustee)
+		if err != nil {
+			t.Fatal("Expected no error while encrypting share, got:", err)
+		}
+
+		share, err := trustee.DecryptSecretShare(encrypted)
+		if err != nil {
+			t.Fatal("Expected no error while decrypting share, got:", err)
+		}
+		decrypted = append(decrypted, share)
+	}
+
+	recovered, err := CombineSessionKeyShares(decrypted)
+	if err != nil {
+		t.Fatal("Expected no error while combining shares, got:", err)
+	}
+	assert.Exactly(t, sk, recovered)
+}
@@ -138,7 +138,20 @@ func newSessionKeyFromEncrypted(ek *packet.EncryptedKey) (*SessionKey, error) {
 // * message : The plain data as a PlainMessage.
 // * output  : The encrypted data as PGPMessage.
 func (sk *SessionKey) Encrypt(message *PlainMessage) ([]byte, error) {
-	return encryptWithSessionKey(message, sk, nil, false, nil)
+	return encryptWithSessionKey(message, sk, nil, false, nil, nil)
+}
+
+// EncryptWithPadding encrypts a PlainMessage to PGPMessage with a SessionKey,
+// padding the encrypted data as described by the padding policy, to hide the
+// length of the plaintext.
+// * message : The plain data as a PlainMessage.
+// * padding : The padding policy, e.g. NewPowerOfTwoPaddingPolicy().
+// * output  : The encrypted data as PGPMessage.
+func (sk *SessionKey) EncryptWithPadding(message *PlainMessage, padding *PaddingPolicy) ([]byte, error) {
+	if padding == nil {
+		return nil, errors.New("gopenpgp: no padding policy provided")
+	}
+	return encryptWithSessionKey(message, sk, nil, false, nil, padding)
 }
 
 // EncryptAndSign encrypts a PlainMessage to PGPMessage with a SessionKey and signs it with a Private key.
@@ -146,7 +159,7 @@ func (sk *SessionKey) Encrypt(message *PlainMessage) ([]byte, error) {
 // * signKeyRing: The KeyRing to sign the message
 // * output  : The encrypted data as PGPMessage.
 func (sk *SessionKey) EncryptAndSign(message *PlainMessage, signKeyRing *KeyRing) ([]byte, error) {
-	return encryptWithSessionKey(message, sk, signKeyRing, false, nil)
+	return encryptWithSessionKey(message, sk, signKeyRing, false, nil, nil)
 }
 
 // EncryptAndSignWithContext encrypts a PlainMessage to PGPMessage with a SessionKey and signs it with a Private key.
@@ -155,14 +168,14 @@ func (sk *SessionKey) EncryptAndSign(message *PlainMessage, signKeyRing *KeyRing
 // * output  : The encrypted data as PGPMessage.
 // * signingContext : (optional) the context for the signature.
 func (sk *SessionKey) EncryptAndSignWithContext(message *PlainMessage, signKeyRing *KeyRing, signingContext *SigningContext) ([]byte, error) {
-	return encryptWithSessionKey(message, sk, signKeyRing, false, signingContext)
+	return encryptWithSessionKey(message, sk, signKeyRing, false, signingContext, nil)
 }
 
 // EncryptWithCompression encrypts with compression support a PlainMessage to PGPMessage with a SessionKey.
 // * message : The plain data as a PlainMessage.
 // * output  : The encrypted data as PGPMessage.
 func (sk *SessionKey) EncryptWithCompression(message *PlainMessage) ([]byte, error) {
-	return encryptWithSessionKey(message, sk, nil, true, nil)
+	return encryptWithSessionKey(message, sk, nil, true, nil, nil)
 }
 
 func encryptWithSessionKey(
@@ -171,6 +184,7 @@ func encryptWithSessionKey(
 	signKeyRing *KeyRing,
 	compress bool,
 	signingContext *SigningContext,
+	padding *PaddingPolicy,
 ) ([]byte, error) {
 	var encBuf = new(bytes.Buffer)
 
@@ -185,6 +199,7 @@ func encryptWithSessionKey(
 		signKeyRing,
 		compress,
 		signingContext,
+		padding,
 	)
 	if err != nil {
 		return nil, err
@@ -218,6 +233,7 @@ func encryptStreamWithSessionKey(
 	signKeyRing *KeyRing,
 	compress bool,
 	signingContext *SigningContext,
+	padding *PaddingPolicy,
 ) (encryptWriter, signWriter io.WriteCloser, err error) {
 	dc, err := sk.GetCipherFunc()
 	if err != nil {
@@ -225,8 +241,9 @@ func encryptStreamWithSessionKey(
 	}
 
 	config := &packet.Config{
-		Time:          getTimeGenerator(),
-		DefaultCipher: dc,
+		Time:                                  getTimeGenerator(),
+		DefaultCipher:                         dc,
+		NonDeterministicSignaturesViaNotation: &saltNotation,
 	}
 
 	var signEntity *openpgp.Entity
@@ -263,6 +280,8 @@ func encryptStreamWithSessionKey(
 		sk,
 		signEntity,
 		config,
+		padding,
+		nil,
 	)
 }
 
@@ -274,6 +293,8 @@ func encryptStreamWithSessionKeyAndConfig(
 	sk *SessionKey,
 	signEntity *openpgp.Entity,
 	config *packet.Config,
+	padding *PaddingPolicy,
+	intendedRecipients []*packet.Recipient,
 ) (encryptWriter, signWriter io.WriteCloser, err error) {
 	encryptWriter, err = packet.SerializeSymmetricallyEncrypted(
 		dataPacketWriter,
@@ -288,6 +309,10 @@ func encryptStreamWithSessionKeyAndConfig(
 		return nil, nil, errors.Wrap(err, "gopenpgp: unable to encrypt")
 	}
 
+	if padding != nil {
+		encryptWriter = newPaddingWriteCloser(encryptWriter, padding)
+	}
+
 	if algo := config.Compression(); algo != packet.CompressionNone {
 		encryptWriter, err = packet.SerializeCompressed(encryptWriter, algo, config.CompressionConfig)
 		if err != nil {
@@ -302,7 +327,11 @@ func encryptStreamWithSessionKeyAndConfig(
 			ModTime:  time.Unix(int64(modTime), 0),
 		}
 
-		signWriter, err = openpgp.Sign(encryptWriter, signEntity, hints, config)
+		if len(intendedRecipients) > 0 {
+			signWriter, err = signWithIntendedRecipients(encryptWriter, signEntity, hints, config, intendedRecipients)
+		} else {
+			signWriter, err = openpgp.Sign(encryptWriter, signEntity, hints, config)
+		}
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "gopenpgp: unable to sign")
 		}
@@ -396,9 +425,37 @@ func decryptStreamWithSessionKey(
 	verifyKeyRing *KeyRing,
 	verificationContext *VerificationContext,
 ) (*openpgp.MessageDetails, error) {
-	var decrypted io.ReadCloser
 	var keyring openpgp.EntityList
 
+	config := &packet.Config{
+		Time: getTimeGenerator(),
+	}
+
+	if verificationContext != nil {
+		config.KnownNotations = map[string]bool{constants.SignatureContextName: true}
+	}
+
+	if verifyKeyRing != nil {
+		keyring = verifyKeyRing.entities
+	} else {
+		keyring = openpgp.EntityList{}
+	}
+
+	return decryptStreamWithSessionKeyAndConfig(sk, &countingReader{reader: messageReader}, keyring, config)
+}
+
+// decryptStreamWithSessionKeyAndConfig decrypts the data packet read from
+// messageReader with the session key, and reads the decrypted message with
+// the keyring to verify signatures, within the decryption limits.
+func decryptStreamWithSessionKeyAndConfig(
+	sk *SessionKey,
+	messageReader *countingReader,
+	keyring openpgp.EntityList,
+	config *packet.Config,
+) (*openpgp.MessageDetails, error) {
+	var decrypted io.ReadCloser
+	limits := getDecryptionLimits()
+
 	// Read symmetrically encrypted data packet
 	packets := packet.NewReader(messageReader)
 	p, err := packets.Next()
@@ -430,30 +487,41 @@ func decryptStreamWithSessionKey(
 		return nil, errors.New("gopenpgp: invalid packet type")
 	}
 
-	config := &packet.Config{
-		Time: getTimeGenerator(),
-	}
-
-	if verificationContext != nil {
-		config.KnownNotations = map[string]bool{constants.SignatureContextName: true}
+	decryptedPackets, err := readCompressedLayers(decrypted, limits)
+	if err != nil {
+		return nil, err
 	}
 
 	// Push decrypted packet as literal packet and use openpgp's reader
-	if verifyKeyRing != nil {
-		keyring = verifyKeyRing.entities
-	} else {
-		keyring = openpgp.EntityList{}
-	}
-
-	md, err := openpgp.ReadMessage(decrypted, keyring, nil, config)
+	md, err := openpgp.ReadMessage(decryptedPackets, keyring, nil, config)
 	if err != nil {
 		return nil, errors.Wrap(err, "gopenpgp: unable to decode symmetric packet")
 	}
 
-	md.UnverifiedBody = checkReader{decrypted, md.UnverifiedBody}
+	md.IsEncrypted = true
+	md.UnverifiedBody = newLimitedReader(checkReader{decrypted, md.UnverifiedBody}, messageReader, limits)
+	if isAEADDataPacket(p) {
+		md.UnverifiedBody = aeadReader{md.UnverifiedBody}
+	}
 	return md, nil
 }
 
+// aeadReader marks the decrypted data of AEAD encrypted data packets, whose
+// chunks are authenticated before being read.
+type aeadReader struct {
+	io.Reader
+}
+
+func isAEADDataPacket(p packet.Packet) bool {
+	switch p := p.(type) {
+	case *packet.AEADEncrypted:
+		return true
+	case *packet.SymmetricallyEncrypted:
+		return p.Version == 2
+	}
+	return false
+}
+
 func (sk *SessionKey) checkSize() error {
 	cf, ok := symKeyAlgos[sk.Algo]
 	if !ok {
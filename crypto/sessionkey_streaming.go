@@ -34,6 +34,31 @@ func (sk *SessionKey) EncryptStream(
 		signKeyRing,
 		false,
 		nil,
+		nil,
+	)
+}
+
+// EncryptStreamWithPadding is used to encrypt data as a Writer.
+// It takes a writer for the encrypted data packet and returns a writer for the plaintext data.
+// The data packet is padded as described by the padding policy, to hide the
+// length of the plaintext.
+// If signKeyRing is not nil, it is used to do an embedded signature.
+func (sk *SessionKey) EncryptStreamWithPadding(
+	dataPacketWriter Writer,
+	plainMessageMetadata *PlainMessageMetadata,
+	signKeyRing *KeyRing,
+	padding *PaddingPolicy,
+) (plainMessageWriter WriteCloser, err error) {
+	if padding == nil {
+		return nil, errors.New("gopenpgp: no padding policy provided")
+	}
+	return sk.encryptStream(
+		dataPacketWriter,
+		plainMessageMetadata,
+		signKeyRing,
+		false,
+		nil,
+		padding,
 	)
 }
 
@@ -53,6 +78,7 @@ func (sk *SessionKey) EncryptStreamWithContext(
 		signKeyRing,
 		false,
 		signingContext,
+		nil,
 	)
 }
 
@@ -72,6 +98,7 @@ func (sk *SessionKey) EncryptStreamWithCompression(
 		signKeyRing,
 		true,
 		nil,
+		nil,
 	)
 }
 
@@ -92,6 +119,7 @@ func (sk *SessionKey) EncryptStreamWithContextAndCompression(
 		signKeyRing,
 		true,
 		signingContext,
+		nil,
 	)
 }
 
@@ -101,6 +129,7 @@ func (sk *SessionKey) encryptStream(
 	signKeyRing *KeyRing,
 	compress bool,
 	signingContext *SigningContext,
+	padding *PaddingPolicy,
 ) (plainMessageWriter WriteCloser, err error) {
 	encryptWriter, signWriter, err := encryptStreamWithSessionKey(
 		plainMessageMetadata,
@@ -109,6 +138,7 @@ func (sk *SessionKey) encryptStream(
 		signKeyRing,
 		compress,
 		signingContext,
+		padding,
 	)
 
 	if err != nil {
@@ -180,10 +210,10 @@ func decryptStreamWithSessionKeyAndContext(
 	}
 
 	return &PlainMessageReader{
-		messageDetails,
-		verifyKeyRing,
-		verifyTime,
-		false,
-		verificationContext,
+		details:             messageDetails,
+		verifyKeyRing:       verifyKeyRing,
+		verifyTime:          verifyTime,
+		verificationContext: verificationContext,
+		sessionKey:          sessionKey,
 	}, err
 }
@@ -1,12 +1,14 @@
 package crypto
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"io/ioutil"
 	"testing"
 
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
 	"github.com/ProtonMail/gopenpgp/v2/constants"
 	"github.com/stretchr/testify/assert"
 )
@@ -85,6 +87,47 @@ func TestSymmetricKeyPacket(t *testing.T) {
 	assert.Exactly(t, testSessionKey, outputSymmetricKey)
 }
 
+func TestSymmetricKeyPacketWithArgon2(t *testing.T) {
+	password := []byte("I like encryption")
+
+	keyPacket, err := EncryptSessionKeyWithPasswordAndS2K(testSessionKey, password, getTestArgon2S2KParams())
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+
+	outputSymmetricKey, err := DecryptSessionKeyWithPassword(keyPacket, password)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, testSessionKey, outputSymmetricKey)
+
+	_, err = EncryptSessionKeyWithPasswordAndS2K(testSessionKey, password, NewArgon2S2KParams(1, 0, 64))
+	assert.Error(t, err)
+}
+
+func TestSymmetricKeyPacketV6(t *testing.T) {
+	password := []byte("I like encryption")
+
+	var keyPacket bytes.Buffer
+	config := &packet.Config{
+		DefaultCipher: packet.CipherAES256,
+		AEADConfig:    &packet.AEADConfig{DefaultMode: packet.AEADModeEAX},
+	}
+	err := packet.SerializeSymmetricKeyEncryptedAEADReuseKey(&keyPacket, testSessionKey.Key, password, true, config)
+	if err != nil {
+		t.Fatal("Expected no error while generating key packet, got:", err)
+	}
+
+	_, err = DecryptSessionKeyWithPassword(keyPacket.Bytes(), []byte("Wrong password"))
+	assert.EqualError(t, err, "gopenpgp: unable to decrypt any packet")
+
+	outputSymmetricKey, err := DecryptSessionKeyWithPassword(keyPacket.Bytes(), password)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting key packet, got:", err)
+	}
+	assert.Exactly(t, testSessionKey, outputSymmetricKey)
+}
+
 func TestSymmetricKeyPacketWrongSize(t *testing.T) {
 	r, err := RandomToken(symKeyAlgos[constants.AES256].KeySize())
 	if err != nil {
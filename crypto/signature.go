@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto"
 	"fmt"
+	"hash"
 	"io"
 	"math"
 	"time"
@@ -17,6 +18,11 @@ import (
 	"github.com/ProtonMail/gopenpgp/v2/internal"
 )
 
+// saltNotation is the NonDeterministicSignaturesViaNotation setting of the
+// signing configurations: go-crypto adds a random salt notation to version 4
+// signatures by default, which would change the signatures made by gopenpgp.
+var saltNotation = false
+
 var allowedHashes = []crypto.Hash{
 	crypto.SHA224,
 	crypto.SHA256,
@@ -59,6 +65,16 @@ func newSignatureBadContext(cause error) SignatureVerificationError {
 	}
 }
 
+// newSignatureBadRecipient creates a new SignatureVerificationError, type
+// SignatureBadRecipient.
+func newSignatureBadRecipient(cause error) SignatureVerificationError {
+	return SignatureVerificationError{
+		Status:  constants.SIGNATURE_BAD_RECIPIENT,
+		Message: "Not an intended recipient",
+		Cause:   cause,
+	}
+}
+
 func newSignatureFailed(cause error) SignatureVerificationError {
 	return SignatureVerificationError{
 		Status:  constants.SIGNATURE_FAILED,
@@ -166,6 +182,194 @@ func (context *SigningContext) getNotation() *packet.Notation {
 	}
 }
 
+// getIntendedRecipients returns the versioned fingerprints of the primary keys
+// of the recipients, one per entity.
+func getIntendedRecipients(recipients openpgp.EntityList) []*packet.Recipient {
+	intendedRecipients := make([]*packet.Recipient, 0, len(recipients))
+	for _, e := range recipients {
+		intendedRecipients = append(intendedRecipients, &packet.Recipient{
+			KeyVersion:  e.PrimaryKey.Version,
+			Fingerprint: e.PrimaryKey.Fingerprint,
+		})
+	}
+	return intendedRecipients
+}
+
+// verifyIntendedRecipient checks that the key that decrypted the message is
+// one of the intended recipients of its signature. Signatures without
+// intended recipients are accepted, as they predate them.
+func verifyIntendedRecipient(md *openpgp.MessageDetails) error {
+	if md.Signature == nil || md.DecryptedWith.Entity == nil || len(md.Signature.IntendedRecipients) == 0 {
+		return nil
+	}
+	primaryKey := md.DecryptedWith.Entity.PrimaryKey
+	for _, recipient := range md.Signature.IntendedRecipients {
+		if recipient.KeyVersion == primaryKey.Version && bytes.Equal(recipient.Fingerprint, primaryKey.Fingerprint) {
+			return nil
+		}
+	}
+	return newSignatureBadRecipient(errors.New("gopenpgp: the decryption key is not an intended recipient of the signature"))
+}
+
+// intendedRecipientsSignWriter hashes the plaintext while writing it to the
+// literal data packet, and writes the signature listing the intended
+// recipients when closed.
+type intendedRecipientsSignWriter struct {
+	output      io.Writer
+	literalData io.WriteCloser
+	writer      io.Writer
+	hasher      hash.Hash
+	sig         *packet.Signature
+	signer      *packet.PrivateKey
+	config      *packet.Config
+}
+
+// signWithIntendedRecipients works like openpgp.Sign, and lists the intended
+// recipients in the signature with Intended Recipient Fingerprint subpackets,
+// which openpgp.Sign can't write. Text, if hints.IsBinary is false, is signed
+// with a text signature and written with canonical line endings, like
+// openpgp.EncryptText does. Closing the returned writer doesn't close the
+// output.
+func signWithIntendedRecipients(
+	output io.Writer,
+	signEntity *openpgp.Entity,
+	hints *openpgp.FileHints,
+	config *packet.Config,
+	intendedRecipients []*packet.Recipient,
+) (io.WriteCloser, error) {
+	signKey, ok := signEntity.SigningKeyById(config.Now(), config.SigningKey())
+	if !ok {
+		return nil, errors.New("gopenpgp: no valid signing keys")
+	}
+	signer := signKey.PrivateKey
+	if signer == nil || signer.Encrypted {
+		return nil, errors.New("gopenpgp: the signing key must be unlocked")
+	}
+
+	sigLifetimeSecs := config.SigLifetime()
+	epochSeconds := uint32(hints.ModTime.Unix())
+	sigType := packet.SigTypeText
+	metadata := &packet.LiteralData{Format: 'u', FileName: hints.FileName, Time: epochSeconds}
+	if hints.IsBinary {
+		sigType = packet.SigTypeBinary
+		metadata.Format = 'b'
+	}
+	sig := &packet.Signature{
+		Version:            signer.Version,
+		SigType:            sigType,
+		PubKeyAlgo:         signer.PubKeyAlgo,
+		Hash:               getPreferredHash(signEntity, config),
+		CreationTime:       config.Now(),
+		IssuerKeyId:        &signer.KeyId,
+		IssuerFingerprint:  signer.Fingerprint,
+		Notations:          config.Notations(),
+		SigLifetimeSecs:    &sigLifetimeSecs,
+		IntendedRecipients: intendedRecipients,
+		Metadata:           metadata,
+	}
+
+	ops := &packet.OnePassSignature{
+		Version:    3,
+		SigType:    sig.SigType,
+		Hash:       sig.Hash,
+		PubKeyAlgo: signer.PubKeyAlgo,
+		KeyId:      signer.KeyId,
+		IsLast:     true,
+	}
+	if signer.Version == 6 {
+		salt, err := packet.SignatureSaltForHash(sig.Hash, config.Random())
+		if err != nil {
+			return nil, err
+		}
+		if err = sig.SetSalt(salt); err != nil {
+			return nil, err
+		}
+		ops.Version = 6
+		ops.KeyFingerprint = signer.Fingerprint
+		ops.Salt = salt
+	}
+
+	hasher, err := sig.PrepareSign(config)
+	if err != nil {
+		return nil, err
+	}
+	if err = ops.Serialize(output); err != nil {
+		return nil, err
+	}
+	literalData, err := packet.SerializeLiteral(&nopWriteCloser{output}, hints.IsBinary, hints.FileName, epochSeconds)
+	if err != nil {
+		return nil, err
+	}
+	var writer io.Writer = io.MultiWriter(hasher, literalData)
+	if sigType == packet.SigTypeText {
+		writer = &canonicalTextWriter{writer: writer}
+	}
+	return &intendedRecipientsSignWriter{
+		output:      output,
+		literalData: literalData,
+		writer:      writer,
+		hasher:      hasher,
+		sig:         sig,
+		signer:      signer,
+		config:      config,
+	}, nil
+}
+
+func (w *intendedRecipientsSignWriter) Write(b []byte) (int, error) {
+	return w.writer.Write(b)
+}
+
+func (w *intendedRecipientsSignWriter) Close() error {
+	if err := w.sig.Sign(w.hasher, w.signer, w.config); err != nil {
+		return errors.Wrap(err, "gopenpgp: unable to sign")
+	}
+	if err := w.literalData.Close(); err != nil {
+		return err
+	}
+	return w.sig.Serialize(w.output)
+}
+
+// canonicalTextWriter converts the line endings of the text written to it to
+// CRLF, as openpgp.NewCanonicalTextHash does: a line feed which doesn't follow
+// a carriage return is preceded by one.
+type canonicalTextWriter struct {
+	writer  io.Writer
+	afterCR bool
+}
+
+func (w *canonicalTextWriter) Write(b []byte) (int, error) {
+	start := 0
+	for i, c := range b {
+		switch {
+		case w.afterCR:
+			w.afterCR = false
+		case c == '\r':
+			w.afterCR = true
+		case c == '\n':
+			if _, err := w.writer.Write(b[start:i]); err != nil {
+				return 0, err
+			}
+			if _, err := w.writer.Write([]byte{'\r', '\n'}); err != nil {
+				return 0, err
+			}
+			start = i + 1
+		}
+	}
+	if _, err := w.writer.Write(b[start:]); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// nopWriteCloser wraps a writer with a Close method that does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (w *nopWriteCloser) Close() error {
+	return nil
+}
+
 // VerificationContext gives the context that will be
 // used to verify the signature.
 type VerificationContext struct {
@@ -247,6 +451,9 @@ func verifySignature(
 	if verificationContext != nil {
 		config.KnownNotations = map[string]bool{constants.SignatureContextName: true}
 	}
+	if err := checkSignatureCount(signature, getDecryptionLimits()); err != nil {
+		return nil, err
+	}
 	signatureReader := bytes.NewReader(signature)
 
 	sig, signer, err := openpgp.VerifyDetachedSignatureAndHash(pubKeyEntries, origText, signatureReader, allowedHashes, config)
@@ -305,8 +512,9 @@ func signMessageDetached(
 	context *SigningContext,
 ) (*PGPSignature, error) {
 	config := &packet.Config{
-		DefaultHash: crypto.SHA512,
-		Time:        getTimeGenerator(),
+		DefaultHash:                           crypto.SHA512,
+		Time:                                  getTimeGenerator(),
+		NonDeterministicSignaturesViaNotation: &saltNotation,
 	}
 
 	signEntity, err := signKeyRing.getSigningEntity()
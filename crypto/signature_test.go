@@ -663,3 +663,25 @@ func Test_verifySignaturExpire(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func Test_SignWithoutSaltNotation(t *testing.T) {
+	signature, err := keyRingTestPrivate.SignDetached(NewPlainMessage([]byte(testMessage)))
+	if err != nil {
+		t.Fatal("Expected no error when signing, got:", err)
+	}
+	p, err := packet.Read(bytes.NewReader(signature.Data))
+	if err != nil {
+		t.Fatal("Expected no error when reading signature, got:", err)
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok {
+		t.Fatal("Packet was not a signature")
+	}
+	assert.Empty(t, sig.Notations)
+
+	encrypted, err := keyRingTestPublic.Encrypt(NewPlainMessage([]byte(testMessage)), keyRingTestPrivate)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+	assert.Empty(t, readEmbeddedSignature(t, keyRingTestPrivate, encrypted).Notations)
+}
@@ -0,0 +1,394 @@
+package crypto
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// TOFUBinding records the key pinned for an email address by a TOFUStore.
+type TOFUBinding struct {
+	// Email is the normalized email address of the binding.
+	Email string `json:"email"`
+	// Fingerprint is the hex encoded fingerprint of the pinned key, i.e. the
+	// first key seen for the address unless a conflict was resolved.
+	Fingerprint string `json:"fingerprint"`
+	// FirstSeen and LastSeen are the unix times at which the pinned key was
+	// first and last seen for the address.
+	FirstSeen int64 `json:"firstSeen"`
+	LastSeen  int64 `json:"lastSeen"`
+	// SignatureCount is the number of verified signatures recorded for the
+	// pinned key, and FirstSignature and LastSignature the unix times of the
+	// first and last of them.
+	SignatureCount int   `json:"signatureCount"`
+	FirstSignature int64 `json:"firstSignature,omitempty"`
+	LastSignature  int64 `json:"lastSignature,omitempty"`
+	// Conflict is set when a different key was seen for the address, until
+	// the conflict is resolved with TOFUStore.Accept.
+	Conflict bool `json:"conflict,omitempty"`
+	// ConflictingFingerprints are the hex encoded fingerprints of the other
+	// keys seen for the address.
+	ConflictingFingerprints []string `json:"conflictingFingerprints,omitempty"`
+}
+
+// TOFUConflictError is returned by a TOFUStore when a key that differs from
+// the pinned one is used for an email address.
+type TOFUConflictError struct {
+	Email             string
+	PinnedFingerprint string
+	Fingerprint       string
+}
+
+// Error is the base method for all errors.
+func (e TOFUConflictError) Error() string {
+	return fmt.Sprintf(
+		"gopenpgp: key %s conflicts with key %s pinned for %s",
+		e.Fingerprint, e.PinnedFingerprint, e.Email,
+	)
+}
+
+// TOFUStorage persists the bindings of a TOFUStore.
+type TOFUStorage interface {
+	// Load returns the binding for the normalized email address, or nil if
+	// there is none.
+	Load(email string) (*TOFUBinding, error)
+	// Store saves the binding, replacing any previous binding for its email
+	// address.
+	Store(binding *TOFUBinding) error
+}
+
+// TOFUStore pins contact keys by email address on first use, and flags the
+// keys that later conflict with them.
+type TOFUStore struct {
+	storage TOFUStorage
+	lock    sync.Mutex
+}
+
+// NewTOFUStore creates a trust-on-first-use store persisted in storage.
+func NewTOFUStore(storage TOFUStorage) *TOFUStore {
+	return &TOFUStore{storage: storage}
+}
+
+// GetBinding returns the binding for the email address, or nil if no key
+// was seen for it.
+func (store *TOFUStore) GetBinding(email string) (*TOFUBinding, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	return store.storage.Load(normalizeTOFUEmail(email))
+}
+
+// Observe records that key was seen for the email address, and returns the
+// updated binding. The first key seen for an address is pinned; if key
+// differs from the pinned key, the binding is flagged as conflicting and a
+// TOFUConflictError is returned.
+func (store *TOFUStore) Observe(email string, key *Key) (*TOFUBinding, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	return store.observe(normalizeTOFUEmail(email), key)
+}
+
+// Accept pins key for the email address, replacing the previously pinned key
+// and resolving any conflict. Signature counts are reset if the pinned key
+// changes.
+func (store *TOFUStore) Accept(email string, key *Key) (*TOFUBinding, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	email = normalizeTOFUEmail(email)
+	if err := checkTOFUEmail(email, key); err != nil {
+		return nil, err
+	}
+
+	binding, err := store.storage.Load(email)
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to load TOFU binding")
+	}
+
+	now := GetUnixTime()
+	fingerprint := key.GetFingerprint()
+	if binding == nil || binding.Fingerprint != fingerprint {
+		binding = &TOFUBinding{
+			Email:       email,
+			Fingerprint: fingerprint,
+			FirstSeen:   now,
+		}
+	}
+	binding.LastSeen = now
+	binding.Conflict = false
+	binding.ConflictingFingerprints = nil
+
+	if err = store.storage.Store(binding); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to store TOFU binding")
+	}
+	return binding, nil
+}
+
+// RecordSignature records a verified signature made by key at the unix time
+// signTime for the email address. It returns a TOFUConflictError if key is
+// not the pinned key.
+func (store *TOFUStore) RecordSignature(email string, key *Key, signTime int64) (*TOFUBinding, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	email = normalizeTOFUEmail(email)
+	binding, err := store.observe(email, key)
+	if err != nil {
+		return nil, err
+	}
+
+	binding.SignatureCount++
+	if binding.FirstSignature == 0 || signTime < binding.FirstSignature {
+		binding.FirstSignature = signTime
+	}
+	if signTime > binding.LastSignature {
+		binding.LastSignature = signTime
+	}
+
+	if err = store.storage.Store(binding); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to store TOFU binding")
+	}
+	return binding, nil
+}
+
+// GetKeyRing returns a keyring with the key pinned for the email address among
+// the candidate keys, pinning the first candidate if no key was seen for the
+// address yet. It returns a TOFUConflictError if the pinned key is not among
+// the candidates, or if the binding has an unresolved conflict.
+func (store *TOFUStore) GetKeyRing(email string, candidates *KeyRing) (*KeyRing, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	email = normalizeTOFUEmail(email)
+	keys := candidates.GetKeys()
+	if len(keys) == 0 {
+		return nil, errors.New("gopenpgp: no candidate key for " + email)
+	}
+
+	binding, err := store.storage.Load(email)
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to load TOFU binding")
+	}
+
+	selected := keys[0]
+	if binding != nil {
+		selected = nil
+		for _, key := range keys {
+			if key.GetFingerprint() == binding.Fingerprint {
+				selected = key
+				break
+			}
+		}
+		if selected == nil {
+			_, err = store.observe(email, keys[0])
+			return nil, err
+		}
+	}
+
+	if _, err = store.observe(email, selected); err != nil {
+		return nil, err
+	}
+	return NewKeyRing(selected)
+}
+
+// --- Storage implementations
+
+type tofuMemoryStorage struct {
+	bindings map[string]TOFUBinding
+	lock     sync.Mutex
+}
+
+// NewTOFUMemoryStorage creates a TOFUStorage that keeps bindings in memory.
+func NewTOFUMemoryStorage() TOFUStorage {
+	return &tofuMemoryStorage{bindings: make(map[string]TOFUBinding)}
+}
+
+func (storage *tofuMemoryStorage) Load(email string) (*TOFUBinding, error) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	binding, ok := storage.bindings[email]
+	if !ok {
+		return nil, nil
+	}
+	binding.ConflictingFingerprints = append([]string(nil), binding.ConflictingFingerprints...)
+	return &binding, nil
+}
+
+func (storage *tofuMemoryStorage) Store(binding *TOFUBinding) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	stored := *binding
+	stored.ConflictingFingerprints = append([]string(nil), binding.ConflictingFingerprints...)
+	storage.bindings[binding.Email] = stored
+	return nil
+}
+
+type tofuFileStorage struct {
+	path string
+	lock sync.Mutex
+}
+
+// NewTOFUFileStorage creates a TOFUStorage that keeps bindings in a JSON file
+// at path. The file is created on the first write, and replaced atomically on
+// each update.
+func NewTOFUFileStorage(path string) TOFUStorage {
+	return &tofuFileStorage{path: path}
+}
+
+func (storage *tofuFileStorage) Load(email string) (*TOFUBinding, error) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	bindings, err := storage.readAll()
+	if err != nil {
+		return nil, err
+	}
+
+	binding, ok := bindings[email]
+	if !ok {
+		return nil, nil
+	}
+	return binding, nil
+}
+
+func (storage *tofuFileStorage) Store(binding *TOFUBinding) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	bindings, err := storage.readAll()
+	if err != nil {
+		return err
+	}
+	bindings[binding.Email] = binding
+
+	data, err := json.Marshal(bindings)
+	if err != nil {
+		return errors.Wrap(err, "gopenpgp: unable to encode TOFU bindings")
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(storage.path), filepath.Base(storage.path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "gopenpgp: unable to create TOFU file")
+	}
+	defer os.Remove(temp.Name()) //nolint:errcheck
+
+	if _, err = temp.Write(data); err != nil {
+		_ = temp.Close()
+		return errors.Wrap(err, "gopenpgp: unable to write TOFU file")
+	}
+	if err = temp.Sync(); err != nil {
+		_ = temp.Close()
+		return errors.Wrap(err, "gopenpgp: unable to write TOFU file")
+	}
+	if err = temp.Close(); err != nil {
+		return errors.Wrap(err, "gopenpgp: unable to write TOFU file")
+	}
+
+	if err = os.Rename(temp.Name(), storage.path); err != nil {
+		return errors.Wrap(err, "gopenpgp: unable to replace TOFU file")
+	}
+	return nil
+}
+
+func (storage *tofuFileStorage) readAll() (map[string]*TOFUBinding, error) {
+	bindings := make(map[string]*TOFUBinding)
+
+	data, err := ioutil.ReadFile(storage.path)
+	if os.IsNotExist(err) {
+		return bindings, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to read TOFU file")
+	}
+
+	if err = json.Unmarshal(data, &bindings); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to decode TOFU file")
+	}
+	return bindings, nil
+}
+
+// --- Internal methods
+
+// observe implements Observe, the store lock must be held by the caller.
+func (store *TOFUStore) observe(email string, key *Key) (*TOFUBinding, error) {
+	if err := checkTOFUEmail(email, key); err != nil {
+		return nil, err
+	}
+
+	binding, err := store.storage.Load(email)
+	if err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to load TOFU binding")
+	}
+
+	now := GetUnixTime()
+	fingerprint := key.GetFingerprint()
+	if binding == nil {
+		binding = &TOFUBinding{
+			Email:       email,
+			Fingerprint: fingerprint,
+			FirstSeen:   now,
+		}
+	}
+
+	var conflictErr error
+	if binding.Fingerprint == fingerprint {
+		binding.LastSeen = now
+		if binding.Conflict {
+			conflictErr = TOFUConflictError{
+				Email:             email,
+				PinnedFingerprint: binding.Fingerprint,
+				Fingerprint:       binding.ConflictingFingerprints[len(binding.ConflictingFingerprints)-1],
+			}
+		}
+	} else {
+		binding.Conflict = true
+		if !containsString(binding.ConflictingFingerprints, fingerprint) {
+			binding.ConflictingFingerprints = append(binding.ConflictingFingerprints, fingerprint)
+		}
+		conflictErr = TOFUConflictError{
+			Email:             email,
+			PinnedFingerprint: binding.Fingerprint,
+			Fingerprint:       fingerprint,
+		}
+	}
+
+	if err = store.storage.Store(binding); err != nil {
+		return nil, errors.Wrap(err, "gopenpgp: unable to store TOFU binding")
+	}
+	if conflictErr != nil {
+		return binding, conflictErr
+	}
+	return binding, nil
+}
+
+// checkTOFUEmail checks that one of the user IDs of key has the email address.
+func checkTOFUEmail(email string, key *Key) error {
+	for _, identity := range key.entity.Identities {
+		if normalizeTOFUEmail(identity.UserId.Email) == email {
+			return nil
+		}
+	}
+	return errors.New("gopenpgp: key " + key.GetHexKeyID() + " has no user ID for " + email)
+}
+
+func normalizeTOFUEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package crypto
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const tofuTestEmail = "contact@example.com"
+
+func generateTOFUTestKeys(t *testing.T) (*Key, *Key) {
+	first, err := GenerateKey("Contact", tofuTestEmail, "x25519", 0)
+	if err != nil {
+		t.Fatal("Cannot generate key:", err)
+	}
+
+	second, err := GenerateKey("Contact", tofuTestEmail, "x25519", 0)
+	if err != nil {
+		t.Fatal("Cannot generate key:", err)
+	}
+
+	return first, second
+}
+
+func testTOFUStore(t *testing.T, storage TOFUStorage) {
+	first, second := generateTOFUTestKeys(t)
+	store := NewTOFUStore(storage)
+
+	binding, err := store.GetBinding(tofuTestEmail)
+	if err != nil {
+		t.Fatal("Expected no error while getting binding, got:", err)
+	}
+	assert.Nil(t, binding)
+
+	binding, err = store.Observe("Contact@Example.com ", first)
+	if err != nil {
+		t.Fatal("Expected no error while observing key, got:", err)
+	}
+	assert.Exactly(t, tofuTestEmail, binding.Email)
+	assert.Exactly(t, first.GetFingerprint(), binding.Fingerprint)
+	assert.Exactly(t, GetUnixTime(), binding.FirstSeen)
+	assert.False(t, binding.Conflict)
+
+	binding, err = store.RecordSignature(tofuTestEmail, first, 1000)
+	if err != nil {
+		t.Fatal("Expected no error while recording signature, got:", err)
+	}
+	_, err = store.RecordSignature(tofuTestEmail, first, 500)
+	if err != nil {
+		t.Fatal("Expected no error while recording signature, got:", err)
+	}
+
+	binding, err = store.GetBinding(tofuTestEmail)
+	if err != nil {
+		t.Fatal("Expected no error while getting binding, got:", err)
+	}
+	assert.Exactly(t, 2, binding.SignatureCount)
+	assert.Exactly(t, int64(500), binding.FirstSignature)
+	assert.Exactly(t, int64(1000), binding.LastSignature)
+
+	_, err = store.Observe(tofuTestEmail, second)
+	castedErr := &TOFUConflictError{}
+	if !errors.As(err, castedErr) {
+		t.Fatal("Expected a conflict error, got:", err)
+	}
+	assert.Exactly(t, first.GetFingerprint(), castedErr.PinnedFingerprint)
+	assert.Exactly(t, second.GetFingerprint(), castedErr.Fingerprint)
+
+	binding, err = store.GetBinding(tofuTestEmail)
+	if err != nil {
+		t.Fatal("Expected no error while getting binding, got:", err)
+	}
+	assert.True(t, binding.Conflict)
+	assert.Exactly(t, []string{second.GetFingerprint()}, binding.ConflictingFingerprints)
+
+	_, err = store.RecordSignature(tofuTestEmail, first, 2000)
+	assert.True(t, errors.As(err, castedErr))
+
+	binding, err = store.Accept(tofuTestEmail, second)
+	if err != nil {
+		t.Fatal("Expected no error while accepting key, got:", err)
+	}
+	assert.Exactly(t, second.GetFingerprint(), binding.Fingerprint)
+	assert.False(t, binding.Conflict)
+	assert.Exactly(t, 0, binding.SignatureCount)
+
+	_, err = store.Observe("other@example.com", second)
+	assert.Error(t, err)
+}
+
+func TestTOFUMemoryStorage(t *testing.T) {
+	testTOFUStore(t, NewTOFUMemoryStorage())
+}
+
+func TestTOFUFileStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tofu.json")
+	testTOFUStore(t, NewTOFUFileStorage(path))
+
+	binding, err := NewTOFUStore(NewTOFUFileStorage(path)).GetBinding(tofuTestEmail)
+	if err != nil {
+		t.Fatal("Expected no error while reloading binding, got:", err)
+	}
+	assert.NotNil(t, binding)
+	assert.False(t, binding.Conflict)
+}
+
+func TestTOFUGetKeyRing(t *testing.T) {
+	first, second := generateTOFUTestKeys(t)
+	store := NewTOFUStore(NewTOFUMemoryStorage())
+
+	candidates, err := NewKeyRing(first)
+	if err != nil {
+		t.Fatal("Expected no error while creating keyring, got:", err)
+	}
+	assert.Nil(t, candidates.AddKey(second))
+
+	keyRing, err := store.GetKeyRing(tofuTestEmail, candidates)
+	if err != nil {
+		t.Fatal("Expected no error while getting keyring, got:", err)
+	}
+	assert.Exactly(t, []uint64{first.GetKeyID()}, keyRing.GetKeyIDs())
+
+	secondKeyRing, err := NewKeyRing(second)
+	if err != nil {
+		t.Fatal("Expected no error while creating keyring, got:", err)
+	}
+
+	_, err = store.GetKeyRing(tofuTestEmail, secondKeyRing)
+	assert.True(t, errors.As(err, &TOFUConflictError{}))
+
+	_, err = store.GetKeyRing(tofuTestEmail, candidates)
+	assert.True(t, errors.As(err, &TOFUConflictError{}))
+
+	_, err = store.Accept(tofuTestEmail, first)
+	if err != nil {
+		t.Fatal("Expected no error while accepting key, got:", err)
+	}
+
+	keyRing, err = store.GetKeyRing(tofuTestEmail, candidates)
+	if err != nil {
+		t.Fatal("Expected no error while getting keyring, got:", err)
+	}
+	assert.Exactly(t, []uint64{first.GetKeyID()}, keyRing.GetKeyIDs())
+}
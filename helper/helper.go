@@ -46,6 +46,85 @@ func EncryptMessageArmored(key, plaintext string) (string, error) {
 	return encryptMessageArmored(key, crypto.NewPlainMessageFromString(plaintext))
 }
 
+// EncryptMessageArmoredWithPassword generates an armored PGP message given a
+// plaintext, an armored public key and a password: both the private key and
+// the password can decrypt the message.
+func EncryptMessageArmoredWithPassword(key string, password []byte, plaintext string) (string, error) {
+	publicKeyRing, err := createPublicKeyRing(key)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := publicKeyRing.EncryptWithPasswords(
+		crypto.NewPlainMessageFromString(plaintext),
+		[][]byte{password},
+		nil,
+	)
+	if err != nil {
+		return "", errors.Wrap(err, "gopenpgp: unable to encrypt message")
+	}
+
+	ciphertextArmored, err := ciphertext.GetArmored()
+	if err != nil {
+		return "", errors.Wrap(err, "gopenpgp: unable to armor ciphertext")
+	}
+
+	return ciphertextArmored, nil
+}
+
+// EncryptMessageArmoredAuthenticated generates an armored PGP message given a
+// plaintext and an armored public key, after checking that the key is
+// authenticated by the given trust model at the current time.
+func EncryptMessageArmoredAuthenticated(model *crypto.TrustModel, key, plaintext string) (string, error) {
+	publicKeyRing, err := createPublicKeyRing(key)
+	if err != nil {
+		return "", err
+	}
+
+	if err = publicKeyRing.Authenticate(model, crypto.GetUnixTime()); err != nil {
+		return "", errors.Wrap(err, "gopenpgp: unable to authenticate recipient")
+	}
+
+	ciphertext, err := publicKeyRing.Encrypt(crypto.NewPlainMessageFromString(plaintext), nil)
+	if err != nil {
+		return "", errors.Wrap(err, "gopenpgp: unable to encrypt message")
+	}
+
+	ciphertextArmored, err := ciphertext.GetArmored()
+	if err != nil {
+		return "", errors.Wrap(err, "gopenpgp: unable to armor ciphertext")
+	}
+
+	return ciphertextArmored, nil
+}
+
+// EncryptMessageArmoredTOFU generates an armored PGP message given a
+// plaintext and an armored public key for the email address, after checking
+// that the key matches the key pinned for the address in the TOFU store.
+// If no key was pinned for the address yet, the given key is pinned.
+func EncryptMessageArmoredTOFU(store *crypto.TOFUStore, email, key, plaintext string) (string, error) {
+	publicKeyRing, err := createPublicKeyRing(key)
+	if err != nil {
+		return "", err
+	}
+
+	if publicKeyRing, err = store.GetKeyRing(email, publicKeyRing); err != nil {
+		return "", errors.Wrap(err, "gopenpgp: unable to check recipient key")
+	}
+
+	ciphertext, err := publicKeyRing.Encrypt(crypto.NewPlainMessageFromString(plaintext), nil)
+	if err != nil {
+		return "", errors.Wrap(err, "gopenpgp: unable to encrypt message")
+	}
+
+	ciphertextArmored, err := ciphertext.GetArmored()
+	if err != nil {
+		return "", errors.Wrap(err, "gopenpgp: unable to armor ciphertext")
+	}
+
+	return ciphertextArmored, nil
+}
+
 // EncryptSignMessageArmored generates an armored signed PGP message given a
 // plaintext and an armored public key a private key and its passphrase.
 func EncryptSignMessageArmored(
@@ -50,6 +50,121 @@ func TestArmoredTextMessageEncryption(t *testing.T) {
 	assert.Exactly(t, plaintext, decrypted)
 }
 
+func TestArmoredTextMessageEncryptionWithPassword(t *testing.T) {
+	var plaintext = "Secret message"
+	var password = []byte("shared password")
+
+	armored, err := EncryptMessageArmoredWithPassword(readTestFile("keyring_publicKey", false), password, plaintext)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	decrypted, err := DecryptMessageArmored(
+		readTestFile("keyring_privateKey", false),
+		testMailboxPassword, // Password defined in base_test
+		armored,
+	)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, plaintext, decrypted)
+
+	decrypted, err = DecryptMessageWithPassword(password, armored)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting with password, got:", err)
+	}
+	assert.Exactly(t, plaintext, decrypted)
+}
+
+func TestArmoredTextMessageEncryptionAuthenticated(t *testing.T) {
+	var plaintext = "Secret message"
+
+	root, err := crypto.GenerateKey("Root", "root@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error when generating key, got:", err)
+	}
+
+	rootKeyRing, err := crypto.NewKeyRing(root)
+	if err != nil {
+		t.Fatal("Expected no error when creating keyring, got:", err)
+	}
+
+	recipient, err := crypto.NewKeyFromArmored(readTestFile("keyring_publicKey", false))
+	if err != nil {
+		t.Fatal("Expected no error when reading key, got:", err)
+	}
+
+	model := crypto.NewTrustModel()
+	if err = model.AddRoot(root, 0, 120); err != nil {
+		t.Fatal("Expected no error when adding root, got:", err)
+	}
+
+	armoredKey, err := recipient.GetArmoredPublicKey()
+	if err != nil {
+		t.Fatal("Expected no error when armoring key, got:", err)
+	}
+
+	_, err = EncryptMessageArmoredAuthenticated(model, armoredKey, plaintext)
+	assert.Error(t, err)
+
+	certified, err := rootKeyRing.CertifyKey(recipient, "UserID", 0, 0)
+	if err != nil {
+		t.Fatal("Expected no error when certifying key, got:", err)
+	}
+
+	armoredKey, err = certified.GetArmoredPublicKey()
+	if err != nil {
+		t.Fatal("Expected no error when armoring key, got:", err)
+	}
+
+	armored, err := EncryptMessageArmoredAuthenticated(model, armoredKey, plaintext)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	decrypted, err := DecryptMessageArmored(
+		readTestFile("keyring_privateKey", false),
+		testMailboxPassword, // Password defined in base_test
+		armored,
+	)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+
+	assert.Exactly(t, plaintext, decrypted)
+}
+
+func TestArmoredTextMessageEncryptionTOFU(t *testing.T) {
+	var plaintext = "Secret message"
+	var email = "contact@example.com"
+
+	store := crypto.NewTOFUStore(crypto.NewTOFUMemoryStorage())
+
+	pinned, err := GenerateKey("Contact", email, []byte("passphrase"), "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error when generating key, got:", err)
+	}
+
+	other, err := GenerateKey("Contact", email, []byte("passphrase"), "x25519", 0)
+	if err != nil {
+		t.Fatal("Expected no error when generating key, got:", err)
+	}
+
+	armored, err := EncryptMessageArmoredTOFU(store, email, pinned, plaintext)
+	if err != nil {
+		t.Fatal("Expected no error when encrypting, got:", err)
+	}
+
+	decrypted, err := DecryptMessageArmored(pinned, []byte("passphrase"), armored)
+	if err != nil {
+		t.Fatal("Expected no error when decrypting, got:", err)
+	}
+	assert.Exactly(t, plaintext, decrypted)
+
+	_, err = EncryptMessageArmoredTOFU(store, email, other, plaintext)
+	assert.Error(t, err)
+}
+
 func TestArmoredTextMessageEncryptionVerification(t *testing.T) {
 	var plaintext = "Secret message"
 
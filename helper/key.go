@@ -22,7 +22,13 @@ func UpdatePrivateKeyPassphrase(
 	}
 	defer unlocked.ClearPrivateParams()
 
-	locked, err := unlocked.Lock(newPassphrase)
+	// Keep the S2K parameters and AEAD protection of the old key
+	options, err := key.GetLockOptions()
+	if err != nil {
+		return "", errors.Wrap(err, "gopenpgp: unable to read key protection")
+	}
+
+	locked, err := unlocked.LockWithOptions(newPassphrase, options)
 	if err != nil {
 		return "", errors.Wrap(err, "gopenpgp: unable to lock new key")
 	}
@@ -4,6 +4,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
 )
 
 func TestGetSHA256FingerprintsV4(t *testing.T) {
@@ -16,3 +19,47 @@ func TestGetSHA256FingerprintsV4(t *testing.T) {
 	assert.Exactly(t, "d9ac0b857da6d2c8be985b251a9e3db31e7a1d2d832d1f07ebe838a9edce9c24", sha256Fingerprints[0])
 	assert.Exactly(t, "203dfba1f8442c17e59214d9cd11985bfc5cc8721bb4a71740dd5507e58a1a0d", sha256Fingerprints[1])
 }
+
+func TestUpdatePrivateKeyPassphraseKeepsProtection(t *testing.T) {
+	key, err := crypto.GenerateKey("Protected", "protected@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatal("Cannot generate key:", err)
+	}
+
+	cfbOptions := crypto.NewKeyLockOptions(crypto.NewIteratedS2KParams(65536), "")
+	cfbOptions.Cipher = constants.AES128
+	for _, options := range []*crypto.KeyLockOptions{
+		crypto.NewKeyLockOptions(crypto.NewArgon2S2KParams(1, 1, 64), constants.AEADOCB),
+		cfbOptions,
+	} {
+		locked, err := key.LockWithOptions(testMailboxPassword, options)
+		if err != nil {
+			t.Fatal("Cannot lock key:", err)
+		}
+		armored, err := locked.Armor()
+		if err != nil {
+			t.Fatal("Cannot armor key:", err)
+		}
+
+		newPassphrase := []byte("banana")
+		updated, err := UpdatePrivateKeyPassphrase(armored, testMailboxPassword, newPassphrase)
+		if err != nil {
+			t.Fatal("Expected no error while updating passphrase, got:", err)
+		}
+
+		updatedKey, err := crypto.NewKeyFromArmored(updated)
+		if err != nil {
+			t.Fatal("Expected no error while parsing key, got:", err)
+		}
+		updatedOptions, err := updatedKey.GetLockOptions()
+		if err != nil {
+			t.Fatal("Expected no error while reading lock options, got:", err)
+		}
+		assert.Exactly(t, options, updatedOptions)
+
+		_, err = updatedKey.Unlock(testMailboxPassword)
+		assert.Error(t, err)
+		_, err = updatedKey.Unlock(newPassphrase)
+		assert.NoError(t, err)
+	}
+}
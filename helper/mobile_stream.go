@@ -27,6 +27,29 @@ func (w *Mobile2GoWriter) Write(b []byte) (n int, err error) {
 	return w.writer.Write(bufferCopy)
 }
 
+// Mobile2GoWriteCloser is used to wrap a WriteCloser in the mobile app runtime,
+// to be usable in the golang runtime (via gomobile).
+type Mobile2GoWriteCloser struct {
+	writer crypto.WriteCloser
+}
+
+// NewMobile2GoWriteCloser wraps a WriteCloser to be usable in the golang runtime (via gomobile).
+func NewMobile2GoWriteCloser(writer crypto.WriteCloser) *Mobile2GoWriteCloser {
+	return &Mobile2GoWriteCloser{writer}
+}
+
+// Write writes the data in the provided buffer in the wrapped writer.
+// It clones the provided data to prevent errors with garbage collectors.
+func (w *Mobile2GoWriteCloser) Write(b []byte) (n int, err error) {
+	bufferCopy := clone(b)
+	return w.writer.Write(bufferCopy)
+}
+
+// Close closes the wrapped writer.
+func (w *Mobile2GoWriteCloser) Close() (err error) {
+	return w.writer.Close()
+}
+
 // Mobile2GoWriterWithSHA256 is used to wrap a writer in the mobile app runtime,
 // to be usable in the golang runtime (via gomobile).
 // It also computes the SHA256 hash of the data being written on the fly.
@@ -201,3 +224,33 @@ func VerifySignatureExplicit(
 	}
 	return
 }
+
+// EncryptStreamWithPasswordMobile encrypts with a password the plaintext data
+// written to the returned Mobile2GoWriteCloser, and writes the encrypted message
+// to pgpMessageWriter. The message is complete once the writer is closed.
+func EncryptStreamWithPasswordMobile(
+	pgpMessageWriter crypto.Writer,
+	plainMessageMetadata *crypto.PlainMessageMetadata,
+	password []byte,
+) (*Mobile2GoWriteCloser, error) {
+	plainMessageWriter, err := crypto.EncryptStreamWithPassword(
+		pgpMessageWriter,
+		plainMessageMetadata,
+		password,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return NewMobile2GoWriteCloser(plainMessageWriter), nil
+}
+
+// DecryptStreamWithPasswordMobile decrypts a password protected message read
+// from a MobileReader. The plaintext data can be read in the mobile runtime by
+// wrapping the returned reader with NewGo2AndroidReader or NewGo2IOSReader,
+// and a wrong password can be reported when the end of the data is reached.
+func DecryptStreamWithPasswordMobile(
+	message MobileReader,
+	password []byte,
+) (*crypto.PlainMessageReader, error) {
+	return crypto.DecryptStreamWithPassword(NewMobile2GoReader(message), password)
+}
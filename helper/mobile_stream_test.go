@@ -185,6 +185,59 @@ func TestMobile2GoReader(t *testing.T) {
 	}
 }
 
+func TestEncryptDecryptStreamWithPasswordMobile(t *testing.T) {
+	testData := []byte("Hello World!")
+	password := []byte("password")
+	metadata := crypto.NewPlainMessageMetadata(true, "hello.txt", 1557754627)
+
+	var ciphertext bytes.Buffer
+	writer, err := EncryptStreamWithPasswordMobile(NewMobile2GoWriter(&ciphertext), metadata, password)
+	if err != nil {
+		t.Fatal("Expected no error while encrypting, got:", err)
+	}
+	if _, err = writer.Write(testData); err != nil {
+		t.Fatal("Expected no error while writing, got:", err)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal("Expected no error while closing, got:", err)
+	}
+
+	_, err = DecryptStreamWithPasswordMobile(
+		&testMobileReader{bytes.NewReader(ciphertext.Bytes()), false},
+		[]byte("wrong password"),
+	)
+	if err == nil {
+		t.Fatal("Expected an error while decrypting with a wrong password, got nil")
+	}
+
+	plainMessageReader, err := DecryptStreamWithPasswordMobile(
+		&testMobileReader{bytes.NewReader(ciphertext.Bytes()), false},
+		password,
+	)
+	if err != nil {
+		t.Fatal("Expected no error while decrypting, got:", err)
+	}
+	if decryptedMetadata := plainMessageReader.GetMetadata(); *decryptedMetadata != *metadata {
+		t.Fatalf("expected metadata to be %v, got %v", metadata, decryptedMetadata)
+	}
+
+	reader := NewGo2IOSReader(plainMessageReader)
+	var decrypted []byte
+	for {
+		result, err := reader.Read(2)
+		if err != nil {
+			t.Fatal("Expected no error while reading, got:", err)
+		}
+		decrypted = append(decrypted, result.Data...)
+		if result.IsEOF {
+			break
+		}
+	}
+	if !bytes.Equal(testData, decrypted) {
+		t.Fatalf("expected data to be %x, got %x", testData, decrypted)
+	}
+}
+
 func setUpTestKeyRing() (*crypto.KeyRing, *crypto.KeyRing, error) {
 	testKey, err := crypto.GenerateKey("test", "test@protonmail.com", "x25519", 256)
 	if err != nil {
@@ -5,10 +5,19 @@ package subtle
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"time"
 
+	"github.com/pkg/errors"
 	"golang.org/x/crypto/scrypt"
 )
 
+// Bounds of the calibrated scrypt parameter.
+const (
+	minDeriveKeyN          = 1 << 14
+	maxDeriveKeyN          = 1 << 20
+	calibrationMinDuration = 20 * time.Millisecond
+)
+
 // EncryptWithoutIntegrity encrypts data with AES-CTR. Note: this encryption
 // mode is not secure when stored/sent on an untrusted medium.
 func EncryptWithoutIntegrity(key, input, iv []byte) (output []byte, err error) {
@@ -29,7 +38,42 @@ func DecryptWithoutIntegrity(key, input, iv []byte) ([]byte, error) {
 }
 
 // DeriveKey derives a key from a password using scrypt. n should be set to the
-// highest power of 2 you can derive within 100 milliseconds.
+// highest power of 2 you can derive within 100 milliseconds, as returned by
+// CalibrateDeriveKey(100, maxMemory).
 func DeriveKey(password string, salt []byte, n int) ([]byte, error) {
 	return scrypt.Key([]byte(password), salt, n, 8, 1, 32)
 }
+
+// CalibrateDeriveKey benchmarks scrypt on the current machine, and returns the
+// highest power of 2 n for DeriveKey that derives a key within targetMillis
+// milliseconds, using at most maxMemory KiB of memory. n is at least 2^14, and
+// at most 2^20.
+func CalibrateDeriveKey(targetMillis, maxMemory int) (int, error) {
+	if targetMillis <= 0 {
+		return 0, errors.New("gopenpgp: invalid calibration target duration")
+	}
+	// scrypt with r = 8 uses n KiB of memory
+	if maxMemory < minDeriveKeyN {
+		return 0, errors.New("gopenpgp: memory budget is too low for scrypt")
+	}
+	target := time.Duration(targetMillis) * time.Millisecond
+
+	salt := make([]byte, 8)
+	runs := 0
+	start := time.Now()
+	for time.Since(start) < calibrationMinDuration {
+		if _, err := DeriveKey("gopenpgp scrypt calibration", salt, minDeriveKeyN); err != nil {
+			return 0, errors.Wrap(err, "gopenpgp: error in calibrating scrypt")
+		}
+		runs++
+	}
+	elapsed := time.Since(start) / time.Duration(runs)
+
+	// The duration of scrypt is linear in n
+	n := minDeriveKeyN
+	for n*2 <= maxMemory && n*2 <= maxDeriveKeyN && elapsed*2 <= target {
+		n *= 2
+		elapsed *= 2
+	}
+	return n, nil
+}
@@ -30,3 +30,21 @@ func TestSubtle_DeriveKey(t *testing.T) {
 	dk, _ := DeriveKey("some password", salt, 32768)
 	assert.Exactly(t, "9469cccfc8a8d005247f39fa3e5b35a97db456cecf18deac6d84364d0818d763", hex.EncodeToString(dk))
 }
+
+func TestSubtle_CalibrateDeriveKey(t *testing.T) {
+	n, err := CalibrateDeriveKey(10, 1<<15)
+	if err != nil {
+		t.Fatal("Expected no error while calibrating scrypt, got:", err)
+	}
+	assert.GreaterOrEqual(t, n, 1<<14)
+	assert.LessOrEqual(t, n, 1<<15)
+	assert.Exactly(t, 0, n&(n-1))
+
+	_, err = DeriveKey("some password", []byte("salt"), n)
+	assert.NoError(t, err)
+
+	_, err = CalibrateDeriveKey(10, 1024)
+	assert.Error(t, err)
+	_, err = CalibrateDeriveKey(0, 1<<15)
+	assert.Error(t, err)
+}